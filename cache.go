@@ -0,0 +1,118 @@
+package meddler
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// LoadCache keeps the records read by Load in memory for a while, so that
+// repeated lookups of reference data that rarely changes do not go to the
+// database every time. Records are cached by table, struct type, and
+// primary key. A LoadCache is safe for concurrent use.
+//
+// Cached records are copied into dst with a shallow copy, so pointer,
+// slice, and map fields share their contents with the cached record and
+// must not be modified.
+//
+// Expired records are removed when they are looked up again, and all of
+// them at most once per TTL when a record is added, so a cache holds
+// little more than the records loaded within the last two TTLs.
+//
+// The cache sits in front of Load rather than being a DB implementation,
+// since *sql.Rows values cannot be stored and replayed.
+type LoadCache struct {
+	Database *Database     // the Database used to load records; Default if nil
+	TTL      time.Duration // how long records are cached
+
+	mutex   sync.Mutex
+	entries map[loadCacheKey]loadCacheEntry
+	swept   time.Time // when expired entries were last removed
+}
+
+type loadCacheKey struct {
+	table string
+	typ   reflect.Type
+	pk    int64
+}
+
+type loadCacheEntry struct {
+	value   reflect.Value
+	expires time.Time
+}
+
+// NewLoadCache returns a LoadCache keeping records for ttl.
+func NewLoadCache(d *Database, ttl time.Duration) *LoadCache {
+	return &LoadCache{Database: d, TTL: ttl}
+}
+
+// Load is like Database.Load, but returns a cached copy of the record if it
+// was loaded less than TTL ago.
+func (c *LoadCache) Load(db DB, table string, dst interface{}, pk int64) error {
+	dstVal := reflect.ValueOf(dst)
+	if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() || dstVal.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("meddler.LoadCache.Load: dst must be a non-nil pointer to a struct, found %T", dst)
+	}
+	key := loadCacheKey{table: table, typ: dstVal.Type(), pk: pk}
+
+	c.mutex.Lock()
+	entry, present := c.entries[key]
+	if present && !time.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		present = false
+	}
+	c.mutex.Unlock()
+	if present {
+		dstVal.Elem().Set(entry.value)
+		return nil
+	}
+
+	d := c.Database
+	if d == nil {
+		d = Default
+	}
+	if err := d.Load(db, table, dst, pk); err != nil {
+		return err
+	}
+
+	// keep a copy, so later changes to dst do not affect the cache
+	value := reflect.New(dstVal.Type().Elem()).Elem()
+	value.Set(dstVal.Elem())
+	now := time.Now()
+	c.mutex.Lock()
+	if c.entries == nil {
+		c.entries = make(map[loadCacheKey]loadCacheEntry)
+	}
+	if now.Sub(c.swept) >= c.TTL {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	c.entries[key] = loadCacheEntry{value: value, expires: now.Add(c.TTL)}
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// Invalidate removes the cached copies of a record from the cache, for all
+// struct types it was loaded into.
+func (c *LoadCache) Invalidate(table string, pk int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.entries {
+		if key.table == table && key.pk == pk {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// InvalidateAll empties the cache.
+func (c *LoadCache) InvalidateAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = nil
+}
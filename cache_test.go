@@ -0,0 +1,78 @@
+package meddler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadCache(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	rec := &recordingDB{DB: db}
+	cache := NewLoadCache(SQLite, time.Hour)
+
+	elt := new(Person)
+	if err := cache.Load(rec, "person", elt, 1); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	elt.Name = "changed"
+
+	// the second Load is served from the cache
+	again := new(Person)
+	if err := cache.Load(rec, "person", again, 1); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if len(rec.queries) != 1 {
+		t.Errorf("expected 1 query, found %d", len(rec.queries))
+	}
+	if again.Name != "Alice" {
+		t.Errorf("expected a copy of Alice from the cache, found %s", again.Name)
+	}
+
+	// other records are loaded separately
+	if err := cache.Load(rec, "person", new(Person), 2); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if len(rec.queries) != 2 {
+		t.Errorf("expected 2 queries, found %d", len(rec.queries))
+	}
+
+	cache.Invalidate("person", 1)
+	if err := cache.Load(rec, "person", again, 1); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if len(rec.queries) != 3 {
+		t.Errorf("expected a query after invalidation, found %d queries", len(rec.queries))
+	}
+
+	// expired entries are loaded again
+	cache.TTL = 0
+	cache.InvalidateAll()
+	for i := 0; i < 2; i++ {
+		if err := cache.Load(rec, "person", again, 1); err != nil {
+			t.Fatalf("Load error: %v", err)
+		}
+	}
+	if len(rec.queries) != 5 {
+		t.Errorf("expected a query for each load without a TTL, found %d queries", len(rec.queries))
+	}
+
+	// expired entries do not pile up, whether or not they are looked up
+	if err := cache.Load(rec, "person", new(Person), 2); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if err := cache.Load(rec, "person", again, 1); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	cache.mutex.Lock()
+	if len(cache.entries) != 1 {
+		t.Errorf("expected only the latest entry to be kept, found %d", len(cache.entries))
+	}
+	cache.mutex.Unlock()
+
+	if err := cache.Load(rec, "person", new(Person), 10000); err == nil {
+		t.Errorf("expected an error loading a missing record")
+	}
+	db.Exec("delete from person")
+}
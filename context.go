@@ -0,0 +1,74 @@
+package meddler
+
+import (
+	"context"
+)
+
+// ContextMeddler is a Meddler that is also given the context of the
+// operation, as set with Database.WithContext. Its context methods are
+// called in place of the plain ones, with context.Background() when no
+// context was set.
+type ContextMeddler interface {
+	Meddler
+
+	// PreReadContext is PreRead with the context of the operation.
+	PreReadContext(ctx context.Context, fieldAddr interface{}) (scanTarget interface{}, err error)
+
+	// PostReadContext is PostRead with the context of the operation.
+	PostReadContext(ctx context.Context, fieldAddr, scanTarget interface{}) error
+
+	// PreWriteContext is PreWrite with the context of the operation.
+	PreWriteContext(ctx context.Context, field interface{}) (saveValue interface{}, err error)
+}
+
+// WithContext returns a copy of d that hands ctx to the meddlers
+// implementing ContextMeddler, such as an EncryptedMeddler looking up the
+// key of the tenant of a request. The copy shares the cached struct data
+// of d, so it is cheap to make one for each request, but its settings
+// must not be changed; make a plain copy of d for that.
+func (d *Database) WithContext(ctx context.Context) *Database {
+	copied := *d
+	copied.ctx = ctx
+	copied.base = d.cacheOwner()
+	return &copied
+}
+
+// Context returns the context set with WithContext, or
+// context.Background() if there is none.
+func (d *Database) Context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// cacheOwner returns the Database whose cached struct data d uses.
+func (d *Database) cacheOwner() *Database {
+	if d.base != nil {
+		return d.base
+	}
+	return d
+}
+
+// preRead, postRead, and preWrite call a meddler, passing the context of
+// d to a ContextMeddler.
+func (d *Database) preRead(m Meddler, fieldAddr interface{}) (interface{}, error) {
+	if cm, ok := m.(ContextMeddler); ok {
+		return cm.PreReadContext(d.Context(), fieldAddr)
+	}
+	return m.PreRead(fieldAddr)
+}
+
+func (d *Database) postRead(m Meddler, fieldAddr, scanTarget interface{}) error {
+	if cm, ok := m.(ContextMeddler); ok {
+		return cm.PostReadContext(d.Context(), fieldAddr, scanTarget)
+	}
+	return m.PostRead(fieldAddr, scanTarget)
+}
+
+func (d *Database) preWrite(m Meddler, field interface{}) (interface{}, error) {
+	if cm, ok := m.(ContextMeddler); ok {
+		return cm.PreWriteContext(d.Context(), field)
+	}
+	return m.PreWrite(field)
+}
@@ -0,0 +1,48 @@
+package meddler
+
+import (
+	"database/sql"
+	"sync/atomic"
+)
+
+// CountingDB wraps a DB and counts the statements sent through it, so the
+// number of round trips of a higher-level operation can be checked, for
+// example to catch N+1 query patterns. Wrap the DB for the duration of the
+// operation and read Count afterwards. A CountingDB is safe for
+// concurrent use.
+type CountingDB struct {
+	count int64 // first, for 64-bit alignment of atomic operations
+
+	DB
+}
+
+// NewCountingDB returns a CountingDB passing statements through to db.
+func NewCountingDB(db DB) *CountingDB {
+	return &CountingDB{DB: db}
+}
+
+func (c *CountingDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	atomic.AddInt64(&c.count, 1)
+	return c.DB.Exec(query, args...)
+}
+
+func (c *CountingDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	atomic.AddInt64(&c.count, 1)
+	return c.DB.Query(query, args...)
+}
+
+func (c *CountingDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	atomic.AddInt64(&c.count, 1)
+	return c.DB.QueryRow(query, args...)
+}
+
+// Count returns the number of statements run since the CountingDB was
+// created or last reset.
+func (c *CountingDB) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+// Reset sets the count back to zero.
+func (c *CountingDB) Reset() {
+	atomic.StoreInt64(&c.count, 0)
+}
@@ -0,0 +1,67 @@
+package meddler
+
+import (
+	"testing"
+)
+
+func TestCountingDB(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	counter := NewCountingDB(db)
+	var lst []*Person
+	if err := QueryAll(counter, &lst, "select * from person"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if n := counter.Count(); n != 1 {
+		t.Errorf("expected 1 statement, found %d", n)
+	}
+
+	// loading records one by one takes a round trip each
+	counter.Reset()
+	for _, elt := range lst {
+		if err := Load(counter, "person", new(Person), elt.ID); err != nil {
+			t.Fatalf("Load error: %v", err)
+		}
+	}
+	if n := counter.Count(); n != int64(len(lst)) {
+		t.Errorf("expected %d statements, found %d", len(lst), n)
+	}
+
+	// reloading after an insert takes a second one
+	counter.Reset()
+	reloading := *SQLite
+	reloading.ReloadAfterInsert = true
+	alice.ID = 0
+	if err := reloading.Insert(counter, "person", alice); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if n := counter.Count(); n != 2 {
+		t.Errorf("expected 2 statements, found %d", n)
+	}
+	db.Exec("delete from person")
+
+	// related rows take one query per relation, however many rows there are
+	if _, err := db.Exec("create table author (id integer primary key, name text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table author")
+	if _, err := db.Exec("create table book (id integer primary key, author_id integer, editor_id integer, title text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table book")
+	db.Exec("insert into author (id, name) values (1, 'Ann')")
+	db.Exec("insert into book (id, author_id, editor_id, title) values (1, 1, 1, 'First'), (2, 1, 1, 'Second'), (3, 1, 1, 'Third')")
+
+	counter.Reset()
+	writer := new(Writer)
+	if err := SQLite.LoadWithRelations(counter, "author", writer, 1); err != nil {
+		t.Fatalf("LoadWithRelations error: %v", err)
+	}
+	if len(writer.Books) != 3 {
+		t.Errorf("expected 3 books, found %d", len(writer.Books))
+	}
+	if n := counter.Count(); n != 2 {
+		t.Errorf("expected 2 statements, found %d", n)
+	}
+}
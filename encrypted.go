@@ -0,0 +1,125 @@
+package meddler
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// EncryptedMeddler encrypts string and []byte fields with AES-GCM before
+// they are saved, and decrypts them on load. The stored value is the random
+// nonce followed by the sealed data. Empty values are saved as null.
+//
+// The key is obtained from the KeyFunc function each time a value is
+// encrypted or decrypted, so keys can be rotated or looked up lazily. It
+// is given the context of the operation, as set with Database.WithContext,
+// so multi-tenant programs can register one EncryptedMeddler and find the
+// key of the tenant of each request in its context:
+//
+//	meddler.Register("encrypted", &meddler.EncryptedMeddler{KeyFunc: func(ctx context.Context) ([]byte, error) {
+//		return keyOf(tenantOf(ctx))
+//	}})
+//
+//	err := meddler.PostgreSQL.WithContext(ctx).Insert(db, "secret", record)
+//
+// Register a pointer, since an EncryptedMeddler value cannot be compared.
+type EncryptedMeddler struct {
+	// KeyFunc returns the AES key to use for the context of the operation,
+	// which must be 16, 24, or 32 bytes long. The context is
+	// context.Background() if none was set.
+	KeyFunc func(ctx context.Context) ([]byte, error)
+}
+
+func (elt *EncryptedMeddler) aead(ctx context.Context) (cipher.AEAD, error) {
+	if elt.KeyFunc == nil {
+		return nil, fmt.Errorf("no KeyFunc function set")
+	}
+	key, err := elt.KeyFunc(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (elt *EncryptedMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	return elt.PreReadContext(context.Background(), fieldAddr)
+}
+
+func (elt *EncryptedMeddler) PreReadContext(ctx context.Context, fieldAddr interface{}) (scanTarget interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *string, *[]byte:
+		// give a pointer to a byte buffer to grab the raw data
+		return new([]byte), nil
+	default:
+		return nil, fmt.Errorf("meddler.EncryptedMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt *EncryptedMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	return elt.PostReadContext(context.Background(), fieldAddr, scanTarget)
+}
+
+func (elt *EncryptedMeddler) PostReadContext(ctx context.Context, fieldAddr, scanTarget interface{}) error {
+	raw := *scanTarget.(*[]byte)
+
+	var plain []byte
+	if raw != nil {
+		aead, err := elt.aead(ctx)
+		if err != nil {
+			return fmt.Errorf("meddler.EncryptedMeddler.PostRead: %v", err)
+		}
+		if len(raw) < aead.NonceSize() {
+			return fmt.Errorf("meddler.EncryptedMeddler.PostRead: stored value is too short")
+		}
+		nonce, sealed := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+		if plain, err = aead.Open(nil, nonce, sealed, nil); err != nil {
+			return fmt.Errorf("meddler.EncryptedMeddler.PostRead: decryption failed: %v", err)
+		}
+	}
+
+	switch tgt := fieldAddr.(type) {
+	case *string:
+		*tgt = string(plain)
+	case *[]byte:
+		*tgt = plain
+	default:
+		return fmt.Errorf("meddler.EncryptedMeddler.PostRead: unknown struct field type: %T", fieldAddr)
+	}
+	return nil
+}
+
+func (elt *EncryptedMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	return elt.PreWriteContext(context.Background(), field)
+}
+
+func (elt *EncryptedMeddler) PreWriteContext(ctx context.Context, field interface{}) (saveValue interface{}, err error) {
+	var plain []byte
+	switch tgt := field.(type) {
+	case string:
+		plain = []byte(tgt)
+	case []byte:
+		plain = tgt
+	default:
+		return nil, fmt.Errorf("meddler.EncryptedMeddler.PreWrite: unknown struct field type: %T", field)
+	}
+	if len(plain) == 0 {
+		return nil, nil
+	}
+
+	aead, err := elt.aead(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("meddler.EncryptedMeddler.PreWrite: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("meddler.EncryptedMeddler.PreWrite: generating nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
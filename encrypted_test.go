@@ -0,0 +1,98 @@
+package meddler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type ItemSecret struct {
+	ID     int64  `meddler:"id,pk"`
+	Stuff  string `meddler:"stuff,encrypted"`
+	StuffZ []byte `meddler:"stuffz,encrypted"`
+}
+
+type tenantKey struct{}
+
+var tenantKeys = map[string]string{
+	"alpha": "alpha-tenant-key-0123456789abcde",
+	"beta":  "beta-tenant-key-0123456789abcdef",
+}
+
+func TestEncryptedMeddler(t *testing.T) {
+	once.Do(setup)
+
+	// one meddler finds the key of each tenant in the context
+	scoped := *SQLite
+	scoped.Register("encrypted", &EncryptedMeddler{
+		KeyFunc: func(ctx context.Context) ([]byte, error) {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			key, present := tenantKeys[tenant]
+			if !present {
+				return nil, fmt.Errorf("no key for tenant %q", tenant)
+			}
+			return []byte(key), nil
+		},
+	})
+	alpha := scoped.WithContext(context.WithValue(context.Background(), tenantKey{}, "alpha"))
+	beta := scoped.WithContext(context.WithValue(context.Background(), tenantKey{}, "beta"))
+
+	elt := &ItemSecret{Stuff: "secret", StuffZ: []byte("more secret")}
+	if err := alpha.Insert(db, "item", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+
+	var raw []byte
+	if err := db.QueryRow("select stuffz from item where id = ?", elt.ID).Scan(&raw); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if bytes.Contains(raw, []byte("more secret")) {
+		t.Errorf("value was stored in the clear")
+	}
+
+	loaded := new(ItemSecret)
+	if err := alpha.Load(db, "item", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Stuff != "secret" || string(loaded.StuffZ) != "more secret" {
+		t.Errorf("unexpected values after round trip: %q %q", loaded.Stuff, loaded.StuffZ)
+	}
+
+	// another tenant cannot read the data
+	if err := beta.Load(db, "item", new(ItemSecret), elt.ID); err == nil {
+		t.Errorf("expected decryption with another tenant's key to fail")
+	}
+	if err := scoped.Load(db, "item", new(ItemSecret), elt.ID); err == nil {
+		t.Errorf("expected decryption without a tenant to fail")
+	}
+
+	// the same struct is written with the key of each tenant
+	other := &ItemSecret{Stuff: "beta secret", StuffZ: []byte("z")}
+	if err := beta.Insert(db, "item", other); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	loaded = new(ItemSecret)
+	if err := beta.Load(db, "item", loaded, other.ID); err != nil || loaded.Stuff != "beta secret" {
+		t.Errorf("expected beta to read its own data, found %q, %v", loaded.Stuff, err)
+	}
+	if err := alpha.Load(db, "item", new(ItemSecret), other.ID); err == nil {
+		t.Errorf("expected decryption with another tenant's key to fail")
+	}
+
+	// the copies share the cached struct data of the original
+	shared, _ := alpha.getFields(reflect.TypeOf(new(ItemSecret)))
+	original, _ := scoped.getFields(reflect.TypeOf(new(ItemSecret)))
+	if shared != original {
+		t.Errorf("expected WithContext copies to share cached struct data")
+	}
+
+	// without a scoped registration, the meddler is unknown
+	if err := Load(db, "item", new(ItemSecret), elt.ID); err == nil {
+		t.Errorf("expected an error for an unregistered meddler")
+	}
+	if _, err := db.Exec("delete from `item`"); err != nil {
+		t.Errorf("error wiping item table: %v", err)
+	}
+}
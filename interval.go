@@ -0,0 +1,188 @@
+package meddler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntervalMeddler stores time.Duration fields in PostgreSQL interval
+// columns. Durations are written as [-]H:MM:SS[.fraction], and the text
+// forms PostgreSQL produces are parsed on read, such as 01:30:00,
+// 1 day 02:00:00, 90 minutes, or ISO 8601 durations. Days are taken as
+// 24 hours; years and months have no fixed length and are rejected.
+// Null columns are read as zero.
+type IntervalMeddler bool
+
+func (elt IntervalMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *time.Duration:
+		return new(*string), nil
+	default:
+		return nil, fmt.Errorf("meddler.IntervalMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt IntervalMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	tgt, ok := fieldAddr.(*time.Duration)
+	if !ok {
+		return fmt.Errorf("meddler.IntervalMeddler.PostRead: unknown struct field type: %T", fieldAddr)
+	}
+	src := *scanTarget.(**string)
+	if src == nil {
+		*tgt = 0
+		return nil
+	}
+	d, err := parseInterval(*src)
+	if err != nil {
+		return fmt.Errorf("meddler.IntervalMeddler.PostRead: %v", err)
+	}
+	*tgt = d
+	return nil
+}
+
+func (elt IntervalMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	d, ok := field.(time.Duration)
+	if !ok {
+		return nil, fmt.Errorf("meddler.IntervalMeddler.PreWrite: unknown struct field type: %T", field)
+	}
+	return formatInterval(d), nil
+}
+
+func formatInterval(d time.Duration) string {
+	sign := ""
+	u := uint64(d)
+	if d < 0 {
+		sign = "-"
+		u = -u
+	}
+	h := u / uint64(time.Hour)
+	m := u / uint64(time.Minute) % 60
+	sec := u / uint64(time.Second) % 60
+	s := fmt.Sprintf("%s%d:%02d:%02d", sign, h, m, sec)
+	if frac := u % uint64(time.Second); frac > 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%09d", frac), "0")
+	}
+	return s
+}
+
+var intervalUnits = map[string]time.Duration{
+	"week":        7 * 24 * time.Hour,
+	"w":           7 * 24 * time.Hour,
+	"day":         24 * time.Hour,
+	"d":           24 * time.Hour,
+	"hour":        time.Hour,
+	"hr":          time.Hour,
+	"h":           time.Hour,
+	"minute":      time.Minute,
+	"min":         time.Minute,
+	"m":           time.Minute,
+	"second":      time.Second,
+	"sec":         time.Second,
+	"s":           time.Second,
+	"millisecond": time.Millisecond,
+	"msec":        time.Millisecond,
+	"ms":          time.Millisecond,
+	"microsecond": time.Microsecond,
+	"usec":        time.Microsecond,
+	"us":          time.Microsecond,
+}
+
+func parseInterval(s string) (time.Duration, error) {
+	text := strings.TrimSpace(s)
+	if strings.HasPrefix(text, "P") || strings.HasPrefix(text, "-P") {
+		return parseISO8601Duration(text)
+	}
+
+	// the postgres_verbose style starts with @ and may end with ago
+	fields := strings.Fields(strings.ToLower(text))
+	negate := false
+	if len(fields) > 0 && fields[0] == "@" {
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && fields[len(fields)-1] == "ago" {
+		negate = true
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("malformed interval %q", s)
+	}
+
+	var total float64
+	for i := 0; i < len(fields); i++ {
+		if strings.Contains(fields[i], ":") {
+			d, err := parseIntervalClock(fields[i])
+			if err != nil {
+				return 0, fmt.Errorf("malformed interval %q", s)
+			}
+			total += float64(d)
+			continue
+		}
+		n, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil || i+1 == len(fields) {
+			return 0, fmt.Errorf("malformed interval %q", s)
+		}
+		i++
+		// units may be given in the plural
+		unit := fields[i]
+		size, ok := intervalUnits[unit]
+		if !ok && strings.HasSuffix(unit, "s") {
+			unit = strings.TrimSuffix(unit, "s")
+			size, ok = intervalUnits[unit]
+		}
+		switch unit {
+		case "year", "yr", "y", "mon", "month", "decade", "century", "millennium", "millennia":
+			return 0, fmt.Errorf("interval %q has years or months, which have no fixed length", s)
+		}
+		if !ok {
+			return 0, fmt.Errorf("malformed interval %q: unknown unit %s", s, fields[i])
+		}
+		total += n * float64(size)
+	}
+
+	if math.Abs(total) > math.MaxInt64 {
+		return 0, fmt.Errorf("interval %q is out of range", s)
+	}
+	d := time.Duration(math.Round(total))
+	if negate {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseIntervalClock parses the [-]H:MM[:SS[.fraction]] part of an
+// interval.
+func parseIntervalClock(s string) (time.Duration, error) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("too many parts")
+	}
+	var d time.Duration
+	for i, part := range parts {
+		if part == "" {
+			return 0, fmt.Errorf("empty part")
+		}
+		unit := []time.Duration{time.Hour, time.Minute, time.Second}[i]
+		if i < len(parts)-1 || i < 2 {
+			n, err := strconv.ParseUint(part, 10, 32)
+			if err != nil {
+				return 0, err
+			}
+			d += time.Duration(n) * unit
+			continue
+		}
+		f, err := strconv.ParseFloat(part, 64)
+		if err != nil || f < 0 {
+			return 0, fmt.Errorf("bad seconds")
+		}
+		d += time.Duration(math.Round(f * float64(time.Second)))
+	}
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
@@ -0,0 +1,226 @@
+package meddler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ISO8601TimeMeddler stores time.Time and *time.Time fields as ISO 8601
+// text in UTC, such as 2013-06-23T15:30:12.5Z. The zero time and nil are
+// written as null, and null columns are read as the zero time or nil.
+type ISO8601TimeMeddler bool
+
+func (elt ISO8601TimeMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *time.Time, **time.Time:
+		return new(interface{}), nil
+	default:
+		return nil, fmt.Errorf("meddler.ISO8601TimeMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt ISO8601TimeMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	var t time.Time
+	isNull := false
+	switch src := (*scanTarget.(*interface{})).(type) {
+	case nil:
+		isNull = true
+	case time.Time:
+		// the driver parsed it already
+		t = src
+	case []byte:
+		parsed, err := time.Parse(time.RFC3339Nano, string(src))
+		if err != nil {
+			return fmt.Errorf("meddler.ISO8601TimeMeddler.PostRead: malformed time %q: %v", src, err)
+		}
+		t = parsed
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, src)
+		if err != nil {
+			return fmt.Errorf("meddler.ISO8601TimeMeddler.PostRead: malformed time %q: %v", src, err)
+		}
+		t = parsed
+	default:
+		return fmt.Errorf("meddler.ISO8601TimeMeddler.PostRead: unknown column value type: %T", src)
+	}
+	if !isNull {
+		t = t.UTC()
+	}
+
+	switch tgt := fieldAddr.(type) {
+	case *time.Time:
+		*tgt = t
+	case **time.Time:
+		if isNull {
+			*tgt = nil
+		} else {
+			*tgt = &t
+		}
+	default:
+		return fmt.Errorf("meddler.ISO8601TimeMeddler.PostRead: unknown struct field type: %T", fieldAddr)
+	}
+	return nil
+}
+
+func (elt ISO8601TimeMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	var t time.Time
+	switch tgt := field.(type) {
+	case time.Time:
+		t = tgt
+	case *time.Time:
+		if tgt != nil {
+			t = *tgt
+		}
+	default:
+		return nil, fmt.Errorf("meddler.ISO8601TimeMeddler.PreWrite: unknown struct field type: %T", field)
+	}
+	if t.IsZero() {
+		return nil, nil
+	}
+	return t.UTC().Format(time.RFC3339Nano), nil
+}
+
+// ISO8601DurationMeddler stores time.Duration fields as ISO 8601
+// durations, such as PT1H30M. Hours are not folded into days on write,
+// but days (D) and weeks (W) are accepted on read, taken as 24 hours and
+// 7 days. Years and months have no fixed length and are rejected.
+// Null columns are read as zero.
+type ISO8601DurationMeddler bool
+
+func (elt ISO8601DurationMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *time.Duration:
+		return new(*string), nil
+	default:
+		return nil, fmt.Errorf("meddler.ISO8601DurationMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt ISO8601DurationMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	tgt, ok := fieldAddr.(*time.Duration)
+	if !ok {
+		return fmt.Errorf("meddler.ISO8601DurationMeddler.PostRead: unknown struct field type: %T", fieldAddr)
+	}
+	src := *scanTarget.(**string)
+	if src == nil {
+		*tgt = 0
+		return nil
+	}
+	d, err := parseISO8601Duration(*src)
+	if err != nil {
+		return fmt.Errorf("meddler.ISO8601DurationMeddler.PostRead: %v", err)
+	}
+	*tgt = d
+	return nil
+}
+
+func (elt ISO8601DurationMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	d, ok := field.(time.Duration)
+	if !ok {
+		return nil, fmt.Errorf("meddler.ISO8601DurationMeddler.PreWrite: unknown struct field type: %T", field)
+	}
+	return formatISO8601Duration(d), nil
+}
+
+func formatISO8601Duration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+	var b strings.Builder
+	u := uint64(d)
+	if d < 0 {
+		b.WriteByte('-')
+		u = -u
+	}
+	b.WriteString("PT")
+	if h := u / uint64(time.Hour); h > 0 {
+		b.WriteString(strconv.FormatUint(h, 10) + "H")
+	}
+	if m := u / uint64(time.Minute) % 60; m > 0 {
+		b.WriteString(strconv.FormatUint(m, 10) + "M")
+	}
+	if ns := u % uint64(time.Minute); ns > 0 {
+		s := strconv.FormatUint(ns/uint64(time.Second), 10)
+		if frac := ns % uint64(time.Second); frac > 0 {
+			s += strings.TrimRight(fmt.Sprintf(".%09d", frac), "0")
+		}
+		b.WriteString(s + "S")
+	}
+	return b.String()
+}
+
+func parseISO8601Duration(s string) (time.Duration, error) {
+	text := s
+	negative := false
+	if strings.HasPrefix(text, "-") {
+		negative = true
+		text = text[1:]
+	}
+	if !strings.HasPrefix(text, "P") || len(text) < 2 {
+		return 0, fmt.Errorf("malformed duration %q", s)
+	}
+	text = text[1:]
+
+	var total time.Duration
+	inTime := false
+	for text != "" {
+		if text[0] == 'T' {
+			if inTime || len(text) == 1 {
+				return 0, fmt.Errorf("malformed duration %q", s)
+			}
+			inTime = true
+			text = text[1:]
+			continue
+		}
+		i := strings.IndexFunc(text, func(r rune) bool { return (r < '0' || r > '9') && r != '.' && r != ',' })
+		if i <= 0 {
+			return 0, fmt.Errorf("malformed duration %q", s)
+		}
+		var unit time.Duration
+		switch designator := text[i]; {
+		case !inTime && designator == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && designator == 'D':
+			unit = 24 * time.Hour
+		case inTime && designator == 'H':
+			unit = time.Hour
+		case inTime && designator == 'M':
+			unit = time.Minute
+		case inTime && designator == 'S':
+			unit = time.Second
+		case !inTime && (designator == 'Y' || designator == 'M'):
+			return 0, fmt.Errorf("duration %q has years or months, which have no fixed length", s)
+		default:
+			return 0, fmt.Errorf("malformed duration %q", s)
+		}
+
+		// split off a fraction, given with either decimal sign
+		whole, frac := text[:i], ""
+		if k := strings.IndexAny(whole, ".,"); k >= 0 {
+			whole, frac = whole[:k], whole[k+1:]
+		}
+		n, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || strings.ContainsAny(frac, ".,") {
+			return 0, fmt.Errorf("malformed duration %q", s)
+		}
+		if n > int64(math.MaxInt64/unit) || total > math.MaxInt64-time.Duration(n)*unit {
+			return 0, fmt.Errorf("duration %q is out of range", s)
+		}
+		total += time.Duration(n) * unit
+		if frac != "" {
+			f, err := strconv.ParseFloat("0."+frac, 64)
+			if err != nil {
+				return 0, fmt.Errorf("malformed duration %q", s)
+			}
+			total += time.Duration(math.Round(f * float64(unit)))
+		}
+		text = text[i+1:]
+	}
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
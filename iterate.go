@@ -0,0 +1,96 @@
+//go:build go1.23
+// +build go1.23
+
+package meddler
+
+import (
+	"context"
+	"database/sql"
+	"iter"
+	"reflect"
+)
+
+// Iterate performs the given query with the given arguments and returns an
+// iterator over the result rows, each one scanned into a new *T, where T is
+// a struct type. It is meant to be used with a range loop:
+//
+//	for person, err := range meddler.Iterate[Person](db, "select * from person") {
+//		...
+//	}
+//
+// The query runs when the loop starts. Errors are handed to the loop body
+// with a nil record, after which the iteration ends. The underlying rows
+// are closed when all rows have been read or the loop is left early.
+func Iterate[T any](db DB, query string, args ...interface{}) iter.Seq2[*T, error] {
+	return IterateWith[T](Default, db, query, args...)
+}
+
+// IterateWith is like Iterate, but uses the given Database type instead of
+// the Default one.
+func IterateWith[T any](d *Database, db DB, query string, args ...interface{}) iter.Seq2[*T, error] {
+	return iterate[T](d, nil, func() (*sql.Rows, error) {
+		return d.query(db, "Iterate", query, args...)
+	})
+}
+
+// IterateContext is like Iterate, but runs the query under ctx, as for
+// exports that may be abandoned. Once ctx is done, the iteration ends with
+// its error, and the rows are closed.
+func IterateContext[T any](ctx context.Context, db QueryerContext, query string, args ...interface{}) iter.Seq2[*T, error] {
+	return IterateContextWith[T](Default, ctx, db, query, args...)
+}
+
+// IterateContextWith is like IterateContext, but uses the given Database
+// type instead of the Default one.
+func IterateContextWith[T any](d *Database, ctx context.Context, db QueryerContext, query string, args ...interface{}) iter.Seq2[*T, error] {
+	return iterate[T](d, ctx, func() (*sql.Rows, error) {
+		return d.queryContext(ctx, db, "Iterate", query, args...)
+	})
+}
+
+// iterate returns an iterator over the rows returned by run, checking ctx
+// before each row if it is not nil.
+func iterate[T any](d *Database, ctx context.Context, run func() (*sql.Rows, error)) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		// get the list of struct fields
+		data, err := d.getFields(reflect.TypeOf((*T)(nil)))
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		// perform the query
+		rows, err := run()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		// make sure we always close rows
+		defer rows.Close()
+
+		// get the sql columns
+		columns, err := rows.Columns()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		for {
+			if ctx != nil && ctx.Err() != nil {
+				yield(nil, ctx.Err())
+				return
+			}
+			elt := new(T)
+			if err := d.scanRow(data, rows, elt, columns); err != nil {
+				if err != sql.ErrNoRows {
+					yield(nil, err)
+				}
+				return
+			}
+			if !yield(elt, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+//go:build go1.23
+// +build go1.23
+
+package meddler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIterate(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	var names []string
+	for p, err := range Iterate[Person](db, "select * from person order by id") {
+		if err != nil {
+			t.Fatalf("Iterate error: %v", err)
+		}
+		names = append(names, p.Name)
+	}
+	if len(names) != 2 || names[0] != "Alice" || names[1] != "Bob" {
+		t.Errorf("expected Alice and Bob, found %v", names)
+	}
+
+	// leave the loop early
+	count := 0
+	for _, err := range Iterate[Person](db, "select * from person order by id") {
+		if err != nil {
+			t.Fatalf("Iterate error: %v", err)
+		}
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("expected to stop after one row, found %d", count)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("expected rows to be closed after break, found %d connections in use", inUse)
+	}
+
+	for p, err := range Iterate[Person](db, "select * from nosuchtable") {
+		if err == nil || p != nil {
+			t.Errorf("expected an error and nil record for a failing query")
+		}
+	}
+	db.Exec("delete from person")
+}
+
+func TestIterateContext(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var names []string
+	var last error
+	for p, err := range IterateContext[Person](ctx, db, "select * from person order by id") {
+		if err != nil {
+			last = err
+			continue
+		}
+		names = append(names, p.Name)
+
+		// abandon the export after the first row
+		cancel()
+	}
+	if len(names) != 1 || names[0] != "Alice" {
+		t.Errorf("expected only Alice before cancelling, found %v", names)
+	}
+	if last != context.Canceled {
+		t.Errorf("expected the iteration to end with %v, found %v", context.Canceled, last)
+	}
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("expected rows to be closed after cancelling, found %d connections in use", inUse)
+	}
+
+	// a context that is already done stops the query itself
+	for p, err := range IterateContext[Person](ctx, db, "select * from person") {
+		if err == nil || p != nil {
+			t.Errorf("expected an error and nil record for a cancelled context")
+		}
+	}
+	db.Exec("delete from person")
+}
@@ -1,9 +1,18 @@
 package meddler
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
 	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type dbErr struct {
@@ -25,6 +34,49 @@ func DriverErr(err error) (error, bool) {
 	return err, false
 }
 
+// uniqueViolations lists text found in the errors that drivers return for
+// unique constraint violations, by dialect name.
+var uniqueViolations = map[string][]string{
+	"postgres": {"duplicate key value violates unique constraint", "SQLSTATE 23505"},
+	"mysql":    {"Error 1062", "Duplicate entry"},
+	"sqlite":   {"UNIQUE constraint failed"},
+	"mssql":    {"Violation of UNIQUE KEY constraint", "Violation of PRIMARY KEY constraint", "Cannot insert duplicate key"},
+}
+
+// IsUniqueViolation reports whether err, as returned by meddler or by the
+// driver, reports a violated unique constraint or primary key. Errors with
+// a SQLState method are checked for the standard code 23505; others are
+// recognized by the messages of the database named by Name, or those of
+// any known database if Name is not one of them.
+func (d *Database) IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	err, _ = DriverErr(err)
+	if state, ok := err.(interface{ SQLState() string }); ok && state.SQLState() == "23505" {
+		return true
+	}
+
+	msg := err.Error()
+	patterns, known := uniqueViolations[d.Name]
+	if !known {
+		for _, list := range uniqueViolations {
+			patterns = append(patterns, list...)
+		}
+	}
+	for _, pattern := range patterns {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUniqueViolation using the Default Database type
+func IsUniqueViolation(err error) bool {
+	return Default.IsUniqueViolation(err)
+}
+
 // DB is a generic database interface, matching both *sql.Db and *sql.Tx
 type DB interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
@@ -32,16 +84,122 @@ type DB interface {
 	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
+// exec runs a statement through db, giving the RewriteSQL hook
+// a chance to alter it first and wrapping the call in QueryWrapper.
+// All statements issued by meddler go through exec, query, or
+// queryRowScan. The op argument names the operation for QueryWrapper.
+// Under a context set with WithContext, statements are run with the
+// context methods of db where it has them.
+func (d *Database) exec(db DB, op, query string, args ...interface{}) (sql.Result, error) {
+	query = d.rewrite(query)
+	var result sql.Result
+	err := d.wrap(d.Context(), op, query, func() (err error) {
+		if ec, ok := db.(execerContext); ok && d.ctx != nil {
+			result, err = ec.ExecContext(d.ctx, query, args...)
+		} else {
+			result, err = db.Exec(query, args...)
+		}
+		return err
+	})
+	if err == nil && result != nil {
+		if n, err := result.RowsAffected(); err == nil {
+			atomic.AddInt64(&rowsWritten, n)
+		}
+	}
+	return result, err
+}
+
+func (d *Database) query(db DB, op, query string, args ...interface{}) (*sql.Rows, error) {
+	if qc, ok := db.(QueryerContext); ok && d.ctx != nil {
+		return d.queryContext(d.ctx, qc, op, query, args...)
+	}
+	query = d.rewrite(query)
+	var rows *sql.Rows
+	err := d.wrap(d.Context(), op, query, func() (err error) {
+		rows, err = db.Query(query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryerContext can run queries under a context; *sql.DB, *sql.Tx and
+// *sql.Conn are ones.
+type QueryerContext interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// execerContext and queryRowerContext are the other context methods of
+// *sql.DB, *sql.Tx and *sql.Conn.
+type execerContext interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type queryRowerContext interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// queryContext is like query, but runs the query under ctx.
+func (d *Database) queryContext(ctx context.Context, db QueryerContext, op, query string, args ...interface{}) (*sql.Rows, error) {
+	query = d.rewrite(query)
+	var rows *sql.Rows
+	err := d.wrap(ctx, op, query, func() (err error) {
+		rows, err = db.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// queryRowScan runs a query returning a single row and scans it into
+// dest, so that errors from the query itself are seen by QueryWrapper.
+func (d *Database) queryRowScan(db DB, op, query string, args []interface{}, dest ...interface{}) error {
+	query = d.rewrite(query)
+	return d.wrap(d.Context(), op, query, func() error {
+		if qc, ok := db.(queryRowerContext); ok && d.ctx != nil {
+			return qc.QueryRowContext(d.ctx, query, args...).Scan(dest...)
+		}
+		return db.QueryRow(query, args...).Scan(dest...)
+	})
+}
+
+func (d *Database) wrap(ctx context.Context, op, query string, fn func() error) error {
+	if d.MaxQueryLength > 0 && len(query) > d.MaxQueryLength {
+		return fmt.Errorf("meddler.%s: statement of %d bytes is longer than MaxQueryLength (%d), split the records into smaller chunks", op, len(query), d.MaxQueryLength)
+	}
+	if d.QueryWrapper == nil {
+		return fn()
+	}
+	return d.QueryWrapper(ctx, op, query, fn)
+}
+
+func (d *Database) rewrite(query string) string {
+	if d.RewriteSQL == nil {
+		return query
+	}
+	return d.RewriteSQL(query)
+}
+
 // Load loads a record using a query for the primary key field.
 // Returns sql.ErrNoRows if not found.
 func (d *Database) Load(db DB, table string, dst interface{}, pk int64) error {
+	data, err := d.getFields(reflect.TypeOf(dst))
+	if err != nil {
+		return err
+	}
+	if err := data.integerKey("Load"); err != nil {
+		return err
+	}
+	return d.load(db, table, dst, pk)
+}
+
+// load is Load for primary keys of any type.
+func (d *Database) load(db DB, table string, dst interface{}, pk interface{}) error {
 	columns, err := d.ColumnsQuoted(dst, true)
 	if err != nil {
 		return err
 	}
 
 	// make sure we have a primary key field
-	pkName, _, err := d.PrimaryKey(dst)
+	pkName, _, _, err := d.primaryKeyValue(dst)
 	if err != nil {
 		return err
 	}
@@ -50,9 +208,9 @@ func (d *Database) Load(db DB, table string, dst interface{}, pk int64) error {
 	}
 
 	// run the query
-	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", columns, d.quoted(table), d.quoted(pkName), d.Placeholder)
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", columns, d.quoted(table), d.quoted(pkName), d.placeholder(1, d.goTypeKind(nil, dst, pkName)))
 
-	rows, err := db.Query(q, pk)
+	rows, err := d.query(db, "Load", q, pk)
 	if err != nil {
 		return &dbErr{msg: "meddler.Load: DB error in Query", err: err}
 	}
@@ -66,182 +224,2542 @@ func Load(db DB, table string, dst interface{}, pk int64) error {
 	return Default.Load(db, table, dst, pk)
 }
 
-// Insert performs an INSERT query for the given record.
-// If the record has a primary key flagged, it must be zero, and it
-// will be set to the newly-allocated primary key value from the database
-// as returned by LastInsertId.
-func (d *Database) Insert(db DB, table string, src interface{}) error {
-	pkName, pkValue, err := d.PrimaryKey(src)
+// LoadWithRelations loads a record like Load, and then fills in each of
+// its slice fields tagged with the hasmany option with the rows that
+// refer to it. The table of the related rows is given by the column name
+// of the field, and the option names the column of those rows that holds
+// the primary key of the record:
+//
+//	type Author struct {
+//		ID    int64   `meddler:"id,pk"`
+//		Books []*Book `meddler:"book,hasmany=author_id"`
+//	}
+//
+// The field may be a slice of structs or of pointers to structs; the
+// related rows are loaded with one query per field, ordered by their
+// primary key if they have one. A record without related rows gets an
+// empty slice.
+func (d *Database) LoadWithRelations(db DB, table string, dst interface{}, pk int64) error {
+	if err := d.Load(db, table, dst, pk); err != nil {
+		return err
+	}
+	data, err := d.getFields(reflect.TypeOf(dst))
 	if err != nil {
 		return err
 	}
-	if pkName != "" && pkValue != 0 {
-		return fmt.Errorf("meddler.Insert: primary key must be zero")
+
+	structVal := reflect.ValueOf(dst).Elem()
+	for _, rel := range data.hasMany {
+		sliceVal := fieldByIndex(structVal, rel.index, true)
+		eltType := sliceVal.Type().Elem()
+		ptrType := eltType
+		if ptrType.Kind() != reflect.Ptr {
+			ptrType = reflect.PtrTo(eltType)
+		}
+		related, err := d.getFields(ptrType)
+		if err != nil {
+			return err
+		}
+		if _, present := related.fields[rel.column]; !present {
+			return fmt.Errorf("meddler.LoadWithRelations: column [%s] not found in %v", rel.column, ptrType.Elem())
+		}
+		columns := d.quotedList(related.columns)
+
+		// run the query
+		q := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", columns, d.quoted(rel.table), d.quoted(rel.column), d.argPlaceholder(1, pk))
+		if related.pk != "" {
+			q += " ORDER BY " + d.quoted(related.pk)
+		}
+		records := reflect.New(reflect.SliceOf(ptrType))
+		if err := d.QueryAll(db, records.Interface(), q, pk); err != nil {
+			return err
+		}
+
+		// store them in the field
+		result := reflect.MakeSlice(sliceVal.Type(), 0, records.Elem().Len())
+		for i := 0; i < records.Elem().Len(); i++ {
+			record := records.Elem().Index(i)
+			if eltType.Kind() != reflect.Ptr {
+				record = record.Elem()
+			}
+			result = reflect.Append(result, record)
+		}
+		sliceVal.Set(result)
+	}
+
+	return nil
+}
+
+// LoadWithRelations using the Default Database type
+func LoadWithRelations(db DB, table string, dst interface{}, pk int64) error {
+	return Default.LoadWithRelations(db, table, dst, pk)
+}
+
+// LoadOK is like Load, but a missing record is not an error. It reports
+// whether the record was found, and only returns an error if something
+// else went wrong.
+func (d *Database) LoadOK(db DB, table string, dst interface{}, pk int64) (found bool, err error) {
+	err = d.Load(db, table, dst, pk)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	// gather the query parts
-	namesPart, err := d.ColumnsQuoted(src, false)
+// LoadOK using the Default Database type
+func LoadOK(db DB, table string, dst interface{}, pk int64) (found bool, err error) {
+	return Default.LoadOK(db, table, dst, pk)
+}
+
+// LoadExcept is like Load, but it does not read the columns named in
+// exclude, for example to avoid fetching large blobs. The fields of the
+// excluded columns are left untouched, so they are zero in a new dst.
+// Every excluded column must be mapped to a field of dst.
+func (d *Database) LoadExcept(db DB, table string, dst interface{}, pk int64, exclude ...string) error {
+	columns, err := d.ColumnsExcept(dst, exclude...)
 	if err != nil {
 		return err
 	}
-	valuesPart, err := d.PlaceholdersString(src, false)
+
+	// make sure we have a primary key field
+	pkName, _, _, err := d.primaryKeyValue(dst)
 	if err != nil {
 		return err
 	}
-	values, err := d.Values(src, false)
+	if pkName == "" {
+		return fmt.Errorf("meddler.LoadExcept: no primary key field found")
+	}
+	data, err := d.getFields(reflect.TypeOf(dst))
 	if err != nil {
 		return err
 	}
+	if err := data.integerKey("LoadExcept"); err != nil {
+		return err
+	}
 
 	// run the query
-	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", d.quoted(table), namesPart, valuesPart)
-	if d.UseReturningToGetID && pkName != "" {
-		q += " RETURNING " + d.quoted(pkName)
-		var newPk int64
-		err := db.QueryRow(q, values...).Scan(&newPk)
-		if err != nil {
-			return &dbErr{msg: "meddler.Insert: DB error in QueryRow", err: err}
-		}
-		if err = d.SetPrimaryKey(src, newPk); err != nil {
-			return fmt.Errorf("meddler.Insert: Error saving updated pk: %v", err)
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", d.quotedList(columns), d.quoted(table), d.quoted(pkName),
+		d.placeholder(1, d.goTypeKind(nil, dst, pkName)))
+
+	rows, err := d.query(db, "LoadExcept", q, pk)
+	if err != nil {
+		return &dbErr{msg: "meddler.LoadExcept: DB error in Query", err: err}
+	}
+
+	// scan the row
+	return d.ScanRow(rows, dst)
+}
+
+// LoadExcept using the Default Database type
+func LoadExcept(db DB, table string, dst interface{}, pk int64, exclude ...string) error {
+	return Default.LoadExcept(db, table, dst, pk, exclude...)
+}
+
+// LoadOrdered loads the records with the given primary keys in a single
+// query. dst must be a pointer to a slice of pointers to structs; it is
+// set to a slice with one element for each of the pks, in the same order,
+// holding nil for keys that were not found.
+func (d *Database) LoadOrdered(db DB, table string, pks []int64, dst interface{}) error {
+	dstType := reflect.TypeOf(dst)
+	if dstType.Kind() != reflect.Ptr || dstType.Elem().Kind() != reflect.Slice || dstType.Elem().Elem().Kind() != reflect.Ptr {
+		return fmt.Errorf("meddler.LoadOrdered: dst must be a pointer to a slice of pointers, found %T", dst)
+	}
+	sliceType := dstType.Elem()
+	data, err := d.getFields(sliceType.Elem())
+	if err != nil {
+		return err
+	}
+	if data.pk == "" {
+		return fmt.Errorf("meddler.LoadOrdered: no primary key field found")
+	}
+	if err := data.integerKey("LoadOrdered"); err != nil {
+		return err
+	}
+
+	// run the query, unless there is nothing to look for
+	found := reflect.New(sliceType)
+	if len(pks) > 0 {
+		var placeholders []string
+		var args []interface{}
+		for i, pk := range pks {
+			placeholders = append(placeholders, d.argPlaceholder(i+1, pk))
+			args = append(args, pk)
 		}
-	} else if pkName != "" {
-		result, err := db.Exec(q, values...)
+		q := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s)", d.quotedList(data.columns), d.quoted(table), d.quoted(data.pk), strings.Join(placeholders, ","))
+		rows, err := d.query(db, "LoadOrdered", q, args...)
 		if err != nil {
-			return &dbErr{msg: "meddler.Insert: DB error in Exec", err: err}
+			return &dbErr{msg: "meddler.LoadOrdered: DB error in Query", err: err}
 		}
+		if err := d.ScanAll(rows, found.Interface()); err != nil {
+			return err
+		}
+	}
 
-		// save the new primary key
-		newPk, err := result.LastInsertId()
+	// put the records in the order of pks
+	byPk := make(map[int64]reflect.Value)
+	for i := 0; i < found.Elem().Len(); i++ {
+		elt := found.Elem().Index(i)
+		_, pk, err := d.PrimaryKey(elt.Interface())
 		if err != nil {
-			return &dbErr{msg: "meddler.Insert: DB error getting new primary key value", err: err}
-		}
-		if err = d.SetPrimaryKey(src, newPk); err != nil {
-			return fmt.Errorf("meddler.Insert: Error saving updated pk: %v", err)
+			return err
 		}
-	} else {
-		// no primary key, so no need to lookup new value
-		_, err := db.Exec(q, values...)
-		if err != nil {
-			return &dbErr{msg: "meddler.Insert: DB error in Exec", err: err}
+		byPk[pk] = elt
+	}
+	result := reflect.MakeSlice(sliceType, len(pks), len(pks))
+	for i, pk := range pks {
+		if elt, ok := byPk[pk]; ok {
+			result.Index(i).Set(elt)
 		}
 	}
+	reflect.ValueOf(dst).Elem().Set(result)
 
 	return nil
 }
 
-// Insert using the Default Database type
-func Insert(db DB, table string, src interface{}) error {
-	return Default.Insert(db, table, src)
+// LoadOrdered using the Default Database type
+func LoadOrdered(db DB, table string, pks []int64, dst interface{}) error {
+	return Default.LoadOrdered(db, table, pks, dst)
 }
 
-// Update performs and UPDATE query for the given record.
-// The record must have an integer primary key field that is non-zero,
-// and it will be used to select the database row that gets updated.
-func (d *Database) Update(db DB, table string, src interface{}) error {
-	// gather the query parts
-	names, err := d.Columns(src, false)
+// ExistsMany checks which of the given primary keys exist in a table,
+// using a single query. model is a pointer to a struct of the type stored
+// in the table, and is only used to find the primary key column. The
+// result holds an entry for each of the pks, which is true if it exists.
+func (d *Database) ExistsMany(db DB, table string, pks []int64, model interface{}) (map[int64]bool, error) {
+	data, err := d.getFields(reflect.TypeOf(model))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if data.pk == "" {
+		return nil, fmt.Errorf("meddler.ExistsMany: no primary key field found")
+	}
+	if err := data.integerKey("ExistsMany"); err != nil {
+		return nil, err
+	}
+
+	exists := make(map[int64]bool)
+	if len(pks) == 0 {
+		return exists, nil
+	}
+	var placeholders []string
+	var args []interface{}
+	for i, pk := range pks {
+		exists[pk] = false
+		placeholders = append(placeholders, d.argPlaceholder(i+1, pk))
+		args = append(args, pk)
 	}
-	placeholders, err := d.Placeholders(src, false)
+
+	// run the query
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s)", d.quoted(data.pk), d.quoted(table), d.quoted(data.pk), strings.Join(placeholders, ","))
+	rows, err := d.query(db, "ExistsMany", q, args...)
 	if err != nil {
-		return err
+		return nil, &dbErr{msg: "meddler.ExistsMany: DB error in Query", err: err}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pk int64
+		if err := rows.Scan(&pk); err != nil {
+			return nil, &dbErr{msg: "meddler.ExistsMany: DB error in Scan", err: err}
+		}
+		exists[pk] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &dbErr{msg: "meddler.ExistsMany: DB error reading rows", err: err}
 	}
-	values, err := d.Values(src, false)
+
+	return exists, nil
+}
+
+// ExistsMany using the Default Database type
+func ExistsMany(db DB, table string, pks []int64, model interface{}) (map[int64]bool, error) {
+	return Default.ExistsMany(db, table, pks, model)
+}
+
+// RefreshColumns re-reads the named columns of an existing record,
+// selected by its primary key, and stores them in dst. Fields not
+// named in columns are left untouched. Every column must be mapped
+// to a field of dst.
+func (d *Database) RefreshColumns(db DB, table string, dst interface{}, columns ...string) error {
+	data, err := d.getFields(reflect.TypeOf(dst))
 	if err != nil {
 		return err
 	}
+	if len(columns) == 0 {
+		return fmt.Errorf("meddler.RefreshColumns: no columns given")
+	}
 
-	// form the column=placeholder pairs
-	var pairs []string
-	for i := 0; i < len(names) && i < len(placeholders); i++ {
-		pair := fmt.Sprintf("%s=%s", d.quoted(names[i]), placeholders[i])
-		pairs = append(pairs, pair)
+	var parts []string
+	for _, name := range columns {
+		if _, present := data.fields[name]; !present {
+			return fmt.Errorf("meddler.RefreshColumns: column [%s] not found in struct", name)
+		}
+		parts = append(parts, d.quoted(name))
 	}
 
-	pkName, pkValue, err := d.PrimaryKey(src)
+	// make sure we have a primary key field
+	pkName, pkValue, _, err := d.primaryKeyValue(dst)
 	if err != nil {
 		return err
 	}
 	if pkName == "" {
-		return fmt.Errorf("meddler.Update: no primary key field")
-	}
-	if pkValue < 1 {
-		return fmt.Errorf("meddler.Update: primary key must be an integer > 0")
+		return fmt.Errorf("meddler.RefreshColumns: no primary key field found")
 	}
-	ph := d.placeholder(len(placeholders)+1, d.goTypeKind(nil, src, pkName))
+	ph := d.placeholder(1, d.goTypeKind(data, dst, pkName))
 
 	// run the query
-	q := fmt.Sprintf("UPDATE %s SET %s WHERE %s=%s", d.quoted(table),
-		strings.Join(pairs, ","),
-		d.quoted(pkName), ph)
-	values = append(values, pkValue)
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", strings.Join(parts, ","), d.quoted(table), d.quoted(pkName), ph)
 
-	if _, err := db.Exec(q, values...); err != nil {
-		return &dbErr{msg: "meddler.Update: DB error in Exec", err: err}
+	rows, err := d.query(db, "RefreshColumns", q, pkValue)
+	if err != nil {
+		return &dbErr{msg: "meddler.RefreshColumns: DB error in Query", err: err}
 	}
 
+	// scan the row
+	return d.ScanRow(rows, dst)
+}
+
+// RefreshColumns using the Default Database type
+func RefreshColumns(db DB, table string, dst interface{}, columns ...string) error {
+	return Default.RefreshColumns(db, table, dst, columns...)
+}
+
+// Validator is implemented by records that check their own contents.
+// Insert, Update, and Save call Validate before issuing any query, and
+// return its error unchanged if it fails.
+type Validator interface {
+	Validate() error
+}
+
+func validate(src interface{}) error {
+	if v, ok := src.(Validator); ok {
+		return v.Validate()
+	}
 	return nil
 }
 
-// Update using the Default Database type
-func Update(db DB, table string, src interface{}) error {
-	return Default.Update(db, table, src)
+// Insert performs an INSERT query for the given record.
+// If the record has a primary key flagged, it must be zero, and it
+// will be set to the newly-allocated primary key value from the database
+// as returned by LastInsertId, unless PKGenerator is set, in which case
+// it is set from PKGenerator before the insert. Generated columns are not
+// written; where RETURNING is used to get the new primary key, they are
+// read back too.
+// If ReloadAfterInsert is set, the whole row is read back into the record
+// after it has been inserted, using RETURNING where available and a
+// second query by primary key otherwise.
+func (d *Database) Insert(db DB, table string, src interface{}) error {
+	_, err := d.insertNew(db, table, src, "")
+	return err
 }
 
-// Save performs an INSERT or an UPDATE, depending on whether or not
-// a primary keys exists and is non-zero.
-func (d *Database) Save(db DB, table string, src interface{}) error {
-	pkName, pkValue, err := d.PrimaryKey(src)
+// insertNew checks a new record and gives it a primary key from
+// PKGenerator, if set, before inserting it as insert does.
+func (d *Database) insertNew(db DB, table string, src interface{}, suffix string) (bool, error) {
+	if err := validate(src); err != nil {
+		return false, err
+	}
+
+	pkName, _, pkSet, err := d.primaryKeyValue(src)
 	if err != nil {
-		return err
+		return false, err
 	}
-	if pkName != "" && pkValue != 0 {
-		return d.Update(db, table, src)
-	} else {
-		return d.Insert(db, table, src)
+	if pkName != "" && pkSet {
+		return false, fmt.Errorf("meddler.Insert: primary key must be zero")
+	}
+	if pkName != "" && d.PKGenerator != nil {
+		if err := d.generatePrimaryKey(src, pkName); err != nil {
+			return false, err
+		}
 	}
-}
 
-// Save using the Default Database type
-func Save(db DB, table string, src interface{}) error {
-	return Default.Save(db, table, src)
+	return d.insert(db, table, src, "INSERT", suffix)
 }
 
-// QueryOne performs the given query with the given arguments, scanning a
-// single row of results into dst. Returns sql.ErrNoRows if there was no
-// result row.
-func (d *Database) QueryRow(db DB, dst interface{}, query string, args ...interface{}) error {
-	// perform the query
-	rows, err := db.Query(query, args...)
+// generatePrimaryKey stores a new primary key from PKGenerator in src.
+func (d *Database) generatePrimaryKey(src interface{}, pkName string) error {
+	data, err := d.getFields(reflect.TypeOf(src))
 	if err != nil {
 		return err
 	}
+	pk, err := d.PKGenerator(src)
+	if err != nil {
+		return fmt.Errorf("meddler.Insert: PKGenerator error: %v", err)
+	}
+	field := fieldByIndex(reflect.ValueOf(src).Elem(), data.fields[pkName].index, true)
+	val := reflect.ValueOf(pk)
+	switch {
+	case pk == nil:
+		return fmt.Errorf("meddler.Insert: PKGenerator returned nil")
+	case val.Type().AssignableTo(field.Type()):
+	case sameKindConvertible(val.Type(), field.Type()):
+		val = val.Convert(field.Type())
+	default:
+		return fmt.Errorf("meddler.Insert: PKGenerator returned %T, which cannot be stored in a primary key of type %s", pk, field.Type())
+	}
+	if val.IsZero() {
+		return fmt.Errorf("meddler.Insert: PKGenerator returned a zero primary key")
+	}
+	field.Set(val)
+	return nil
+}
+
+// InsertIdempotent inserts a record as Insert does, but treats a row
+// that already has the value of keyColumn, which holds an idempotency key
+// supplied with the record, as a sign that the record was inserted
+// before. inserted is then false and no error is returned. PostgreSQL and
+// SQLite skip such a row with ON CONFLICT on keyColumn, which needs a
+// unique index on it. Other databases report a unique violation, and it
+// is taken to be a repeat if a row with the key exists; other unique
+// violations are returned as errors.
+func (d *Database) InsertIdempotent(db DB, table, keyColumn string, src interface{}) (inserted bool, err error) {
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return false, err
+	}
+	if _, present := data.fields[keyColumn]; !present {
+		return false, fmt.Errorf("meddler.InsertIdempotent: key column [%s] not found in struct", keyColumn)
+	}
 
-	// gather the result
-	return d.ScanRow(rows, dst)
+	switch d.Name {
+	case "postgres", "sqlite":
+		return d.insertNew(db, table, src, fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", d.quoted(keyColumn)))
+	}
+
+	err = d.Insert(db, table, src)
+	if err == nil {
+		return true, nil
+	}
+	if !d.IsUniqueViolation(err) {
+		return false, err
+	}
+	values, verr := d.SomeValues(src, []string{keyColumn})
+	if verr != nil {
+		return false, verr
+	}
+	q := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = %s", d.quoted(table), d.quoted(keyColumn), d.writePlaceholders(data, src, []string{keyColumn}, 1)[0])
+	var count int64
+	if verr := d.queryRowScan(db, "InsertIdempotent", q, values, &count); verr != nil {
+		return false, &dbErr{msg: "meddler.InsertIdempotent: DB error in QueryRow", err: verr}
+	}
+	if count > 0 {
+		return false, nil
+	}
+	return false, err
 }
 
-// QueryRow using the Default Database type
-func QueryRow(db DB, dst interface{}, query string, args ...interface{}) error {
-	return Default.QueryRow(db, dst, query, args...)
+// InsertIdempotent using the Default Database type
+func InsertIdempotent(db DB, table, keyColumn string, src interface{}) (inserted bool, err error) {
+	return Default.InsertIdempotent(db, table, keyColumn, src)
 }
 
-// QueryAll performs the given query with the given arguments, scanning
-// all results rows into dst.
-func (d *Database) QueryAll(db DB, dst interface{}, query string, args ...interface{}) error {
-	// perform the query
-	rows, err := db.Query(query, args...)
+// insert runs the INSERT query for Insert and SaveWith, starting the
+// statement with verb and adding suffix to it. A non-zero primary key is
+// inserted as it is. If verb is not plain INSERT, or suffix is given, the
+// database may decide not to insert the record, which is not an error;
+// inserted is then false.
+func (d *Database) insert(db DB, table string, src interface{}, verb, suffix string) (inserted bool, err error) {
+	conditional := verb != "INSERT" || suffix != ""
+
+	pkName, pkValue, pkSet, err := d.primaryKeyValue(src)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// gather the results
-	return d.ScanAll(rows, dst)
+	// gather the query parts
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return false, err
+	}
+	names := data.writeColumns(pkSet)
+	placeholders := d.writePlaceholders(data, src, names, 1)
+	values, err := d.SomeValues(src, names)
+	if err != nil {
+		return false, err
+	}
+
+	// run the query
+	q := fmt.Sprintf("%s INTO %s (%s) VALUES (%s)%s", verb, d.quoted(table), d.quotedList(names), strings.Join(placeholders, ","), suffix)
+	if d.UseReturningToGetID && pkName != "" {
+		// get the new primary key back, along with the generated columns
+		// or the whole row
+		columns := append([]string{pkName}, data.generatedColumns()...)
+		if d.ReloadAfterInsert {
+			columns = data.columns
+		}
+		q += " RETURNING " + d.quotedList(columns)
+		targets, err := d.Targets(src, columns)
+		if err != nil {
+			return false, err
+		}
+		if err := d.queryRowScan(db, "Insert", q, values, targets...); err != nil {
+			if err == sql.ErrNoRows && conditional {
+				// nothing was inserted
+				return false, nil
+			}
+			return false, &dbErr{msg: "meddler.Insert: DB error in QueryRow", err: err}
+		}
+		atomic.AddInt64(&rowsWritten, 1)
+		if err := d.WriteTargets(src, columns, targets); err != nil {
+			return false, fmt.Errorf("meddler.Insert: Error saving returned values: %v", err)
+		}
+	} else if pkName != "" {
+		if !pkSet && !isIntegerKind(data.fields[pkName].kind) {
+			return false, fmt.Errorf("meddler.Insert: a primary key of type %T can only be read back with UseReturningToGetID", pkValue)
+		}
+		result, err := d.exec(db, "Insert", q, values...)
+		if err != nil {
+			return false, &dbErr{msg: "meddler.Insert: DB error in Exec", err: err}
+		}
+		if conditional {
+			n, err := result.RowsAffected()
+			if err != nil {
+				return false, &dbErr{msg: "meddler.Insert: DB error getting rows affected", err: err}
+			}
+			if n == 0 {
+				// nothing was inserted
+				return false, nil
+			}
+		}
+
+		// save the new primary key
+		if !pkSet {
+			newPk, err := result.LastInsertId()
+			if err != nil {
+				return false, &dbErr{msg: "meddler.Insert: DB error getting new primary key value", err: err}
+			}
+			if err = d.SetPrimaryKey(src, newPk); err != nil {
+				return false, fmt.Errorf("meddler.Insert: Error saving updated pk: %v", err)
+			}
+			pkValue = newPk
+		}
+
+		if d.ReloadAfterInsert {
+			// read back the values filled in by the database
+			if err := d.load(db, table, src, pkValue); err != nil {
+				return false, err
+			}
+		}
+	} else {
+		// no primary key, so no need to lookup new value
+		result, err := d.exec(db, "Insert", q, values...)
+		if err != nil {
+			return false, &dbErr{msg: "meddler.Insert: DB error in Exec", err: err}
+		}
+		if conditional {
+			n, err := result.RowsAffected()
+			if err != nil {
+				return false, &dbErr{msg: "meddler.Insert: DB error getting rows affected", err: err}
+			}
+			if n == 0 {
+				// nothing was inserted
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
 }
 
-// QueryAll using the Default Database type
-func QueryAll(db DB, dst interface{}, query string, args ...interface{}) error {
-	return Default.QueryAll(db, dst, query, args...)
+// Insert using the Default Database type
+func Insert(db DB, table string, src interface{}) error {
+	return Default.Insert(db, table, src)
+}
+
+// Update performs and UPDATE query for the given record.
+// The record must have a primary key field that is non-zero (and
+// positive, for an integer key), and it will be used to select the
+// database row that gets updated.
+func (d *Database) Update(db DB, table string, src interface{}) error {
+	return d.update(db, "Update", table, src, nil)
+}
+
+// Update using the Default Database type
+func Update(db DB, table string, src interface{}) error {
+	return Default.Update(db, table, src)
+}
+
+// UpdateReturning updates a record like Update, and then reads back the
+// given columns of the updated row, such as columns maintained by
+// triggers, storing them in src. If no columns are given, the generated
+// columns are read back. PostgreSQL and SQLite do this in a single UPDATE
+// ... RETURNING statement; other databases use a separate query, as
+// RefreshColumns does. Update itself never pays for the extra columns.
+// Unlike Update, which does not notice, it returns sql.ErrNoRows if there
+// is no row with the primary key of src, as there is nothing to read back.
+func (d *Database) UpdateReturning(db DB, table string, src interface{}, columns ...string) error {
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		columns = data.generatedColumns()
+		if len(columns) == 0 {
+			return fmt.Errorf("meddler.UpdateReturning: no columns given and no generated columns found")
+		}
+	}
+	for _, name := range columns {
+		if _, present := data.fields[name]; !present {
+			return fmt.Errorf("meddler.UpdateReturning: column [%s] not found in struct", name)
+		}
+	}
+	if d.Name != "postgres" && d.Name != "sqlite" {
+		if err := d.update(db, "UpdateReturning", table, src, nil); err != nil {
+			return err
+		}
+		return d.RefreshColumns(db, table, src, columns...)
+	}
+	return d.update(db, "UpdateReturning", table, src, columns)
+}
+
+// UpdateReturning using the Default Database type
+func UpdateReturning(db DB, table string, src interface{}, columns ...string) error {
+	return Default.UpdateReturning(db, table, src, columns...)
+}
+
+// update runs the UPDATE statement for Update and UpdateReturning,
+// reading back the returning columns if any are given.
+func (d *Database) update(db DB, op, table string, src interface{}, returning []string) error {
+	if err := validate(src); err != nil {
+		return err
+	}
+
+	// gather the query parts
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return err
+	}
+	names := data.writeColumns(false)
+	placeholders := d.writePlaceholders(data, src, names, 1)
+	values, err := d.SomeValues(src, names)
+	if err != nil {
+		return err
+	}
+
+	// form the column=placeholder pairs
+	var pairs []string
+	for i := 0; i < len(names) && i < len(placeholders); i++ {
+		pair := fmt.Sprintf("%s=%s", d.quoted(names[i]), placeholders[i])
+		pairs = append(pairs, pair)
+	}
+
+	pkName, pkValue, pkSet, err := d.primaryKeyValue(src)
+	if err != nil {
+		return err
+	}
+	if pkName == "" {
+		return fmt.Errorf("meddler.%s: no primary key field", op)
+	}
+	if !pkSet {
+		return fmt.Errorf("meddler.%s: primary key must be set", op)
+	}
+	if v := reflect.ValueOf(pkValue); v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64 && v.Int() < 0 {
+		return fmt.Errorf("meddler.%s: primary key must be an integer > 0", op)
+	}
+	if len(pairs) == 0 {
+		if d.SkipEmptyUpdates {
+			return nil
+		}
+		return fmt.Errorf("meddler.%s: no columns to update besides the primary key", op)
+	}
+	ph := d.placeholder(len(placeholders)+1, d.goTypeKind(data, src, pkName))
+
+	// run the query
+	q := fmt.Sprintf("UPDATE %s SET %s WHERE %s=%s", d.quoted(table),
+		strings.Join(pairs, ","),
+		d.quoted(pkName), ph)
+	values = append(values, pkValue)
+
+	if returning != nil {
+		q += " RETURNING " + d.quotedList(returning)
+		targets, err := d.Targets(src, returning)
+		if err != nil {
+			return err
+		}
+		if err := d.queryRowScan(db, op, q, values, targets...); err != nil {
+			if err == sql.ErrNoRows {
+				return err
+			}
+			return &dbErr{msg: "meddler." + op + ": DB error in QueryRow", err: err}
+		}
+		atomic.AddInt64(&rowsWritten, 1)
+		if err := d.WriteTargets(src, returning, targets); err != nil {
+			return fmt.Errorf("meddler.%s: Error saving returned values: %v", op, err)
+		}
+		return nil
+	}
+	if _, err := d.exec(db, op, q, values...); err != nil {
+		return &dbErr{msg: "meddler." + op + ": DB error in Exec", err: err}
+	}
+
+	return nil
+}
+
+// Save performs an INSERT or an UPDATE, depending on whether or not
+// a primary keys exists and is non-zero. For keys other than integers,
+// such as strings, the zero value is the empty one, so a record with an
+// empty string key is inserted. Records with fields marked as
+// the natural key are always upserted on those columns instead, see
+// Upsert; these fields must not be zero.
+func (d *Database) Save(db DB, table string, src interface{}) error {
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return err
+	}
+	if data.natural != nil {
+		structVal := reflect.ValueOf(src).Elem()
+		for _, name := range data.natural {
+			if fieldByIndex(structVal, data.fields[name].index, true).IsZero() {
+				return fmt.Errorf("meddler.Save: natural key column [%s] must not be zero", name)
+			}
+		}
+		return d.Upsert(db, table, src, data.natural...)
+	}
+
+	pkName, _, pkSet, err := d.primaryKeyValue(src)
+	if err != nil {
+		return err
+	}
+	if pkName != "" && pkSet {
+		return d.Update(db, table, src)
+	} else {
+		return d.Insert(db, table, src)
+	}
+}
+
+// Save using the Default Database type
+func Save(db DB, table string, src interface{}) error {
+	return Default.Save(db, table, src)
+}
+
+// SaveMode selects what SaveWith does with a record that may already
+// exist in the database.
+type SaveMode int
+
+const (
+	// SaveUpdate updates the record if it has a non-zero primary key, and
+	// inserts it otherwise, as Save does.
+	SaveUpdate SaveMode = iota
+
+	// SaveIgnore inserts the record including its primary key, if any,
+	// and silently does nothing if that conflicts with an existing row.
+	// It uses ON CONFLICT DO NOTHING with PostgreSQL and SQLite, and
+	// INSERT IGNORE with MySQL, which also ignores some other errors,
+	// such as values that do not fit their columns. Other databases are
+	// not supported. The record is left unchanged if it is not inserted.
+	SaveIgnore
+
+	// SaveFail inserts the record including its primary key, if any, and
+	// returns the database error if that conflicts with an existing row.
+	SaveFail
+)
+
+// SaveWith saves a record as selected by mode.
+func (d *Database) SaveWith(db DB, table string, src interface{}, mode SaveMode) error {
+	switch mode {
+	case SaveUpdate:
+		return d.Save(db, table, src)
+	case SaveIgnore, SaveFail:
+		if err := validate(src); err != nil {
+			return err
+		}
+		verb, suffix := "INSERT", ""
+		if mode == SaveIgnore {
+			switch d.Name {
+			case "postgres", "sqlite":
+				suffix = " ON CONFLICT DO NOTHING"
+			case "mysql":
+				verb = "INSERT IGNORE"
+			default:
+				return fmt.Errorf("meddler.SaveWith: SaveIgnore is not supported for %s", d.Name)
+			}
+		}
+		_, err := d.insert(db, table, src, verb, suffix)
+		return err
+	default:
+		return fmt.Errorf("meddler.SaveWith: unknown mode %d", mode)
+	}
+}
+
+// SaveWith using the Default Database type
+func SaveWith(db DB, table string, src interface{}, mode SaveMode) error {
+	return Default.SaveWith(db, table, src, mode)
+}
+
+// SaveIf calls Save only if cond returns true, and does nothing otherwise.
+func (d *Database) SaveIf(db DB, table string, src interface{}, cond func() bool) error {
+	if !cond() {
+		return nil
+	}
+	return d.Save(db, table, src)
+}
+
+// SaveIf using the Default Database type
+func SaveIf(db DB, table string, src interface{}, cond func() bool) error {
+	return Default.SaveIf(db, table, src, cond)
+}
+
+// SaveWithOutbox saves src as Save does, and then inserts event into
+// outboxTable, for the transactional outbox pattern. The two writes only
+// happen together if tx is a transaction; the caller commits it, or rolls
+// it back if either write fails. The event is not written if saving src
+// fails.
+func (d *Database) SaveWithOutbox(tx DB, table string, src interface{}, outboxTable string, event interface{}) error {
+	if err := d.Save(tx, table, src); err != nil {
+		return err
+	}
+	return d.Insert(tx, outboxTable, event)
+}
+
+// SaveWithOutbox using the Default Database type
+func SaveWithOutbox(tx DB, table string, src interface{}, outboxTable string, event interface{}) error {
+	return Default.SaveWithOutbox(tx, table, src, outboxTable, event)
+}
+
+// Upsert inserts a record, or updates the existing row instead if the
+// insert conflicts with it on the conflict columns, using INSERT ... ON
+// CONFLICT as understood by PostgreSQL and SQLite, or INSERT ... ON
+// DUPLICATE KEY UPDATE with MySQL, which ignores the conflict columns in
+// favor of whichever unique index the row conflicts with. All of the columns
+// except the conflict columns (and the primary key) are updated. If the
+// primary key is zero, it is left to the database, and it is set from the
+// inserted or updated row if the Database uses RETURNING.
+func (d *Database) Upsert(db DB, table string, src interface{}, conflict ...string) error {
+	return d.UpsertWhere(db, table, src, "", conflict...)
+}
+
+// Upsert using the Default Database type
+func Upsert(db DB, table string, src interface{}, conflict ...string) error {
+	return Default.Upsert(db, table, src, conflict...)
+}
+
+// UpsertWhere is like Upsert, but adds a predicate to the conflict target,
+// as needed to match a partial unique index, for example
+//
+//	db.UpsertWhere(tx, "account", acct, "active", "email")
+//
+// gives ON CONFLICT ("email") WHERE active. The predicate is inserted
+// into the query as it is, so it must be trusted SQL and never contain
+// values supplied by users.
+func (d *Database) UpsertWhere(db DB, table string, src interface{}, predicate string, conflict ...string) error {
+	if err := validate(src); err != nil {
+		return err
+	}
+
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return err
+	}
+	pkName, _, pkSet, err := d.primaryKeyValue(src)
+	if err != nil {
+		return err
+	}
+
+	// gather the query parts
+	names := data.writeColumns(pkSet)
+	placeholders := d.writePlaceholders(data, src, names, 1)
+	values, err := d.SomeValues(src, names)
+	if err != nil {
+		return err
+	}
+	q, err := d.upsertQuery("Upsert", table, data, names, "("+strings.Join(placeholders, ",")+")", predicate, conflict)
+	if err != nil {
+		return err
+	}
+
+	// run the query
+	if d.UseReturningToGetID && pkName != "" {
+		columns := append([]string{pkName}, data.generatedColumns()...)
+		q += " RETURNING " + d.quotedList(columns)
+		targets, err := d.Targets(src, columns)
+		if err != nil {
+			return err
+		}
+		if err := d.queryRowScan(db, "Upsert", q, values, targets...); err != nil {
+			return &dbErr{msg: "meddler.Upsert: DB error in QueryRow", err: err}
+		}
+		atomic.AddInt64(&rowsWritten, 1)
+		if err := d.WriteTargets(src, columns, targets); err != nil {
+			return fmt.Errorf("meddler.Upsert: Error saving returned values: %v", err)
+		}
+		return nil
+	}
+	if _, err := d.exec(db, "Upsert", q, values...); err != nil {
+		return &dbErr{msg: "meddler.Upsert: DB error in Exec", err: err}
+	}
+
+	return nil
+}
+
+// UpsertWhere using the Default Database type
+func UpsertWhere(db DB, table string, src interface{}, predicate string, conflict ...string) error {
+	return Default.UpsertWhere(db, table, src, predicate, conflict...)
+}
+
+// upsertQuery returns an upsert of the given rows of values into the
+// columns in names, using INSERT OR REPLACE if the Database has
+// UpsertReplace set.
+func (d *Database) upsertQuery(op, table string, data *structData, names []string, rows, predicate string, conflict []string) (string, error) {
+	onConflict, err := d.onConflict(op, data, names, predicate, conflict)
+	if err != nil {
+		return "", err
+	}
+	if d.UpsertReplace {
+		if predicate != "" {
+			return "", fmt.Errorf("meddler.%s: INSERT OR REPLACE does not support a predicate for the conflict columns", op)
+		}
+		return fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES %s", d.quoted(table), d.quotedList(names), rows), nil
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s", d.quoted(table), d.quotedList(names), rows, onConflict), nil
+}
+
+// onConflict returns the ON CONFLICT clause of an upsert writing the
+// given columns (ON DUPLICATE KEY UPDATE for MySQL), which updates all of
+// them except the conflict columns and the primary key.
+func (d *Database) onConflict(op string, data *structData, names []string, predicate string, conflict []string) (string, error) {
+	if len(conflict) == 0 {
+		return "", fmt.Errorf("meddler.%s: no conflict columns given", op)
+	}
+	target := make(map[string]bool)
+	for _, name := range conflict {
+		if _, present := data.fields[name]; !present {
+			return "", fmt.Errorf("meddler.%s: conflict column [%s] not found in struct", op, name)
+		}
+		target[name] = true
+	}
+
+	// MySQL finds the conflicting row through any unique index by itself
+	excluded := "EXCLUDED.%s"
+	if d.Name == "mysql" {
+		if predicate != "" {
+			return "", fmt.Errorf("meddler.%s: MySQL does not support a predicate for the conflict columns", op)
+		}
+		excluded = "VALUES(%s)"
+	}
+
+	var pairs []string
+	for _, name := range names {
+		if !target[name] && name != data.pk {
+			pairs = append(pairs, fmt.Sprintf("%s="+excluded, d.quoted(name), d.quoted(name)))
+		}
+	}
+	if len(pairs) == 0 {
+		// nothing to change, but the row must still be returned
+		pairs = append(pairs, fmt.Sprintf("%s="+excluded, d.quoted(conflict[0]), d.quoted(conflict[0])))
+	}
+	if d.Name == "mysql" {
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(pairs, ","), nil
+	}
+
+	clause := fmt.Sprintf(" ON CONFLICT (%s)", d.quotedList(conflict))
+	if predicate != "" {
+		clause += " WHERE " + predicate
+	}
+	return clause + " DO UPDATE SET " + strings.Join(pairs, ","), nil
+}
+
+// InsertMany inserts several records of the same type using a single
+// INSERT query with one row of values per record. src must be a slice of
+// pointers to structs (or a slice of structs). Fields that would be saved
+// as null by Insert, such as nil pointers or zero values of zeroisnull
+// fields, are null in exactly the rows they belong to.
+// Primary keys are left to the database if they are zero in all of the
+// records, and are inserted as given if they are non-zero in all of them.
+// New primary key values are not read back, so use Insert for records
+// whose new keys are needed.
+func (d *Database) InsertMany(db DB, table string, src interface{}) error {
+	return d.execMany(db, "InsertMany", table, src, false, nil)
+}
+
+// InsertMany using the Default Database type
+func InsertMany(db DB, table string, src interface{}) error {
+	return Default.InsertMany(db, table, src)
+}
+
+// UpsertMany is like InsertMany, but updates the existing rows of records
+// that conflict with them on the conflict columns, as Upsert does.
+// Records that do not fit into one statement under MaxParams are split
+// across several ones, so pass a transaction as db if they must be
+// written all or nothing; the same holds for InsertMany.
+func (d *Database) UpsertMany(db DB, table string, src interface{}, conflict ...string) error {
+	return d.execMany(db, "UpsertMany", table, src, true, conflict)
+}
+
+// UpsertMany using the Default Database type
+func UpsertMany(db DB, table string, src interface{}, conflict ...string) error {
+	return Default.UpsertMany(db, table, src, conflict...)
+}
+
+// execMany runs the statements of InsertMany and UpsertMany, splitting the
+// records into chunks small enough for MaxParams.
+func (d *Database) execMany(db DB, op, table string, src interface{}, upsert bool, conflict []string) error {
+	records, err := recordsOf(op, src)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	size := len(records)
+	if d.MaxParams > 0 {
+		pkName, _, pkSet, err := d.primaryKeyValue(records[0])
+		if err != nil {
+			return err
+		}
+		data, err := d.getFields(reflect.TypeOf(records[0]))
+		if err != nil {
+			return err
+		}
+		columns := data.writeColumns(pkName != "" && pkSet)
+		if perRecord := len(columns); perRecord > 0 && d.MaxParams/perRecord < size {
+			size = d.MaxParams / perRecord
+			if size == 0 {
+				size = 1
+			}
+		}
+	}
+
+	for start := 0; start < len(records); start += size {
+		end := start + size
+		if end > len(records) {
+			end = len(records)
+		}
+		q, values, _, err := d.insertManyQuery(op, table, records[start:end], upsert, conflict)
+		if err != nil {
+			return err
+		}
+
+		// run the query
+		if _, err := d.exec(db, op, q, values...); err != nil {
+			return &dbErr{msg: "meddler." + op + ": DB error in Exec", err: err}
+		}
+	}
+
+	return nil
+}
+
+// BuildInsertMany returns the query and arguments InsertMany would run
+// for the records in src, without running them, as a single statement
+// regardless of MaxParams. The query is empty if src has no records.
+func (d *Database) BuildInsertMany(table string, src interface{}) (string, []interface{}, error) {
+	q, values, _, err := d.insertManyQuery("InsertMany", table, src, false, nil)
+	return q, values, err
+}
+
+// BuildInsertMany using the Default Database type
+func BuildInsertMany(table string, src interface{}) (string, []interface{}, error) {
+	return Default.BuildInsertMany(table, src)
+}
+
+// BuildUpsert returns the query and arguments UpsertMany would run for the
+// records in src, without running them, as a single statement regardless
+// of MaxParams. The query is empty if src has no records.
+func (d *Database) BuildUpsert(table string, src interface{}, conflict ...string) (string, []interface{}, error) {
+	q, values, _, err := d.insertManyQuery("UpsertMany", table, src, true, conflict)
+	return q, values, err
+}
+
+// BuildUpsert using the Default Database type
+func BuildUpsert(table string, src interface{}, conflict ...string) (string, []interface{}, error) {
+	return Default.BuildUpsert(table, src, conflict...)
+}
+
+// UpsertResult tells what UpsertManyReturning did with a record.
+type UpsertResult struct {
+	ID       int64 // the primary key of the row
+	Inserted bool  // whether the row was inserted rather than updated
+}
+
+// UpsertManyReturning is like UpsertMany, but returns the primary key of
+// each row written, and whether it was inserted or updated, in the order
+// of the records. The primary keys are also set in the records. The rows
+// are matched to the records by the values of the conflict columns, since
+// RETURNING does not promise to keep the order of the VALUES. It uses
+// the xmax system column to tell inserted rows from updated ones, so it
+// works with PostgreSQL only.
+func (d *Database) UpsertManyReturning(db DB, table string, src interface{}, conflict ...string) ([]UpsertResult, error) {
+	q, values, records, err := d.insertManyQuery("UpsertManyReturning", table, src, true, conflict)
+	if err != nil || q == "" {
+		return nil, err
+	}
+	data, err := d.getFields(reflect.TypeOf(records[0]))
+	if err != nil {
+		return nil, err
+	}
+	pkName := data.pk
+	if pkName == "" {
+		return nil, fmt.Errorf("meddler.UpsertManyReturning: no primary key field")
+	}
+	if err := data.integerKey("UpsertManyReturning"); err != nil {
+		return nil, err
+	}
+	q += fmt.Sprintf(" RETURNING %s, (xmax = 0) AS inserted, %s", d.quoted(pkName), d.quotedList(conflict))
+
+	// find the records by their conflict columns
+	positions := make(map[string]int)
+	for i, record := range records {
+		key, err := d.conflictKey(record, conflict)
+		if err != nil {
+			return nil, err
+		}
+		positions[key] = i
+	}
+
+	// run the query
+	rows, err := d.query(db, "UpsertManyReturning", q, values...)
+	if err != nil {
+		return nil, &dbErr{msg: "meddler.UpsertManyReturning: DB error in Query", err: err}
+	}
+	defer rows.Close()
+
+	results := make([]UpsertResult, len(records))
+	found := make([]bool, len(records))
+	recordType := reflect.TypeOf(records[0]).Elem()
+	for rows.Next() {
+		var result UpsertResult
+		row := reflect.New(recordType).Interface()
+		targets, err := d.Targets(row, conflict)
+		if err != nil {
+			return nil, err
+		}
+		if err := rows.Scan(append([]interface{}{&result.ID, &result.Inserted}, targets...)...); err != nil {
+			return nil, &dbErr{msg: "meddler.UpsertManyReturning: DB error in Scan", err: err}
+		}
+		if err := d.WriteTargets(row, conflict, targets); err != nil {
+			return nil, err
+		}
+		key, err := d.conflictKey(row, conflict)
+		if err != nil {
+			return nil, err
+		}
+		i, present := positions[key]
+		if !present || found[i] {
+			return nil, fmt.Errorf("meddler.UpsertManyReturning: returned row with primary key %d does not match a record", result.ID)
+		}
+		results[i], found[i] = result, true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &dbErr{msg: "meddler.UpsertManyReturning: DB error in Next", err: err}
+	}
+	for i := range records {
+		if !found[i] {
+			return nil, fmt.Errorf("meddler.UpsertManyReturning: no row returned for record %d", i)
+		}
+	}
+	for i, result := range results {
+		if err := d.SetPrimaryKey(records[i], result.ID); err != nil {
+			return nil, fmt.Errorf("meddler.UpsertManyReturning: Error saving updated pk: %v", err)
+		}
+	}
+
+	return results, nil
+}
+
+// conflictKey returns a string identifying a record by the values it
+// writes to the conflict columns.
+func (d *Database) conflictKey(record interface{}, conflict []string) (string, error) {
+	values, err := d.SomeValues(record, conflict)
+	if err != nil {
+		return "", err
+	}
+	var key []byte
+	for _, value := range values {
+		key = appendValue(key, value)
+	}
+	return string(key), nil
+}
+
+// UpsertManyReturning using the Default Database type
+func UpsertManyReturning(db DB, table string, src interface{}, conflict ...string) ([]UpsertResult, error) {
+	return Default.UpsertManyReturning(db, table, src, conflict...)
+}
+
+// recordsOf returns pointers to the elements of a slice of records, which
+// must all have the same type. Nil records, and struct values that cannot
+// be written back, are errors.
+func recordsOf(op string, src interface{}) ([]interface{}, error) {
+	sliceVal := reflect.ValueOf(src)
+	if sliceVal.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("meddler.%s: src must be a slice, found %T", op, src)
+	}
+
+	var records []interface{}
+	for i := 0; i < sliceVal.Len(); i++ {
+		elt := sliceVal.Index(i)
+		if elt.Kind() == reflect.Interface {
+			elt = elt.Elem()
+		}
+		if elt.Kind() == reflect.Struct {
+			if !elt.CanAddr() {
+				return nil, fmt.Errorf("meddler.%s: record %d is a struct value that is not addressable; pass a pointer to it", op, i)
+			}
+			elt = elt.Addr()
+		}
+		if !elt.IsValid() || elt.Kind() == reflect.Ptr && elt.IsNil() {
+			return nil, fmt.Errorf("meddler.%s: record %d is nil", op, i)
+		}
+		if i > 0 && elt.Type() != reflect.TypeOf(records[0]) {
+			return nil, fmt.Errorf("meddler.%s: records must all have the same type, record %d is a %s", op, i, elt.Type())
+		}
+		records = append(records, elt.Interface())
+	}
+	return records, nil
+}
+
+// insertManyQuery builds an INSERT query with a row of values for each
+// record in src, adding an ON CONFLICT clause for the conflict columns if
+// upsert is set. It returns an empty query if there are no records.
+func (d *Database) insertManyQuery(op, table string, src interface{}, upsert bool, conflict []string) (string, []interface{}, []interface{}, error) {
+	records, err := recordsOf(op, src)
+	if err != nil || len(records) == 0 {
+		return "", nil, nil, err
+	}
+	pkName, _, includePk, err := d.primaryKeyValue(records[0])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	includePk = pkName != "" && includePk
+	data, err := d.getFields(reflect.TypeOf(records[0]))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	columns := data.writeColumns(includePk)
+
+	// gather the rows, numbering the placeholders across all of them
+	var rows []string
+	var values []interface{}
+	for i, record := range records {
+		if err := validate(record); err != nil {
+			return "", nil, nil, err
+		}
+		if pkName != "" {
+			_, _, pkSet, err := d.primaryKeyValue(record)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			if pkSet != includePk {
+				return "", nil, nil, fmt.Errorf("meddler.%s: primary keys must be all zero or all non-zero, record %d differs", op, i)
+			}
+		}
+		rowValues, err := d.SomeValues(record, columns)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		placeholders := d.writePlaceholders(data, record, columns, len(values)+1)
+		values = append(values, rowValues...)
+		rows = append(rows, "("+strings.Join(placeholders, ",")+")")
+	}
+
+	if upsert {
+		q, err := d.upsertQuery(op, table, data, columns, strings.Join(rows, ","), "", conflict)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return q, values, records, nil
+	}
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", d.quoted(table), d.quotedList(columns), strings.Join(rows, ","))
+	return q, values, records, nil
+}
+
+// InsertManyUnnest is like InsertMany, but is meant for PostgreSQL and
+// sends the values column by column, with one array parameter per column,
+// in a single INSERT ... SELECT * FROM unnest(...) query. The number of
+// parameters does not grow with the number of records, so much larger
+// batches fit under the parameter limit of the database. The arrays are
+// typed by the values after meddling, such as bigint[] or text[], so
+// columns of other types must accept assignments from these types.
+func (d *Database) InsertManyUnnest(db DB, table string, src interface{}) error {
+	records, err := recordsOf("InsertManyUnnest", src)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	pkName, _, includePk, err := d.primaryKeyValue(records[0])
+	if err != nil {
+		return err
+	}
+	includePk = pkName != "" && includePk
+	data, err := d.getFields(reflect.TypeOf(records[0]))
+	if err != nil {
+		return err
+	}
+	columns := data.writeColumns(includePk)
+
+	// gather the values of each column
+	values := make([][]interface{}, len(columns))
+	for i, record := range records {
+		if err := validate(record); err != nil {
+			return err
+		}
+		if pkName != "" {
+			_, _, pkSet, err := d.primaryKeyValue(record)
+			if err != nil {
+				return err
+			}
+			if pkSet != includePk {
+				return fmt.Errorf("meddler.InsertManyUnnest: primary keys must be all zero or all non-zero, record %d differs", i)
+			}
+		}
+		rowValues, err := d.SomeValues(record, columns)
+		if err != nil {
+			return err
+		}
+		for j, value := range rowValues {
+			if value, err = driver.DefaultParameterConverter.ConvertValue(value); err != nil {
+				return fmt.Errorf("meddler.InsertManyUnnest: column [%s]: %v", columns[j], err)
+			}
+			values[j] = append(values[j], value)
+		}
+	}
+
+	// encode one array per column
+	structType := reflect.TypeOf(records[0]).Elem()
+	var arrays []string
+	var args []interface{}
+	for j, name := range columns {
+		elemType, err := pgArrayType(values[j])
+		if err != nil {
+			return fmt.Errorf("meddler.InsertManyUnnest: column [%s]: %v", name, err)
+		}
+		if elemType == "" {
+			// all null, so go by the type of the field
+			elemType = "text"
+			if field := data.fields[name]; field.columns == nil {
+				elemType = pgColumnTypes[d.columnType(structType.FieldByIndex(field.index).Type, field.meddler)]
+			}
+		}
+		args = append(args, pgArrayLiteral(values[j]))
+		arrays = append(arrays, fmt.Sprintf("%s::%s[]", d.placeholder(len(args), ""), elemType))
+	}
+
+	// run the query
+	q := fmt.Sprintf("INSERT INTO %s (%s) SELECT * FROM unnest(%s)", d.quoted(table), d.quotedList(columns), strings.Join(arrays, ","))
+	if _, err := d.exec(db, "InsertManyUnnest", q, args...); err != nil {
+		return &dbErr{msg: "meddler.InsertManyUnnest: DB error in Exec", err: err}
+	}
+
+	return nil
+}
+
+// InsertManyUnnest using the Default Database type
+func InsertManyUnnest(db DB, table string, src interface{}) error {
+	return Default.InsertManyUnnest(db, table, src)
+}
+
+// pgColumnTypes maps the column types of columnType to the PostgreSQL
+// array element types used by InsertManyUnnest.
+var pgColumnTypes = map[string]string{
+	"BOOLEAN":          "boolean",
+	"INTEGER":          "bigint",
+	"DOUBLE PRECISION": "double precision",
+	"TIMESTAMP":        "timestamptz",
+	"BLOB":             "bytea",
+	"BYTEA":            "bytea",
+	"TEXT":             "text",
+}
+
+// pgArrayType returns the PostgreSQL type of the driver values of a
+// column, or "" if they are all null.
+func pgArrayType(values []interface{}) (string, error) {
+	elemType := ""
+	for _, value := range values {
+		var t string
+		switch value.(type) {
+		case nil:
+			continue
+		case int64:
+			t = "bigint"
+		case float64:
+			t = "double precision"
+		case bool:
+			t = "boolean"
+		case []byte:
+			t = "bytea"
+		case string:
+			t = "text"
+		case time.Time:
+			t = "timestamptz"
+		default:
+			return "", fmt.Errorf("unsupported value type %T", value)
+		}
+		if elemType != "" && t != elemType {
+			return "", fmt.Errorf("values of types %s and %s cannot be sent in one array", elemType, t)
+		}
+		elemType = t
+	}
+	return elemType, nil
+}
+
+// pgArrayLiteral returns the text form of a PostgreSQL array holding the
+// given driver values.
+func pgArrayLiteral(values []interface{}) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		var text string
+		switch v := value.(type) {
+		case nil:
+			b.WriteString("NULL")
+			continue
+		case int64:
+			text = strconv.FormatInt(v, 10)
+		case float64:
+			text = strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			text = strconv.FormatBool(v)
+		case []byte:
+			text = `\x` + hex.EncodeToString(v)
+		case string:
+			text = v
+		case time.Time:
+			text = v.Format(time.RFC3339Nano)
+		}
+
+		// quote every element, escaping quotes and backslashes
+		b.WriteByte('"')
+		for _, c := range []byte(text) {
+			if c == '"' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// NextIDs allocates n values from a sequence, so that records can be given
+// their primary keys (and other records can refer to them) before they are
+// inserted, for example using InsertMany. It uses nextval and
+// generate_series, so it works with PostgreSQL only.
+func (d *Database) NextIDs(db DB, seqName string, n int) ([]int64, error) {
+	if n < 1 {
+		return nil, nil
+	}
+	q := fmt.Sprintf("SELECT nextval(%s) FROM generate_series(1, %s)", d.argPlaceholder(1, seqName), d.argPlaceholder(2, n))
+	rows, err := d.query(db, "NextIDs", q, seqName, n)
+	if err != nil {
+		return nil, &dbErr{msg: "meddler.NextIDs: DB error in Query", err: err}
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, n)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, &dbErr{msg: "meddler.NextIDs: DB error in Scan", err: err}
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &dbErr{msg: "meddler.NextIDs: DB error in Next", err: err}
+	}
+	if len(ids) != n {
+		return nil, fmt.Errorf("meddler.NextIDs: expected %d values, got %d", n, len(ids))
+	}
+
+	return ids, nil
+}
+
+// NextIDs using the Default Database type
+func NextIDs(db DB, seqName string, n int) ([]int64, error) {
+	return Default.NextIDs(db, seqName, n)
+}
+
+// ResetSequence resets the counter that gives new rows of a table their
+// ids, so that the next row inserted gets id 1, for example to keep ids
+// deterministic across tests. The table should be emptied first. It uses
+// setval on the sequence of the column for PostgreSQL, AUTO_INCREMENT for
+// MySQL, and the sqlite_sequence table for SQLite, which only exists if
+// some table is declared AUTOINCREMENT. Only PostgreSQL uses column.
+func (d *Database) ResetSequence(db DB, table, column string) error {
+	for _, name := range []string{table, column} {
+		if name == "" || d.Quote != "" && strings.Contains(name, d.Quote) {
+			return fmt.Errorf("meddler.ResetSequence: invalid table or column name [%s]", name)
+		}
+	}
+
+	var q string
+	var args []interface{}
+	switch d.Name {
+	case "postgres":
+		args = []interface{}{d.quoted(table), column}
+		q = fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, %s), 1, false)", d.argPlaceholder(1, args[0]), d.argPlaceholder(2, args[1]))
+	case "mysql":
+		q = fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = 1", d.quoted(table))
+	case "sqlite":
+		args = []interface{}{table}
+		q = fmt.Sprintf("DELETE FROM sqlite_sequence WHERE name = %s", d.argPlaceholder(1, table))
+	default:
+		return fmt.Errorf("meddler.ResetSequence: not supported for %s", d.Name)
+	}
+	if _, err := d.exec(db, "ResetSequence", q, args...); err != nil {
+		return &dbErr{msg: "meddler.ResetSequence: DB error in Exec", err: err}
+	}
+	return nil
+}
+
+// ResetSequence using the Default Database type
+func ResetSequence(db DB, table, column string) error {
+	return Default.ResetSequence(db, table, column)
+}
+
+// UpdateMany updates several records of the same type using a single
+// UPDATE query, joining the table with a VALUES list holding one row per
+// record. It is meant for PostgreSQL, but works with any database that
+// supports UPDATE ... FROM. src must be a slice of pointers to structs (or
+// a slice of structs), each with a non-zero primary key.
+//
+// The VALUES list is combined with an empty selection from the table
+// itself, so the database takes the types of its columns from the table
+// instead of treating the placeholders as text.
+func (d *Database) UpdateMany(db DB, table string, src interface{}) error {
+	records, err := recordsOf("UpdateMany", src)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	data, err := d.getFields(reflect.TypeOf(records[0]))
+	if err != nil {
+		return err
+	}
+	if data.pk == "" {
+		return fmt.Errorf("meddler.UpdateMany: no primary key field")
+	}
+	names := data.writeColumns(false)
+	columns := append([]string{data.pk}, names...)
+
+	// gather the rows, numbering the placeholders across all of them
+	var rows []string
+	var values []interface{}
+	for i, record := range records {
+		if err := validate(record); err != nil {
+			return err
+		}
+		_, pkValue, pkSet, err := d.primaryKeyValue(record)
+		if err != nil {
+			return err
+		}
+		if !pkSet {
+			return fmt.Errorf("meddler.UpdateMany: primary key must be set, record %d has none", i)
+		}
+		if v := reflect.ValueOf(pkValue); v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64 && v.Int() < 0 {
+			return fmt.Errorf("meddler.UpdateMany: primary key must be an integer > 0, record %d has %d", i, pkValue)
+		}
+		rowValues, err := d.SomeValues(record, names)
+		if err != nil {
+			return err
+		}
+		placeholders := d.writePlaceholders(data, record, columns, len(values)+1)
+		values = append(values, pkValue)
+		values = append(values, rowValues...)
+		rows = append(rows, "("+strings.Join(placeholders, ",")+")")
+	}
+
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=v.%s", d.quoted(name), d.quoted(name)))
+	}
+
+	// run the query
+	q := fmt.Sprintf("UPDATE %s SET %s FROM (SELECT %s FROM %s WHERE 1=0 UNION ALL VALUES %s) AS v WHERE %s.%s=v.%s",
+		d.quoted(table), strings.Join(pairs, ","),
+		d.quotedList(columns), d.quoted(table), strings.Join(rows, ","),
+		d.quoted(table), d.quoted(data.pk), d.quoted(data.pk))
+	if _, err := d.exec(db, "UpdateMany", q, values...); err != nil {
+		return &dbErr{msg: "meddler.UpdateMany: DB error in Exec", err: err}
+	}
+
+	return nil
+}
+
+// UpdateMany using the Default Database type
+func UpdateMany(db DB, table string, src interface{}) error {
+	return Default.UpdateMany(db, table, src)
+}
+
+// QueryOne performs the given query with the given arguments, scanning a
+// single row of results into dst. Returns sql.ErrNoRows if there was no
+// result row.
+func (d *Database) QueryRow(db DB, dst interface{}, query string, args ...interface{}) error {
+	// perform the query
+	rows, err := d.query(db, "QueryRow", query, args...)
+	if err != nil {
+		return err
+	}
+
+	// gather the result
+	return d.ScanRow(rows, dst)
+}
+
+// QueryRow using the Default Database type
+func QueryRow(db DB, dst interface{}, query string, args ...interface{}) error {
+	return Default.QueryRow(db, dst, query, args...)
+}
+
+// QueryRowPivot is like QueryRow, for pivoted queries whose columns can
+// vary: columns named in expected may be missing from the result, and the
+// fields they map to are set to zero if they are. Every expected column
+// must be mapped to a field of dst.
+func (d *Database) QueryRowPivot(db DB, dst interface{}, expected []string, query string, args ...interface{}) error {
+	data, err := d.getFields(reflect.TypeOf(dst))
+	if err != nil {
+		return err
+	}
+	for _, name := range expected {
+		if _, present := data.fields[name]; !present {
+			return fmt.Errorf("meddler.QueryRowPivot: expected column %s is not mapped to a field", name)
+		}
+	}
+
+	// perform the query
+	rows, err := d.query(db, "QueryRowPivot", query, args...)
+	if err != nil {
+		return err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return err
+	}
+
+	// clear the fields of missing columns
+	found := make(map[string]bool)
+	for _, name := range columns {
+		found[name] = true
+	}
+	structVal := reflect.ValueOf(dst).Elem()
+	for _, name := range expected {
+		if !found[name] {
+			field := fieldByIndex(structVal, data.fields[name].index, true)
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
+	// gather the result
+	return d.ScanRow(rows, dst)
+}
+
+// QueryRowPivot using the Default Database type
+func QueryRowPivot(db DB, dst interface{}, expected []string, query string, args ...interface{}) error {
+	return Default.QueryRowPivot(db, dst, expected, query, args...)
+}
+
+// QueryAll performs the given query with the given arguments, scanning
+// all results rows into dst.
+func (d *Database) QueryAll(db DB, dst interface{}, query string, args ...interface{}) error {
+	// perform the query
+	rows, err := d.query(db, "QueryAll", query, args...)
+	if err != nil {
+		return err
+	}
+
+	// gather the results
+	return d.ScanAll(rows, dst)
+}
+
+// QueryAll using the Default Database type
+func QueryAll(db DB, dst interface{}, query string, args ...interface{}) error {
+	return Default.QueryAll(db, dst, query, args...)
+}
+
+// QueryAllType is like QueryAll for a struct type only known at run time.
+// It gathers the result rows into a new slice of pointers to elemType,
+// which must be a struct type, and returns the slice, so that a result
+// for Person can be asserted to []*Person.
+func (d *Database) QueryAllType(db DB, elemType reflect.Type, query string, args ...interface{}) (interface{}, error) {
+	if elemType == nil || elemType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("meddler.QueryAllType: element type must be a struct, found %v", elemType)
+	}
+	dst := reflect.New(reflect.SliceOf(reflect.PtrTo(elemType)))
+	if err := d.QueryAll(db, dst.Interface(), query, args...); err != nil {
+		return nil, err
+	}
+	return dst.Elem().Interface(), nil
+}
+
+// QueryAllType using the Default Database type
+func QueryAllType(db DB, elemType reflect.Type, query string, args ...interface{}) (interface{}, error) {
+	return Default.QueryAllType(db, elemType, query, args...)
+}
+
+// QueryAllWithWindowTotal performs the given query with the given
+// arguments, gathering all result rows into dst as QueryAll does, and
+// returns the value of totalColumn in the first row. This reads a page of
+// results together with the total number of matching rows, where the query
+// selects a window function such as
+//
+//	SELECT *, count(*) OVER() AS total_count FROM person ORDER BY id LIMIT 10
+//
+// totalColumn must be in the results, and must not be mapped to a field
+// of the struct. The total is zero if there are no rows.
+func (d *Database) QueryAllWithWindowTotal(db DB, dst interface{}, totalColumn string, query string, args ...interface{}) (total int, err error) {
+	dstVal := reflect.ValueOf(dst)
+	if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() || dstVal.Elem().Kind() != reflect.Slice {
+		return 0, fmt.Errorf("meddler.QueryAllWithWindowTotal: dst must be a pointer to a slice, found %T", dst)
+	}
+	sliceVal := dstVal.Elem()
+	ptrType := sliceVal.Type().Elem()
+	if ptrType.Kind() != reflect.Ptr || ptrType.Elem().Kind() != reflect.Struct {
+		return 0, fmt.Errorf("meddler.QueryAllWithWindowTotal: expects elements to be pointers to structs, as in *[]*T, but %T has elements of type %v", dst, ptrType)
+	}
+	data, err := d.getFields(ptrType)
+	if err != nil {
+		return 0, err
+	}
+	if _, present := data.resultField(totalColumn); present {
+		return 0, fmt.Errorf("meddler.QueryAllWithWindowTotal: total column [%s] is mapped to a field of the struct", totalColumn)
+	}
+
+	// perform the query
+	rows, err := d.query(db, "QueryAllWithWindowTotal", query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	totalIndex := -1
+	for i, name := range columns {
+		if name == totalColumn {
+			totalIndex = i
+		}
+	}
+	if totalIndex < 0 {
+		return 0, fmt.Errorf("meddler.QueryAllWithWindowTotal: total column [%s] not found in results", totalColumn)
+	}
+
+	// gather the results
+	for first := true; rows.Next(); first = false {
+		eltVal := reflect.New(ptrType.Elem())
+		targets, err := d.Targets(eltVal.Interface(), columns)
+		if err != nil {
+			return 0, err
+		}
+		var count sql.NullInt64
+		targets[totalIndex] = &count
+		if err := rows.Scan(targets...); err != nil {
+			return 0, err
+		}
+		targets[totalIndex] = new(interface{})
+		if err := d.WriteTargets(eltVal.Interface(), columns, targets); err != nil {
+			return 0, err
+		}
+		if first {
+			total = int(count.Int64)
+		}
+		sliceVal.Set(reflect.Append(sliceVal, eltVal))
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// QueryAllWithWindowTotal using the Default Database type
+func QueryAllWithWindowTotal(db DB, dst interface{}, totalColumn string, query string, args ...interface{}) (total int, err error) {
+	return Default.QueryAllWithWindowTotal(db, dst, totalColumn, query, args...)
+}
+
+// ForEach performs the given query with the given arguments, scanning the
+// result rows one at a time into model, which must be a pointer to a
+// struct, and calling fn with it after each one. The same struct is reused
+// for every row, so fn must copy it to keep it; it is cleared before each
+// row is scanned. Iteration stops at the first error from fn, which is
+// returned. The rows are closed when ForEach returns.
+func (d *Database) ForEach(db DB, model interface{}, fn func(rec interface{}) error, query string, args ...interface{}) error {
+	// get the list of struct fields
+	data, err := d.getFields(reflect.TypeOf(model))
+	if err != nil {
+		return err
+	}
+
+	// perform the query
+	rows, err := d.query(db, "ForEach", query, args...)
+	if err != nil {
+		return err
+	}
+
+	// make sure we always close rows
+	defer rows.Close()
+
+	// get the sql columns
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	structVal := reflect.ValueOf(model).Elem()
+	for {
+		structVal.Set(reflect.Zero(structVal.Type()))
+		if err := d.scanRow(data, rows, model, columns); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		if err := fn(model); err != nil {
+			return err
+		}
+	}
+}
+
+// ForEach using the Default Database type
+func ForEach(db DB, model interface{}, fn func(rec interface{}) error, query string, args ...interface{}) error {
+	return Default.ForEach(db, model, fn, query, args...)
+}
+
+// QueryScalar performs the given query with the given arguments, scanning
+// the single column of the first result row into dst, which can be any
+// pointer accepted by sql.Rows.Scan. Returns sql.ErrNoRows if there was no
+// result row.
+func (d *Database) QueryScalar(db DB, dst interface{}, query string, args ...interface{}) error {
+	return d.queryRowScan(db, "QueryScalar", query, args, dst)
+}
+
+// QueryScalar using the Default Database type
+func QueryScalar(db DB, dst interface{}, query string, args ...interface{}) error {
+	return Default.QueryScalar(db, dst, query, args...)
+}
+
+// Query performs the given query with the given arguments, choosing how to
+// scan the results by the type of dst: a pointer to a slice (other than
+// []byte) gets all result rows as for QueryAll, a pointer to a struct with
+// columns gets a single row as for QueryRow, and any other pointer gets a
+// single value as for QueryScalar.
+func (d *Database) Query(db DB, dst interface{}, query string, args ...interface{}) error {
+	dstType := reflect.TypeOf(dst)
+	if dstType == nil || dstType.Kind() != reflect.Ptr {
+		return fmt.Errorf("meddler.Query: dst must be a pointer, found %T", dst)
+	}
+	switch t := dstType.Elem(); {
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		return d.QueryAll(db, dst, query, args...)
+	case t.Kind() == reflect.Struct && isEmbeddedStruct(t):
+		return d.QueryRow(db, dst, query, args...)
+	default:
+		return d.QueryScalar(db, dst, query, args...)
+	}
+}
+
+// Query using the Default Database type
+func Query(db DB, dst interface{}, query string, args ...interface{}) error {
+	return Default.Query(db, dst, query, args...)
+}
+
+// QueryAllMap performs the given query with the given arguments, scanning
+// all result rows into structs and storing them in the map that dst points
+// to, which must have the type map[K]*T. Each record is keyed by the value
+// of its field for keyColumn, which must be of type K. The map is created
+// if it is nil. Two rows with the same key, or a row with a key already in
+// the map, are an error unless DuplicateKeys chooses one of the rows.
+func (d *Database) QueryAllMap(db DB, keyColumn string, dst interface{}, query string, args ...interface{}) error {
+	dstType := reflect.TypeOf(dst)
+	if dstType == nil || dstType.Kind() != reflect.Ptr || dstType.Elem().Kind() != reflect.Map {
+		return fmt.Errorf("meddler.QueryAllMap: dst must be a pointer to a map, found %T", dst)
+	}
+	mapType := dstType.Elem()
+	data, err := d.getFields(mapType.Elem())
+	if err != nil {
+		return err
+	}
+	field, present := data.fields[keyColumn]
+	if !present {
+		return fmt.Errorf("meddler.QueryAllMap: key column [%s] not found in struct", keyColumn)
+	}
+	if keyType := mapType.Elem().Elem().FieldByIndex(field.index).Type; keyType != mapType.Key() {
+		return fmt.Errorf("meddler.QueryAllMap: key column [%s] has type %v, but the map keys are %v", keyColumn, keyType, mapType.Key())
+	}
+
+	// gather the results
+	records := reflect.New(reflect.SliceOf(mapType.Elem()))
+	if err := d.QueryAll(db, records.Interface(), query, args...); err != nil {
+		return err
+	}
+
+	// index them
+	mapVal := reflect.ValueOf(dst).Elem()
+	if mapVal.IsNil() {
+		mapVal.Set(reflect.MakeMap(mapType))
+	}
+	for i := 0; i < records.Elem().Len(); i++ {
+		record := records.Elem().Index(i)
+		key := fieldByIndex(record.Elem(), field.index, true)
+		if mapVal.MapIndex(key).IsValid() {
+			switch d.DuplicateKeys {
+			case DuplicateKeysKeepFirst:
+				continue
+			case DuplicateKeysKeepLast:
+			default:
+				return fmt.Errorf("meddler.QueryAllMap: found key %v twice", key.Interface())
+			}
+		}
+		mapVal.SetMapIndex(key, record)
+	}
+
+	return nil
+}
+
+// QueryAllMap using the Default Database type
+func QueryAllMap(db DB, keyColumn string, dst interface{}, query string, args ...interface{}) error {
+	return Default.QueryAllMap(db, keyColumn, dst, query, args...)
+}
+
+// QueryAllExcept selects the rows of a table matching cond into dst, which
+// must be a pointer to a slice of pointers to structs, as for ScanAll. All
+// of the columns of the struct are read except for the ones named in
+// exclude, whose fields are left zero. Every excluded column must be
+// mapped to a field of the struct.
+func (d *Database) QueryAllExcept(db DB, dst interface{}, table string, cond Condition, exclude ...string) error {
+	dstType := reflect.TypeOf(dst)
+	if dstType.Kind() != reflect.Ptr || dstType.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("meddler.QueryAllExcept: dst must be a pointer to a slice, found %T", dst)
+	}
+	data, err := d.getFields(dstType.Elem().Elem())
+	if err != nil {
+		return err
+	}
+	columns, err := data.columnsExcept(exclude)
+	if err != nil {
+		return err
+	}
+	clause, args, err := d.WhereClause(cond, 1)
+	if err != nil {
+		return err
+	}
+
+	// run the query
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s", d.quotedList(columns), d.quoted(table), clause)
+	rows, err := d.query(db, "QueryAllExcept", q, args...)
+	if err != nil {
+		return &dbErr{msg: "meddler.QueryAllExcept: DB error in Query", err: err}
+	}
+
+	// gather the results
+	return d.ScanAll(rows, dst)
+}
+
+// QueryAllExcept using the Default Database type
+func QueryAllExcept(db DB, dst interface{}, table string, cond Condition, exclude ...string) error {
+	return Default.QueryAllExcept(db, dst, table, cond, exclude...)
+}
+
+// Order is a column to sort query results by, as used by QueryAllOrdered.
+type Order struct {
+	Column string
+	Desc   bool
+}
+
+// Asc sorts by a column in ascending order.
+func Asc(column string) Order {
+	return Order{Column: column}
+}
+
+// Desc sorts by a column in descending order.
+func Desc(column string) Order {
+	return Order{Column: column, Desc: true}
+}
+
+// QueryAllOrdered selects the rows of a table matching cond into dst, as
+// QueryAllExcept does with no excluded columns, sorted by the given
+// columns in turn. Every order column must be mapped to a field of the
+// struct. If limit is positive, at most that many rows are read. Ending
+// the order with a unique column, such as the primary key, makes the
+// order deterministic, so that the next page of a keyset pagination can
+// be selected with a condition on the values of the last row.
+func (d *Database) QueryAllOrdered(db DB, dst interface{}, table string, cond Condition, limit int, order ...Order) error {
+	dstType := reflect.TypeOf(dst)
+	if dstType.Kind() != reflect.Ptr || dstType.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("meddler.QueryAllOrdered: dst must be a pointer to a slice, found %T", dst)
+	}
+	data, err := d.getFields(dstType.Elem().Elem())
+	if err != nil {
+		return err
+	}
+	if len(order) == 0 {
+		return fmt.Errorf("meddler.QueryAllOrdered: no order columns given")
+	}
+	var terms []string
+	for _, o := range order {
+		if _, present := data.fields[o.Column]; !present {
+			return fmt.Errorf("meddler.QueryAllOrdered: order column [%s] not found in struct", o.Column)
+		}
+		term := d.quoted(o.Column) + " ASC"
+		if o.Desc {
+			term = d.quoted(o.Column) + " DESC"
+		}
+		terms = append(terms, term)
+	}
+	clause, args, err := d.WhereClause(cond, 1)
+	if err != nil {
+		return err
+	}
+
+	// run the query
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s", d.quotedList(data.columns), d.quoted(table), clause, strings.Join(terms, ", "))
+	if limit > 0 {
+		if d.Name == "mssql" {
+			q += fmt.Sprintf(" OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", limit)
+		} else {
+			q += fmt.Sprintf(" LIMIT %d", limit)
+		}
+	}
+	rows, err := d.query(db, "QueryAllOrdered", q, args...)
+	if err != nil {
+		return &dbErr{msg: "meddler.QueryAllOrdered: DB error in Query", err: err}
+	}
+
+	// gather the results
+	return d.ScanAll(rows, dst)
+}
+
+// QueryAllOrdered using the Default Database type
+func QueryAllOrdered(db DB, dst interface{}, table string, cond Condition, limit int, order ...Order) error {
+	return Default.QueryAllOrdered(db, dst, table, cond, limit, order...)
+}
+
+// DeleteReturning deletes the record with the given primary key and scans
+// the deleted row into dst. Returns sql.ErrNoRows if there was no such
+// record. PostgreSQL and SQLite do this in a single DELETE ... RETURNING
+// statement. With other databases, the row is selected and then deleted;
+// this happens in a transaction if db is a *sql.DB, and it is up to the
+// caller otherwise.
+func (d *Database) DeleteReturning(db DB, table string, pk int64, dst interface{}) error {
+	data, err := d.getFields(reflect.TypeOf(dst))
+	if err != nil {
+		return err
+	}
+	if data.pk == "" {
+		return fmt.Errorf("meddler.DeleteReturning: no primary key field found")
+	}
+	if err := data.integerKey("DeleteReturning"); err != nil {
+		return err
+	}
+	columns := d.quotedList(data.columns)
+	where := fmt.Sprintf("%s = %s", d.quoted(data.pk), d.argPlaceholder(1, pk))
+	del := fmt.Sprintf("DELETE FROM %s WHERE %s", d.quoted(table), where)
+
+	if d.Name == "postgres" || d.Name == "sqlite" {
+		q := del + " RETURNING " + columns
+		rows, err := d.query(db, "DeleteReturning", q, pk)
+		if err != nil {
+			return &dbErr{msg: "meddler.DeleteReturning: DB error in Query", err: err}
+		}
+		return d.ScanRow(rows, dst)
+	}
+
+	if sqlDB, ok := db.(*sql.DB); ok {
+		tx, err := sqlDB.Begin()
+		if err != nil {
+			return &dbErr{msg: "meddler.DeleteReturning: DB error in Begin", err: err}
+		}
+		if err := d.DeleteReturning(tx, table, pk, dst); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return &dbErr{msg: "meddler.DeleteReturning: DB error in Commit", err: err}
+		}
+		return nil
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s", columns, d.quoted(table), where)
+	if d.Name == "mysql" {
+		q += " FOR UPDATE"
+	}
+	rows, err := d.query(db, "DeleteReturning", q, pk)
+	if err != nil {
+		return &dbErr{msg: "meddler.DeleteReturning: DB error in Query", err: err}
+	}
+	if err := d.ScanRow(rows, dst); err != nil {
+		return err
+	}
+	if _, err := d.exec(db, "DeleteReturning", del, pk); err != nil {
+		return &dbErr{msg: "meddler.DeleteReturning: DB error in Exec", err: err}
+	}
+
+	return nil
+}
+
+// DeleteReturning using the Default Database type
+func DeleteReturning(db DB, table string, pk int64, dst interface{}) error {
+	return Default.DeleteReturning(db, table, pk, dst)
+}
+
+// DeleteWhereLimited deletes the rows of a table that match all of the
+// conditions (as for Where) and returns the number of rows deleted. As a
+// guard against runaway deletes, it first counts the matching rows and
+// refuses to delete anything if there are more than maxRows of them.
+// Giving no conditions at all is an error.
+// The count and the delete are separate queries, so pass a transaction
+// as db if other writers could change the outcome between them.
+func (d *Database) DeleteWhereLimited(db DB, table string, conditions map[string]interface{}, maxRows int) (int64, error) {
+	if len(conditions) == 0 {
+		return 0, fmt.Errorf("meddler.DeleteWhereLimited: no conditions given")
+	}
+	clause, args, err := d.WhereClause(Where(conditions), 1)
+	if err != nil {
+		return 0, err
+	}
+
+	del := fmt.Sprintf("DELETE FROM %s WHERE %s", d.quoted(table), clause)
+
+	// count the rows that would be affected
+	q := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", d.quoted(table), clause)
+	var count int64
+	if err := d.queryRowScan(db, "DeleteWhereLimited", q, args, &count); err != nil {
+		return 0, &dbErr{msg: "meddler.DeleteWhereLimited: DB error in QueryRow", err: err}
+	}
+	if count > int64(maxRows) {
+		return 0, fmt.Errorf("meddler.DeleteWhereLimited: %d rows match, which is more than the limit of %d", count, maxRows)
+	}
+
+	// run the query
+	result, err := d.exec(db, "DeleteWhereLimited", del, args...)
+	if err != nil {
+		return 0, &dbErr{msg: "meddler.DeleteWhereLimited: DB error in Exec", err: err}
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, &dbErr{msg: "meddler.DeleteWhereLimited: DB error getting rows affected", err: err}
+	}
+
+	return n, nil
+}
+
+// DeleteWhereLimited using the Default Database type
+func DeleteWhereLimited(db DB, table string, conditions map[string]interface{}, maxRows int) (int64, error) {
+	return Default.DeleteWhereLimited(db, table, conditions, maxRows)
+}
+
+// DeleteMany deletes the rows with the given primary keys from a table,
+// using a single query, and returns the number of rows deleted. model is
+// a pointer to a struct of the type stored in the table, and is only used
+// to find the primary key column.
+func (d *Database) DeleteMany(db DB, table string, pks []int64, model interface{}) (int64, error) {
+	q, args, err := d.BuildDeleteMany(table, pks, model)
+	if err != nil || q == "" {
+		return 0, err
+	}
+
+	// run the query
+	result, err := d.exec(db, "DeleteMany", q, args...)
+	if err != nil {
+		return 0, &dbErr{msg: "meddler.DeleteMany: DB error in Exec", err: err}
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, &dbErr{msg: "meddler.DeleteMany: DB error getting rows affected", err: err}
+	}
+	return n, nil
+}
+
+// DeleteMany using the Default Database type
+func DeleteMany(db DB, table string, pks []int64, model interface{}) (int64, error) {
+	return Default.DeleteMany(db, table, pks, model)
+}
+
+// BuildDeleteMany returns the query and arguments DeleteMany would run,
+// without running them. The query is empty if there are no pks.
+func (d *Database) BuildDeleteMany(table string, pks []int64, model interface{}) (string, []interface{}, error) {
+	data, err := d.getFields(reflect.TypeOf(model))
+	if err != nil {
+		return "", nil, err
+	}
+	if data.pk == "" {
+		return "", nil, fmt.Errorf("meddler.DeleteMany: no primary key field found")
+	}
+	if err := data.integerKey("DeleteMany"); err != nil {
+		return "", nil, err
+	}
+	if len(pks) == 0 {
+		return "", nil, nil
+	}
+
+	var placeholders []string
+	var args []interface{}
+	for i, pk := range pks {
+		placeholders = append(placeholders, d.argPlaceholder(i+1, pk))
+		args = append(args, pk)
+	}
+	q := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", d.quoted(table), d.quoted(data.pk), strings.Join(placeholders, ","))
+	return q, args, nil
+}
+
+// BuildDeleteMany using the Default Database type
+func BuildDeleteMany(table string, pks []int64, model interface{}) (string, []interface{}, error) {
+	return Default.BuildDeleteMany(table, pks, model)
+}
+
+// DeleteByValues deletes the rows of a table whose column holds any of
+// the given values, using a single DELETE query, and returns the number
+// of rows deleted. Nothing is deleted if values is empty.
+func (d *Database) DeleteByValues(db DB, table, column string, values []interface{}) (int64, error) {
+	q, args, err := d.BuildDeleteByValues(table, column, values)
+	if err != nil || q == "" {
+		return 0, err
+	}
+
+	// run the query
+	result, err := d.exec(db, "DeleteByValues", q, args...)
+	if err != nil {
+		return 0, &dbErr{msg: "meddler.DeleteByValues: DB error in Exec", err: err}
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, &dbErr{msg: "meddler.DeleteByValues: DB error getting rows affected", err: err}
+	}
+	return n, nil
+}
+
+// DeleteByValues using the Default Database type
+func DeleteByValues(db DB, table, column string, values []interface{}) (int64, error) {
+	return Default.DeleteByValues(db, table, column, values)
+}
+
+// BuildDeleteByValues returns the query and arguments DeleteByValues
+// would run, without running them. The query is empty if there are no
+// values.
+func (d *Database) BuildDeleteByValues(table, column string, values []interface{}) (string, []interface{}, error) {
+	if column == "" || d.Quote != "" && strings.Contains(column, d.Quote) {
+		return "", nil, fmt.Errorf("meddler.DeleteByValues: invalid column name [%s]", column)
+	}
+	if len(values) == 0 {
+		return "", nil, nil
+	}
+
+	var placeholders []string
+	for i, value := range values {
+		placeholders = append(placeholders, d.argPlaceholder(i+1, value))
+	}
+	q := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", d.quoted(table), d.quoted(column), strings.Join(placeholders, ","))
+	return q, values, nil
+}
+
+// BuildDeleteByValues using the Default Database type
+func BuildDeleteByValues(table, column string, values []interface{}) (string, []interface{}, error) {
+	return Default.BuildDeleteByValues(table, column, values)
+}
+
+// Touch sets a timestamp column of the row with the given primary key to
+// the current time, without loading or saving the rest of the record, as
+// for last-seen times. model is a pointer to a struct of the type stored
+// in the table, which gives the primary key column and the field of the
+// timestamp column; the field must be a time.Time or *time.Time, and the
+// time is written as its meddler would write it. Returns sql.ErrNoRows if
+// there is no such row.
+func (d *Database) Touch(db DB, table string, pk int64, column string, model interface{}) error {
+	data, err := d.getFields(reflect.TypeOf(model))
+	if err != nil {
+		return err
+	}
+	if data.pk == "" {
+		return fmt.Errorf("meddler.Touch: no primary key field found")
+	}
+	if err := data.integerKey("Touch"); err != nil {
+		return err
+	}
+	field, present := data.fields[column]
+	if !present || column == data.pk {
+		return fmt.Errorf("meddler.Touch: column [%s] not found in struct", column)
+	}
+	var now interface{} = time.Now()
+	switch reflect.TypeOf(model).Elem().FieldByIndex(field.index).Type {
+	case reflect.TypeOf(time.Time{}):
+	case reflect.TypeOf((*time.Time)(nil)):
+		t := now.(time.Time)
+		now = &t
+	default:
+		return fmt.Errorf("meddler.Touch: column [%s] must be a time.Time field", column)
+	}
+	value, err := d.BindValue(model, column, now)
+	if err != nil {
+		return err
+	}
+
+	q := fmt.Sprintf("UPDATE %s SET %s=%s WHERE %s=%s", d.quoted(table), d.quoted(column), d.placeholder(1, d.goTypeKind(data, model, column)),
+		d.quoted(data.pk), d.argPlaceholder(2, pk))
+	result, err := d.exec(db, "Touch", q, value, pk)
+	if err != nil {
+		return &dbErr{msg: "meddler.Touch: DB error in Exec", err: err}
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return &dbErr{msg: "meddler.Touch: DB error getting rows affected", err: err}
+	}
+	if n == 0 && d.Name == "mysql" {
+		// MySQL counts only the rows that changed, so a row touched twice
+		// within the precision of the column is not counted
+		q := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s=%s", d.quoted(table), d.quoted(data.pk), d.argPlaceholder(1, pk))
+		if err := d.queryRowScan(db, "Touch", q, []interface{}{pk}, &n); err != nil {
+			return &dbErr{msg: "meddler.Touch: DB error in QueryRow", err: err}
+		}
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Touch using the Default Database type
+func Touch(db DB, table string, pk int64, column string, model interface{}) error {
+	return Default.Touch(db, table, pk, column, model)
+}
+
+// UpdateAll sets the columns in set to the given values in all rows of a
+// table that match all of the conditions in where (as for Where), using a
+// single UPDATE query, and returns the number of rows updated. As a guard
+// against updating a whole table by mistake, where must not be empty; use
+// UpdateAllRows for that.
+func (d *Database) UpdateAll(db DB, table string, set, where map[string]interface{}) (int64, error) {
+	if len(where) == 0 {
+		return 0, fmt.Errorf("meddler.UpdateAll: no conditions given, use UpdateAllRows to update every row")
+	}
+	return d.updateAll(db, "UpdateAll", table, set, where)
+}
+
+// UpdateAll using the Default Database type
+func UpdateAll(db DB, table string, set, where map[string]interface{}) (int64, error) {
+	return Default.UpdateAll(db, table, set, where)
+}
+
+// UpdateAllRows sets the columns in set to the given values in every row
+// of a table, and returns the number of rows updated.
+func (d *Database) UpdateAllRows(db DB, table string, set map[string]interface{}) (int64, error) {
+	return d.updateAll(db, "UpdateAllRows", table, set, nil)
+}
+
+// UpdateAllRows using the Default Database type
+func UpdateAllRows(db DB, table string, set map[string]interface{}) (int64, error) {
+	return Default.UpdateAllRows(db, table, set)
+}
+
+func (d *Database) updateAll(db DB, op, table string, set, where map[string]interface{}) (int64, error) {
+	if len(set) == 0 {
+		return 0, fmt.Errorf("meddler.%s: no columns to set", op)
+	}
+	var columns []string
+	for column := range set {
+		if column == "" || d.Quote != "" && strings.Contains(column, d.Quote) {
+			return 0, fmt.Errorf("meddler.%s: invalid column name [%s]", op, column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var pairs []string
+	var args []interface{}
+	for _, column := range columns {
+		args = append(args, set[column])
+		pairs = append(pairs, fmt.Sprintf("%s=%s", d.quoted(column), d.argPlaceholder(len(args), set[column])))
+	}
+	q := fmt.Sprintf("UPDATE %s SET %s", d.quoted(table), strings.Join(pairs, ","))
+	if len(where) > 0 {
+		clause, more, err := d.WhereClause(Where(where), len(args)+1)
+		if err != nil {
+			return 0, err
+		}
+		q += " WHERE " + clause
+		args = append(args, more...)
+	} else if op != "UpdateAllRows" {
+		return 0, fmt.Errorf("meddler.%s: refusing to update every row without conditions", op)
+	}
+
+	// run the query
+	result, err := d.exec(db, op, q, args...)
+	if err != nil {
+		return 0, &dbErr{msg: "meddler." + op + ": DB error in Exec", err: err}
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, &dbErr{msg: "meddler." + op + ": DB error getting rows affected", err: err}
+	}
+
+	return n, nil
+}
+
+// Beginner can start transactions with options; *sql.DB is one.
+type Beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Snapshot runs fn in a read-only transaction with the repeatable read
+// isolation level, so that all of the reads done by fn see the same state
+// of the database. The transaction is always rolled back when fn returns,
+// and the error from fn is returned.
+func Snapshot(db Beginner, fn func(tx DB) error) error {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return &dbErr{msg: "meddler.Snapshot: DB error in Begin", err: err}
+	}
+	defer tx.Rollback()
+
+	return fn(tx)
+}
+
+// TxOptions holds the options for WithTransaction.
+type TxOptions struct {
+	sql.TxOptions
+
+	// DeferConstraints defers the checking of foreign key constraints
+	// until the transaction commits, so that rows referring to each other
+	// can be inserted one after the other. In PostgreSQL this only covers
+	// constraints declared DEFERRABLE. It is supported for the postgres
+	// and sqlite dialects.
+	DeferConstraints bool
+}
+
+// WithTransaction runs fn in a transaction started with the given
+// options, which may be nil. The isolation level and read-only flag of
+// the embedded sql.TxOptions are passed on to BeginTx. The transaction is
+// committed if fn returns nil and rolled back otherwise, and the error
+// from fn is returned. A read-only transaction cannot have changed
+// anything, so it is always rolled back, which spares the commit.
+func (d *Database) WithTransaction(db Beginner, opts *TxOptions, fn func(tx DB) error) error {
+	if opts == nil {
+		opts = new(TxOptions)
+	}
+	var deferral string
+	if opts.DeferConstraints {
+		switch d.Name {
+		case "postgres":
+			deferral = "SET CONSTRAINTS ALL DEFERRED"
+		case "sqlite":
+			deferral = "PRAGMA defer_foreign_keys = ON"
+		default:
+			return fmt.Errorf("meddler.WithTransaction: deferring constraints is not supported for %s", d.Name)
+		}
+	}
+
+	tx, err := db.BeginTx(context.Background(), &opts.TxOptions)
+	if err != nil {
+		return &dbErr{msg: "meddler.WithTransaction: DB error in Begin", err: err}
+	}
+	defer tx.Rollback()
+
+	if deferral != "" {
+		if _, err := d.exec(tx, "WithTransaction", deferral); err != nil {
+			return &dbErr{msg: "meddler.WithTransaction: DB error in Exec", err: err}
+		}
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if opts.ReadOnly {
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return &dbErr{msg: "meddler.WithTransaction: DB error in Commit", err: err}
+	}
+	return nil
+}
+
+// WithTransaction using the Default Database type
+func WithTransaction(db Beginner, opts *TxOptions, fn func(tx DB) error) error {
+	return Default.WithTransaction(db, opts, fn)
+}
+
+// lockTimeouts lists text found in the errors that drivers return when a
+// statement gives up waiting for a lock, by dialect name.
+var lockTimeouts = map[string][]string{
+	"postgres": {"lock_not_available", "SQLSTATE 55P03", "could not obtain lock", "canceling statement due to lock timeout"},
+	"mysql":    {"Error 1205", "Lock wait timeout exceeded"},
+	"sqlite":   {"database is locked", "database table is locked"},
+	"mssql":    {"Lock request time out period exceeded"},
+}
+
+// IsLockTimeout reports whether err, as returned by meddler or by the
+// driver, reports that a statement timed out waiting for a lock held by
+// another transaction, such as MySQL error 1205 or the PostgreSQL error
+// lock_not_available. Serialization failures and deadlocks are not lock
+// timeouts. Errors are recognized as for IsUniqueViolation, with the
+// SQLState code 55P03.
+func (d *Database) IsLockTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	err, _ = DriverErr(err)
+	if state, ok := err.(interface{ SQLState() string }); ok && state.SQLState() == "55P03" {
+		return true
+	}
+
+	msg := err.Error()
+	patterns, known := lockTimeouts[d.Name]
+	if !known {
+		for _, list := range lockTimeouts {
+			patterns = append(patterns, list...)
+		}
+	}
+	for _, pattern := range patterns {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLockTimeout using the Default Database type
+func IsLockTimeout(err error) bool {
+	return Default.IsLockTimeout(err)
+}
+
+// ProcessTx runs fn in a transaction under ctx and commits it, as a unit
+// of work of a queue worker. If fn returns an error, the transaction is
+// rolled back and the error is returned. If fn or the commit fails with a
+// lock timeout, as told by IsLockTimeout, the whole transaction is tried
+// again after a pause, up to LockRetries times, so fn must be safe to
+// run more than once. The pauses start at LockRetryDelay and double each
+// time, with random jitter so that competing workers spread out. Other
+// errors are never retried, and waiting stops early if ctx is done.
+func (d *Database) ProcessTx(ctx context.Context, db Beginner, fn func(tx DB) error) error {
+	retries, delay := d.LockRetries, d.LockRetryDelay
+	if retries == 0 {
+		retries = 3
+	}
+	if delay <= 0 {
+		delay = 50 * time.Millisecond
+	}
+	for attempt := 0; ; attempt++ {
+		err := d.processTx(ctx, db, fn)
+		if err == nil || attempt >= retries || !d.IsLockTimeout(err) {
+			return err
+		}
+
+		// wait between half and all of the delay for this attempt
+		wait := delay << uint(attempt)
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// ProcessTx using the Default Database type
+func ProcessTx(ctx context.Context, db Beginner, fn func(tx DB) error) error {
+	return Default.ProcessTx(ctx, db, fn)
+}
+
+// processTx makes a single attempt for ProcessTx.
+func (d *Database) processTx(ctx context.Context, db Beginner, fn func(tx DB) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return &dbErr{msg: "meddler.ProcessTx: DB error in Begin", err: err}
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return &dbErr{msg: "meddler.ProcessTx: DB error in Commit", err: err}
+	}
+	return nil
 }
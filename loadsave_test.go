@@ -1,7 +1,16 @@
 package meddler
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,6 +33,113 @@ func TestLoad(t *testing.T) {
 	db.Exec("delete from person")
 }
 
+func TestLoadOK(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	elt := new(Person)
+	found, err := LoadOK(db, "person", elt, 2)
+	if err != nil || !found {
+		t.Errorf("expected to find Bob, found %v, error %v", found, err)
+	}
+	if elt.Name != "Bob" {
+		t.Errorf("expected Bob, found %s", elt.Name)
+	}
+
+	found, err = LoadOK(db, "person", new(Person), 10000)
+	if err != nil || found {
+		t.Errorf("expected not found without an error, found %v, error %v", found, err)
+	}
+
+	found, err = LoadOK(db, "no_such_table", new(Person), 2)
+	if err == nil || found {
+		t.Errorf("expected a DB error, found %v, error %v", found, err)
+	}
+	db.Exec("delete from person")
+}
+
+func TestLoadProjection(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+	defer db.Exec("delete from person")
+
+	// a struct with some of the columns of a table reads only those
+	type PersonName struct {
+		ID   int64  `meddler:"id,pk"`
+		Name string `meddler:"name"`
+	}
+	rec := &recordingDB{DB: db}
+	p := new(PersonName)
+	if err := SQLite.Load(rec, "person", p, 2); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if *p != (PersonName{2, "Bob"}) {
+		t.Errorf("expected Bob, found %v", p)
+	}
+
+	columns, err := SQLite.ColumnsQuoted(p, true)
+	if err != nil {
+		t.Fatalf("ColumnsQuoted error: %v", err)
+	}
+	var lst []*PersonName
+	if err := SQLite.QueryAll(rec, &lst, "SELECT "+columns+" FROM person ORDER BY id"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if len(lst) != 2 || *lst[0] != (PersonName{1, "Alice"}) {
+		t.Errorf("unexpected results: %v", lst)
+	}
+
+	expected := []string{
+		`SELECT "id","name" FROM "person" WHERE "id" = ?`,
+		`SELECT "id","name" FROM person ORDER BY id`,
+	}
+	if !reflect.DeepEqual(rec.queries, expected) {
+		t.Errorf("expected %q, found %q", expected, rec.queries)
+	}
+}
+
+func TestNilAndEmptyBytes(t *testing.T) {
+	once.Do(setup)
+
+	type Attachment struct {
+		ID   int64  `meddler:"id,pk"`
+		Data []byte `meddler:"data"`
+	}
+	if _, err := db.Exec("create table attachment (id integer primary key, data blob)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table attachment")
+
+	// a nil slice is stored as null, an empty one as an empty blob
+	absent, empty := &Attachment{Data: nil}, &Attachment{Data: []byte{}}
+	for _, elt := range []*Attachment{absent, empty} {
+		if err := SQLite.Insert(db, "attachment", elt); err != nil {
+			t.Fatalf("Insert error: %v", err)
+		}
+	}
+	var nulls int
+	if err := db.QueryRow("select count(*) from attachment where data is null").Scan(&nulls); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if nulls != 1 {
+		t.Errorf("expected 1 null column, found %d", nulls)
+	}
+
+	loaded := new(Attachment)
+	if err := SQLite.Load(db, "attachment", loaded, absent.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Data != nil {
+		t.Errorf("expected a nil slice, found %#v", loaded.Data)
+	}
+	if err := SQLite.Load(db, "attachment", loaded, empty.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Data == nil || len(loaded.Data) != 0 {
+		t.Errorf("expected an empty slice, found %#v", loaded.Data)
+	}
+}
+
 func TestLoadUint(t *testing.T) {
 	once.Do(setup)
 	insertAliceBob(t)
@@ -104,27 +220,2623 @@ func TestSave(t *testing.T) {
 	db.Exec("delete from person")
 }
 
-func TestDriverErr(t *testing.T) {
-	err, ok := DriverErr(io.EOF)
-	if ok {
-		t.Errorf("io.EOF: want driver error = false, got true")
+func TestSaveStringKey(t *testing.T) {
+	once.Do(setup)
+
+	type Tag struct {
+		ID    string `meddler:"id,pk"`
+		Label string `meddler:"label"`
 	}
-	if err != io.EOF {
-		t.Errorf("io.EOF: want itself as returned error, got %v", err)
+	if _, err := db.Exec("create table tag (id text primary key default (lower(hex(randomblob(8)))), label text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table tag")
+
+	returning := *SQLite
+	returning.UseReturningToGetID = true
+
+	// an empty key is filled in by the database
+	tag := &Tag{Label: "new"}
+	if err := returning.Save(db, "tag", tag); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if len(tag.ID) != 16 {
+		t.Fatalf("expected a key from the database, found %q", tag.ID)
 	}
 
+	// a non-empty key is updated
+	tag.Label = "old"
+	if err := returning.Save(db, "tag", tag); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	var count int
+	var label string
+	if err := db.QueryRow("select count(*), max(label) from tag").Scan(&count, &label); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if count != 1 || label != "old" {
+		t.Errorf("expected one updated row, found %d with label %s", count, label)
+	}
+}
+
+func TestSaveIf(t *testing.T) {
 	once.Do(setup)
-	// insert into an invalid table
+
 	alice.ID = 0
-	err = Insert(db, "invalid", alice)
-	if err == nil {
-		t.Fatal("insert into invalid table, want error, got none")
+	if err := SaveIf(db, "person", alice, func() bool { return false }); err != nil {
+		t.Errorf("SaveIf error: %v", err)
 	}
-	err, ok = DriverErr(err)
-	if !ok {
-		t.Errorf("DriverErr: want ok to be true, got false")
+	if alice.ID != 0 {
+		t.Errorf("expected nothing to be saved, found id %d", alice.ID)
 	}
-	if _, ok := err.(sqlite3.Error); !ok {
-		t.Errorf("DriverErr: want sqlite3 error, got %T", err)
+	if err := SaveIf(db, "person", alice, func() bool { return true }); err != nil {
+		t.Errorf("SaveIf error: %v", err)
+	}
+	if alice.ID == 0 {
+		t.Errorf("expected Alice to be inserted")
+	}
+	var count int
+	if err := db.QueryRow("select count(*) from person").Scan(&count); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 row, found %d", count)
+	}
+	db.Exec("delete from person")
+}
+
+func TestSaveWithOutbox(t *testing.T) {
+	once.Do(setup)
+
+	type Event struct {
+		ID       int64  `meddler:"id,pk"`
+		Kind     string `meddler:"kind"`
+		PersonID int64  `meddler:"person_id"`
+	}
+	if _, err := db.Exec("create table outbox (id integer primary key, kind text, person_id integer)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table outbox")
+	defer db.Exec("delete from person")
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("DB error starting transaction: %v", err)
+	}
+	alice.ID = 0
+	event := &Event{Kind: "person.created"}
+	if err := SaveWithOutbox(tx, "person", alice, "outbox", event); err != nil {
+		tx.Rollback()
+		t.Fatalf("SaveWithOutbox error: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("DB error committing: %v", err)
+	}
+	if alice.ID == 0 || event.ID == 0 {
+		t.Errorf("expected both records to be inserted, found ids %d and %d", alice.ID, event.ID)
+	}
+	var kind string
+	if err := db.QueryRow("select kind from outbox where id = ?", event.ID).Scan(&kind); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if kind != "person.created" {
+		t.Errorf("expected the event, found %s", kind)
+	}
+
+	// the event is not written when the record fails to save
+	if err := SaveWithOutbox(db, "nosuchtable", alice, "outbox", &Event{Kind: "lost"}); err == nil {
+		t.Errorf("expected an error saving to a missing table")
+	}
+	var count int
+	if err := db.QueryRow("select count(*) from outbox").Scan(&count); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 event, found %d", count)
+	}
+}
+
+type Account struct {
+	ID     int64  `meddler:"id,pk"`
+	Email  string `meddler:"email"`
+	Name   string `meddler:"name"`
+	Active bool   `meddler:"active"`
+}
+
+func TestUpsertWhere(t *testing.T) {
+	once.Do(setup)
+
+	returning := *SQLite
+	returning.UseReturningToGetID = true
+	rec := &recordingDB{DB: db}
+
+	elt := &Account{Email: "alice@alice.com", Name: "Alice", Active: true}
+	if err := returning.UpsertWhere(rec, "account", elt, "active", "email"); err != nil {
+		t.Fatalf("UpsertWhere error: %v", err)
+	}
+	expected := `INSERT INTO "account" ("email","name","active") VALUES (?,?,?) ` +
+		`ON CONFLICT ("email") WHERE active DO UPDATE SET "name"=EXCLUDED."name","active"=EXCLUDED."active" RETURNING "id"`
+	if rec.queries[0] != expected {
+		t.Errorf("expected %s, found %s", expected, rec.queries[0])
+	}
+	id := elt.ID
+
+	// the active row is updated
+	elt = &Account{Email: "alice@alice.com", Name: "Alice Smith", Active: true}
+	if err := returning.UpsertWhere(db, "account", elt, "active", "email"); err != nil {
+		t.Fatalf("UpsertWhere error: %v", err)
+	}
+	if elt.ID != id {
+		t.Errorf("expected the existing id %d, found %d", id, elt.ID)
+	}
+	loaded := new(Account)
+	if err := Load(db, "account", loaded, id); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Name != "Alice Smith" {
+		t.Errorf("expected the name to be updated, found %s", loaded.Name)
+	}
+
+	// inactive rows are not covered by the index
+	for i := 0; i < 2; i++ {
+		elt = &Account{Email: "bob@bob.com", Name: "Bob"}
+		if err := returning.UpsertWhere(db, "account", elt, "active", "email"); err != nil {
+			t.Fatalf("UpsertWhere error: %v", err)
+		}
+	}
+	var count int
+	if err := db.QueryRow("select count(*) from account").Scan(&count); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 rows, found %d", count)
+	}
+
+	if err := Upsert(db, "account", elt); err == nil {
+		t.Errorf("expected an error without conflict columns")
+	}
+	if err := Upsert(db, "account", elt, "no_such_column"); err == nil {
+		t.Errorf("expected an error for an unknown conflict column")
+	}
+	db.Exec("delete from account")
+}
+
+type Label struct {
+	ID   int64  `meddler:"id,pk"`
+	Name string `meddler:"name"`
+	Uses int    `meddler:"uses"`
+}
+
+// replayDB records queries, but answers them with a replacement query,
+// for statements that SQLite does not understand
+type replayDB struct {
+	DB
+	replacement string
+	queries     []string
+}
+
+func (r *replayDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	r.queries = append(r.queries, query)
+	return r.DB.Query(r.replacement)
+}
+
+func TestDialectSQL(t *testing.T) {
+	once.Do(setup)
+
+	// the label table does not exist, so the statements are only recorded
+	for _, test := range []struct {
+		d      *Database
+		insert string
+		update string
+	}{
+		{MySQL,
+			"INSERT INTO `label` (`name`,`uses`) VALUES (?,?)",
+			"UPDATE `label` SET `name`=?,`uses`=? WHERE `id`=?"},
+		{PostgreSQL,
+			`INSERT INTO "label" ("name","uses") VALUES ($1,$2) RETURNING "id"`,
+			`UPDATE "label" SET "name"=$1,"uses"=$2 WHERE "id"=$3`},
+		{SQLite,
+			`INSERT INTO "label" ("name","uses") VALUES (?,?)`,
+			`UPDATE "label" SET "name"=?,"uses"=? WHERE "id"=?`},
+		{QL,
+			`INSERT INTO label (name,uses) VALUES (string($1),int($2)) RETURNING id`,
+			`UPDATE label SET name=string($1),uses=int($2) WHERE id=int64($3)`},
+	} {
+		rec := &recordingDB{DB: db}
+		test.d.Insert(rec, "label", &Label{Name: "go", Uses: 1})
+		test.d.Update(rec, "label", &Label{ID: 1, Name: "go", Uses: 2})
+		expected := []string{test.insert, test.update}
+		if !reflect.DeepEqual(rec.queries, expected) {
+			t.Errorf("%s: expected %q, found %q", test.d.Name, expected, rec.queries)
+		}
+	}
+}
+
+func TestResetSequence(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table counter (id integer primary key autoincrement, name text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table counter")
+
+	for i := 0; i < 2; i++ {
+		db.Exec("insert into counter (name) values ('x')")
+	}
+	db.Exec("delete from counter")
+	if err := SQLite.ResetSequence(db, "counter", "id"); err != nil {
+		t.Fatalf("ResetSequence error: %v", err)
+	}
+	result, err := db.Exec("insert into counter (name) values ('y')")
+	if err != nil {
+		t.Fatalf("DB error on insert: %v", err)
+	}
+	if id, _ := result.LastInsertId(); id != 1 {
+		t.Errorf("expected id 1 after the reset, found %d", id)
+	}
+
+	for _, test := range []struct {
+		d        *Database
+		expected string
+	}{
+		{PostgreSQL, `SELECT setval(pg_get_serial_sequence($1, $2), 1, false)`},
+		{MySQL, "ALTER TABLE `counter` AUTO_INCREMENT = 1"},
+		{SQLite, `DELETE FROM sqlite_sequence WHERE name = ?`},
+	} {
+		rec := &recordingDB{DB: db}
+		test.d.ResetSequence(rec, "counter", "id")
+		if len(rec.queries) != 1 || rec.queries[0] != test.expected {
+			t.Errorf("%s: expected %s, found %v", test.d.Name, test.expected, rec.queries)
+		}
+	}
+
+	if err := ResetSequence(db, `count"er`, "id"); err == nil {
+		t.Errorf("expected an error for an invalid table name")
+	}
+	if err := MSSQL.ResetSequence(db, "counter", "id"); err == nil {
+		t.Errorf("expected an error for an unsupported dialect")
+	}
+}
+
+func TestUpsertMany(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table label (id integer primary key, name text not null unique, uses integer not null)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table label")
+
+	if err := SQLite.UpsertMany(db, "label", []*Label{{Name: "go", Uses: 1}, {Name: "sql", Uses: 1}}, "name"); err != nil {
+		t.Fatalf("UpsertMany error: %v", err)
+	}
+	labels := []Label{{Name: "sql", Uses: 2}, {Name: "orm", Uses: 1}}
+	if err := SQLite.UpsertMany(db, "label", labels, "name"); err != nil {
+		t.Fatalf("UpsertMany error: %v", err)
+	}
+	var lst []*Label
+	if err := QueryAll(db, &lst, "select * from label order by id"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if len(lst) != 3 || lst[1].Name != "sql" || lst[1].Uses != 2 || lst[2].Name != "orm" {
+		t.Errorf("unexpected rows after upserts: %v %v %v", lst[0], lst[1], lst[2])
+	}
+
+	// the statements for three rows, chunked to fit the parameter limit
+	three := []*Label{{Name: "a", Uses: 1}, {Name: "b", Uses: 2}, {Name: "c", Uses: 3}}
+	q, args, err := MySQL.BuildUpsert("label", three, "name")
+	if err != nil {
+		t.Fatalf("BuildUpsert error: %v", err)
+	}
+	expected := "INSERT INTO `label` (`name`,`uses`) VALUES (?,?),(?,?),(?,?) ON DUPLICATE KEY UPDATE `uses`=VALUES(`uses`)"
+	if q != expected || len(args) != 6 {
+		t.Errorf("expected %s with 6 args, found %s %v", expected, q, args)
+	}
+	pg := *PostgreSQL
+	pg.MaxParams = 4
+	rec := &argsDB{}
+	if err := pg.UpsertMany(rec, "label", three, "name"); err != nil {
+		t.Fatalf("UpsertMany error: %v", err)
+	}
+	chunks := []string{
+		`INSERT INTO "label" ("name","uses") VALUES ($1,$2),($3,$4) ON CONFLICT ("name") DO UPDATE SET "uses"=EXCLUDED."uses"`,
+		`INSERT INTO "label" ("name","uses") VALUES ($1,$2) ON CONFLICT ("name") DO UPDATE SET "uses"=EXCLUDED."uses"`,
+	}
+	if !reflect.DeepEqual(rec.queries, chunks) || !reflect.DeepEqual(rec.args[1], []interface{}{"c", 3}) {
+		t.Errorf("expected %v, found %v %v", chunks, rec.queries, rec.args)
+	}
+	if err := MySQL.UpsertWhere(rec, "label", three[0], "uses > 0", "name"); err == nil {
+		t.Errorf("expected an error for a conflict predicate with MySQL")
+	}
+
+	// PostgreSQL reports which rows were inserted, in any order
+	replay := &replayDB{DB: db, replacement: "select 3, 1, 'orm' union all select 2, 0, 'sql'"}
+	results, err := PostgreSQL.UpsertManyReturning(replay, "label", labels, "name")
+	if err != nil {
+		t.Fatalf("UpsertManyReturning error: %v", err)
+	}
+	expected = `INSERT INTO "label" ("name","uses") VALUES ($1,$2),($3,$4) ` +
+		`ON CONFLICT ("name") DO UPDATE SET "uses"=EXCLUDED."uses" RETURNING "id", (xmax = 0) AS inserted, "name"`
+	if len(replay.queries) != 1 || replay.queries[0] != expected {
+		t.Errorf("expected %s, found %v", expected, replay.queries)
+	}
+	if !reflect.DeepEqual(results, []UpsertResult{{ID: 2, Inserted: false}, {ID: 3, Inserted: true}}) {
+		t.Errorf("unexpected results: %v", results)
+	}
+	if labels[0].ID != 2 || labels[1].ID != 3 {
+		t.Errorf("expected primary keys to be set, found %d and %d", labels[0].ID, labels[1].ID)
+	}
+
+	labels[0].ID, labels[1].ID = 0, 0
+	for _, replacement := range []string{
+		"select 2, 0, 'sql'",
+		"select 2, 0, 'sql' union all select 3, 1, 'go'",
+		"select 2, 0, 'sql' union all select 3, 1, 'sql'",
+	} {
+		replay.replacement = replacement
+		if _, err := PostgreSQL.UpsertManyReturning(replay, "label", labels, "name"); err == nil {
+			t.Errorf("%s: expected an error when the rows do not match the records", replacement)
+		}
+	}
+	if err := SQLite.UpsertMany(db, "label", labels); err == nil {
+		t.Errorf("expected an error without conflict columns")
+	}
+}
+
+func TestUpsertReplace(t *testing.T) {
+	once.Do(setup)
+
+	legacy := *SQLite
+	legacy.UpsertReplace = true
+	rec := &argsDB{}
+	if err := legacy.Upsert(rec, "label", &Label{Name: "go", Uses: 1}, "name"); err != nil {
+		t.Fatalf("Upsert error: %v", err)
+	}
+	if err := legacy.UpsertMany(rec, "label", []*Label{{Name: "a", Uses: 1}, {Name: "b", Uses: 2}}, "name"); err != nil {
+		t.Fatalf("UpsertMany error: %v", err)
+	}
+	expected := []string{
+		`INSERT OR REPLACE INTO "label" ("name","uses") VALUES (?,?)`,
+		`INSERT OR REPLACE INTO "label" ("name","uses") VALUES (?,?),(?,?)`,
+	}
+	if !reflect.DeepEqual(rec.queries, expected) {
+		t.Errorf("expected %q, found %q", expected, rec.queries)
+	}
+	if err := legacy.UpsertWhere(rec, "label", &Label{Name: "go"}, "uses > 0", "name"); err == nil {
+		t.Errorf("expected an error for a conflict predicate")
+	}
+	if err := legacy.Upsert(rec, "label", &Label{Name: "go"}, "title"); err == nil {
+		t.Errorf("expected an error for an unknown conflict column")
+	}
+
+	// the conflicting row is replaced
+	if _, err := db.Exec("create table label (id integer primary key, name text not null unique, uses integer not null)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table label")
+	for _, uses := range []int{1, 5} {
+		if err := legacy.Upsert(db, "label", &Label{Name: "go", Uses: uses}, "name"); err != nil {
+			t.Fatalf("Upsert error: %v", err)
+		}
+	}
+	var count, uses int
+	if err := db.QueryRow("select count(*), max(uses) from label").Scan(&count, &uses); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if count != 1 || uses != 5 {
+		t.Errorf("expected one row with 5 uses, found %d rows with %d", count, uses)
+	}
+}
+
+func TestSaveWith(t *testing.T) {
+	once.Do(setup)
+
+	returning := *SQLite
+	returning.UseReturningToGetID = true
+	for _, d := range []*Database{SQLite, &returning} {
+		// update, as Save does
+		if err := d.SaveWith(db, "account", &Account{Email: "a@a.com", Active: true}, SaveUpdate); err != nil {
+			t.Errorf("SaveWith error: %v", err)
+		}
+		if err := d.SaveWith(db, "product", &Product{ID: 7, Price: 1, Qty: 1}, SaveFail); err != nil {
+			t.Errorf("SaveWith error: %v", err)
+		}
+
+		// an existing row is left alone
+		existing := &Product{ID: 7, Price: 2, Qty: 2}
+		if err := d.SaveWith(db, "product", existing, SaveIgnore); err != nil {
+			t.Errorf("SaveWith error: %v", err)
+		}
+		loaded := new(Product)
+		if err := Load(db, "product", loaded, 7); err != nil {
+			t.Fatalf("Load error: %v", err)
+		}
+		if loaded.Price != 1 {
+			t.Errorf("expected the existing row to be kept, found price %d", loaded.Price)
+		}
+		if existing.Total != 0 {
+			t.Errorf("expected the ignored record to be unchanged, found total %d", existing.Total)
+		}
+
+		// or it is an error
+		if err := d.SaveWith(db, "product", existing, SaveFail); err == nil {
+			t.Errorf("expected an error inserting an existing row")
+		}
+		if err := d.Update(db, "product", existing); err != nil {
+			t.Errorf("Update error: %v", err)
+		}
+		if err := d.SaveWith(db, "product", existing, SaveMode(99)); err == nil {
+			t.Errorf("expected an error for an unknown mode")
+		}
+
+		// new rows are inserted and get their keys
+		fresh := &Product{Price: 3, Qty: 3}
+		if err := d.SaveWith(db, "product", fresh, SaveIgnore); err != nil {
+			t.Errorf("SaveWith error: %v", err)
+		}
+		if fresh.ID == 0 {
+			t.Errorf("expected a new primary key")
+		}
+		db.Exec("delete from product")
+		db.Exec("delete from account")
+	}
+
+	// each database has its own way of ignoring a conflict; the statements
+	// are only recorded, so no key is read back
+	postgres := *PostgreSQL
+	postgres.UseReturningToGetID = false
+	for _, test := range []struct {
+		d        *Database
+		expected string
+	}{
+		{&postgres, `INSERT INTO "product" ("id","price","qty") VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`},
+		{SQLite, `INSERT INTO "product" ("id","price","qty") VALUES (?,?,?) ON CONFLICT DO NOTHING`},
+		{MySQL, "INSERT IGNORE INTO `product` (`id`,`price`,`qty`) VALUES (?,?,?)"},
+	} {
+		rec := &argsDB{}
+		if err := test.d.SaveWith(rec, "product", &Product{ID: 7, Price: 1, Qty: 1}, SaveIgnore); err != nil {
+			t.Errorf("%s: SaveWith error: %v", test.d.Name, err)
+		}
+		if len(rec.queries) != 1 || rec.queries[0] != test.expected {
+			t.Errorf("%s: expected %s, found %v", test.d.Name, test.expected, rec.queries)
+		}
+	}
+	for _, d := range []*Database{MSSQL, QL} {
+		rec := &argsDB{}
+		if err := d.SaveWith(rec, "product", &Product{ID: 7, Price: 1, Qty: 1}, SaveIgnore); err == nil || len(rec.queries) != 0 {
+			t.Errorf("%s: expected an error and no statement, found %v and %v", d.Name, err, rec.queries)
+		}
+	}
+}
+
+type BillingAddress struct {
+	Street string `meddler:"street"`
+	City   string `meddler:"city"`
+}
+
+func (a BillingAddress) IsZero() bool {
+	return a.Street == "" && a.City == ""
+}
+
+type Customer struct {
+	ID   int64  `meddler:"id,pk"`
+	Name string `meddler:"name"`
+	BillingAddress
+}
+
+func TestAbsentEmbedded(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table customer (id integer primary key, name text, street text, city text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table customer")
+
+	for _, elt := range []*Customer{
+		{Name: "present", BillingAddress: BillingAddress{Street: "Main St 1", City: "Springfield"}},
+		{Name: "absent"},
+	} {
+		if err := Insert(db, "customer", elt); err != nil {
+			t.Fatalf("Insert error: %v", err)
+		}
+		var nulls int
+		if err := db.QueryRow("select count(*) from customer where id = ? and street is null and city is null", elt.ID).Scan(&nulls); err != nil {
+			t.Fatalf("DB error on query: %v", err)
+		}
+		if absent := elt.IsZero(); absent != (nulls == 1) {
+			t.Errorf("%s: expected null columns %v", elt.Name, absent)
+		}
+		loaded := new(Customer)
+		if err := Load(db, "customer", loaded, elt.ID); err != nil {
+			t.Fatalf("Load error: %v", err)
+		}
+		if *loaded != *elt {
+			t.Errorf("expected %v, found %v", elt, loaded)
+		}
+	}
+}
+
+func TestLoadOrdered(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	var lst []*Person
+	if err := LoadOrdered(db, "person", []int64{2, 99, 1, 2}, &lst); err != nil {
+		t.Fatalf("LoadOrdered error: %v", err)
+	}
+	if len(lst) != 4 {
+		t.Fatalf("expected 4 elements, found %d", len(lst))
+	}
+	if lst[0] == nil || lst[0].Name != "Bob" {
+		t.Errorf("expected Bob first, found %v", lst[0])
+	}
+	if lst[1] != nil {
+		t.Errorf("expected nil for a missing pk, found %v", lst[1])
+	}
+	if lst[2] == nil || lst[2].Name != "Alice" {
+		t.Errorf("expected Alice third, found %v", lst[2])
+	}
+	if lst[3] == nil || lst[3].Name != "Bob" {
+		t.Errorf("expected Bob last, found %v", lst[3])
+	}
+
+	if err := LoadOrdered(db, "person", nil, &lst); err != nil {
+		t.Fatalf("LoadOrdered error: %v", err)
+	}
+	if len(lst) != 0 {
+		t.Errorf("expected no elements, found %d", len(lst))
+	}
+
+	var wrong []Person
+	if err := LoadOrdered(db, "person", []int64{1}, &wrong); err == nil {
+		t.Errorf("expected an error for a slice of structs")
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestQuery(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	elt := new(Person)
+	if err := Query(db, elt, "select * from person where id = ?", 2); err != nil {
+		t.Fatalf("Query error on a struct: %v", err)
+	}
+	if elt.Name != "Bob" {
+		t.Errorf("expected Bob, found %v", elt)
+	}
+
+	var lst []*Person
+	if err := Query(db, &lst, "select * from person order by id"); err != nil {
+		t.Fatalf("Query error on a slice: %v", err)
+	}
+	if len(lst) != 2 || lst[0].Name != "Alice" || lst[1].Name != "Bob" {
+		t.Errorf("expected Alice and Bob, found %v", lst)
+	}
+
+	var count int
+	if err := Query(db, &count, "select count(*) from person"); err != nil {
+		t.Fatalf("Query error on a scalar: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected a count of 2, found %d", count)
+	}
+	var opened time.Time
+	if err := Query(db, &opened, "select opened from person where id = ?", 1); err != nil {
+		t.Fatalf("Query error on a time: %v", err)
+	}
+	if !opened.Equal(when) {
+		t.Errorf("expected %v, found %v", when, opened)
+	}
+	var raw []byte
+	if err := Query(db, &raw, "select name from person where id = ?", 1); err != nil {
+		t.Fatalf("Query error on bytes: %v", err)
+	}
+	if string(raw) != "Alice" {
+		t.Errorf("expected Alice, found %q", raw)
+	}
+	if err := Query(db, &count, "select id from person where id = ?", 99); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, found %v", err)
+	}
+	if err := Query(db, count, "select count(*) from person"); err == nil {
+		t.Errorf("expected an error for a non-pointer")
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestDeleteReturning(t *testing.T) {
+	once.Do(setup)
+
+	other := *SQLite
+	other.Name = "other"
+	for _, d := range []*Database{SQLite, &other} {
+		insertAliceBob(t)
+
+		elt := new(Person)
+		if err := d.DeleteReturning(db, "person", 2, elt); err != nil {
+			t.Fatalf("DeleteReturning error: %v", err)
+		}
+		if elt.ID != 2 || elt.Name != "Bob" || elt.Email != bob.Email {
+			t.Errorf("expected the deleted Bob, found %v", elt)
+		}
+		if found, err := LoadOK(db, "person", new(Person), 2); err != nil || found {
+			t.Errorf("expected Bob to be gone, found %v, %v", found, err)
+		}
+		if err := d.DeleteReturning(db, "person", 2, elt); err != sql.ErrNoRows {
+			t.Errorf("expected sql.ErrNoRows, found %v", err)
+		}
+		if found, err := LoadOK(db, "person", new(Person), 1); err != nil || !found {
+			t.Errorf("expected Alice to stay, found %v, %v", found, err)
+		}
+
+		db.Exec("delete from person")
 	}
 }
+
+type Page struct {
+	ID    int64  `meddler:"id,pk"`
+	Title string `meddler:"title"`
+	Views *int   `meddler:"views"`
+	ETag  string `meddler:"etag,etag"`
+}
+
+func TestETag(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table page (id integer primary key, title text, views integer, etag text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table page")
+
+	views := 3
+	elt := &Page{Title: "home", Views: &views}
+	if err := Insert(db, "page", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	first := elt.ETag
+	// the values are hashed in a defined encoding
+	sum := sha256.Sum256([]byte("title=s4:home\x00views=i3\x00"))
+	if first != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the hash of the encoded values, found %q", first)
+	}
+	loaded := new(Page)
+	if err := Load(db, "page", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.ETag != first {
+		t.Errorf("expected the stored etag %s, found %s", first, loaded.ETag)
+	}
+
+	// saving the same content keeps the etag
+	again := 3
+	loaded.Views = &again
+	if err := Update(db, "page", loaded); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+	if loaded.ETag != first {
+		t.Errorf("expected an unchanged etag, found %s", loaded.ETag)
+	}
+
+	// but any change is reflected
+	for _, change := range []func(p *Page){
+		func(p *Page) { p.Title = "start" },
+		func(p *Page) { p.Views = nil },
+	} {
+		before := loaded.ETag
+		change(loaded)
+		if err := Update(db, "page", loaded); err != nil {
+			t.Fatalf("Update error: %v", err)
+		}
+		if loaded.ETag == before {
+			t.Errorf("expected the etag to change")
+		}
+		var stored string
+		if err := db.QueryRow("select etag from page where id = ?", loaded.ID).Scan(&stored); err != nil {
+			t.Fatalf("DB error on query: %v", err)
+		}
+		if stored != loaded.ETag {
+			t.Errorf("expected %s to be stored, found %s", loaded.ETag, stored)
+		}
+	}
+
+	type BadETag struct {
+		ID   int64 `meddler:"id,pk"`
+		ETag int   `meddler:"etag,etag"`
+	}
+	if _, err := Columns(new(BadETag), true); err == nil {
+		t.Errorf("expected an error for an etag field that is not a string")
+	}
+}
+
+type beginnerDB struct {
+	*sql.DB
+	opts *sql.TxOptions
+}
+
+func (b *beginnerDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	b.opts = opts
+	return b.DB.BeginTx(ctx, opts)
+}
+
+func TestSnapshot(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	b := &beginnerDB{DB: db}
+	var people []*Person
+	ann := new(Person)
+	var snapshot *sql.Tx
+	err := Snapshot(b, func(tx DB) error {
+		var ok bool
+		if snapshot, ok = tx.(*sql.Tx); !ok {
+			t.Errorf("expected a transaction, found %T", tx)
+		}
+		if err := QueryAll(tx, &people, "select * from person order by id"); err != nil {
+			return err
+		}
+		return Load(tx, "person", ann, 1)
+	})
+	if err != nil {
+		t.Fatalf("Snapshot error: %v", err)
+	}
+	if b.opts == nil || b.opts.Isolation != sql.LevelRepeatableRead || !b.opts.ReadOnly {
+		t.Errorf("expected a read-only repeatable read transaction, found %+v", b.opts)
+	}
+	if len(people) != 2 || ann.Name != "Alice" {
+		t.Errorf("expected both people and Alice, found %v and %v", people, ann)
+	}
+	if snapshot != nil {
+		if err := snapshot.Rollback(); err != sql.ErrTxDone {
+			t.Errorf("expected the transaction to be finished, found %v", err)
+		}
+	}
+
+	failure := errors.New("failure")
+	if err := Snapshot(b, func(tx DB) error { return failure }); err != failure {
+		t.Errorf("expected the error from fn, found %v", err)
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestWithTransaction(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	var queries []string
+	d := *SQLite
+	d.QueryWrapper = func(ctx context.Context, op, query string, fn func() error) error {
+		queries = append(queries, query)
+		return fn()
+	}
+
+	opts := &TxOptions{DeferConstraints: true}
+	err := d.WithTransaction(db, opts, func(tx DB) error {
+		_, err := tx.Exec("delete from person where id = 1")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction error: %v", err)
+	}
+	expected := []string{"PRAGMA defer_foreign_keys = ON"}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("expected statements %v, found %v", expected, queries)
+	}
+
+	// an error rolls back
+	failure := errors.New("failure")
+	err = d.WithTransaction(db, nil, func(tx DB) error {
+		if _, err := tx.Exec("delete from person"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Errorf("expected the error from fn, found %v", err)
+	}
+	var count int
+	if err := db.QueryRow("select count(*) from person").Scan(&count); err != nil {
+		t.Fatalf("DB error counting people: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected one person to be left, found %d", count)
+	}
+
+	if err := MySQL.WithTransaction(db, opts, func(tx DB) error { return nil }); err == nil {
+		t.Errorf("expected an error deferring constraints in mysql")
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestProcessTx(t *testing.T) {
+	once.Do(setup)
+	defer db.Exec("delete from person")
+
+	d := *SQLite
+	d.LockRetryDelay = time.Millisecond
+
+	// a lock timeout is retried, and the work of the retry committed
+	attempts := 0
+	err := d.ProcessTx(context.Background(), db, func(tx DB) error {
+		attempts++
+		alice.ID = 0
+		if err := d.Insert(tx, "person", alice); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			return errors.New("database is locked")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ProcessTx error: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, found %d", attempts)
+	}
+	var count int
+	if err := db.QueryRow("select count(*) from person").Scan(&count); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected only the second attempt to be committed, found %d rows", count)
+	}
+
+	// other errors are returned at once, and retries are limited
+	failure := errors.New("failure")
+	attempts = 0
+	if err := d.ProcessTx(context.Background(), db, func(tx DB) error { attempts++; return failure }); err != failure || attempts != 1 {
+		t.Errorf("expected the error after 1 attempt, found %v after %d", err, attempts)
+	}
+	d.LockRetries = 2
+	attempts = 0
+	err = d.ProcessTx(context.Background(), db, func(tx DB) error { attempts++; return errors.New("database table is locked") })
+	if !d.IsLockTimeout(err) || attempts != 3 {
+		t.Errorf("expected a lock timeout after 3 attempts, found %v after %d", err, attempts)
+	}
+
+	if IsLockTimeout(errors.New("pq: could not serialize access due to concurrent update")) {
+		t.Errorf("expected a serialization failure not to be a lock timeout")
+	}
+	if !MySQL.IsLockTimeout(errors.New("Error 1205: Lock wait timeout exceeded; try restarting transaction")) {
+		t.Errorf("expected MySQL error 1205 to be a lock timeout")
+	}
+	if !PostgreSQL.IsLockTimeout(errors.New(`ERROR: could not obtain lock on row in relation "job" (SQLSTATE 55P03)`)) {
+		t.Errorf("expected a PostgreSQL lock_not_available error to be a lock timeout")
+	}
+}
+
+func TestWithTransactionOptions(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	b := &beginnerDB{DB: db}
+	opts := &TxOptions{TxOptions: sql.TxOptions{Isolation: sql.LevelSerializable}}
+	if err := WithTransaction(b, opts, func(tx DB) error { return nil }); err != nil {
+		t.Fatalf("WithTransaction error: %v", err)
+	}
+	if b.opts == nil || b.opts.Isolation != sql.LevelSerializable || b.opts.ReadOnly {
+		t.Errorf("expected serializable options to reach BeginTx, found %+v", b.opts)
+	}
+
+	// read-only transactions only read, and are finished afterwards
+	opts = &TxOptions{TxOptions: sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true}}
+	var readOnly *sql.Tx
+	var people []*Person
+	err := WithTransaction(b, opts, func(tx DB) error {
+		readOnly, _ = tx.(*sql.Tx)
+		return QueryAll(tx, &people, "select * from person order by id")
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction error: %v", err)
+	}
+	if b.opts.Isolation != sql.LevelReadCommitted || !b.opts.ReadOnly {
+		t.Errorf("expected read-only options to reach BeginTx, found %+v", b.opts)
+	}
+	if len(people) != 2 {
+		t.Errorf("expected both people, found %v", people)
+	}
+	if readOnly == nil {
+		t.Errorf("expected a transaction")
+	} else if err := readOnly.Rollback(); err != sql.ErrTxDone {
+		t.Errorf("expected the transaction to be finished, found %v", err)
+	}
+
+	db.Exec("delete from person")
+}
+
+type Quarters struct {
+	Region string `meddler:"region"`
+	Q1     int    `meddler:"q1"`
+	Q2     int    `meddler:"q2"`
+	Q3     int    `meddler:"q3"`
+	Q4     int    `meddler:"q4"`
+}
+
+func TestQueryRowPivot(t *testing.T) {
+	once.Do(setup)
+
+	quarters := []string{"q1", "q2", "q3", "q4"}
+	elt := &Quarters{Q3: 99}
+	if err := QueryRowPivot(db, elt, quarters, "select 'north' as region, 10 as q1, 20 as q2, 40 as q4"); err != nil {
+		t.Fatalf("QueryRowPivot error: %v", err)
+	}
+	if expected := (Quarters{Region: "north", Q1: 10, Q2: 20, Q4: 40}); *elt != expected {
+		t.Errorf("expected %v, found %v", expected, *elt)
+	}
+
+	// plain QueryRow leaves the missing field alone
+	elt.Q3 = 99
+	if err := QueryRow(db, elt, "select 'north' as region, 10 as q1"); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if elt.Q3 != 99 {
+		t.Errorf("expected QueryRow to keep Q3, found %d", elt.Q3)
+	}
+
+	if err := QueryRowPivot(db, elt, []string{"q5"}, "select 'north' as region"); err == nil {
+		t.Errorf("expected an error for an unmapped expected column")
+	}
+	if err := QueryRowPivot(db, elt, quarters, "select 'north' as region where 1 = 0"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, found %v", err)
+	}
+}
+
+type Country struct {
+	Code string `meddler:"code,natural"`
+	Name string `meddler:"name"`
+}
+
+func TestSaveNaturalKey(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table country (code text primary key, name text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table country")
+
+	elt := &Country{Code: "de", Name: "Germany"}
+	for _, name := range []string{"Germany", "Deutschland"} {
+		elt.Name = name
+		if err := SQLite.Save(db, "country", elt); err != nil {
+			t.Fatalf("Save error: %v", err)
+		}
+		var lst []*Country
+		if err := QueryAll(db, &lst, "select * from country"); err != nil {
+			t.Fatalf("QueryAll error: %v", err)
+		}
+		if len(lst) != 1 || *lst[0] != *elt {
+			t.Errorf("expected only %v, found %v", elt, lst)
+		}
+	}
+
+	if err := Save(db, "country", &Country{Name: "Nowhere"}); err == nil {
+		t.Errorf("expected an error for a zero natural key")
+	}
+}
+
+type UUID [16]byte
+
+func (u *UUID) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok || len(b) != len(u) {
+		return fmt.Errorf("cannot scan %T into a UUID", src)
+	}
+	copy(u[:], b)
+	return nil
+}
+
+func (u UUID) Value() (driver.Value, error) {
+	return u[:], nil
+}
+
+type Doc struct {
+	ID    UUID   `meddler:"id,pk"`
+	Title string `meddler:"title"`
+}
+
+type BigRow struct {
+	ID int64 `meddler:"id,pk"`
+	N  int   `meddler:"n"`
+}
+
+func TestReturningPrimaryKeyTypes(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table doc (id blob primary key default (randomblob(16)), title text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table doc")
+	if _, err := db.Exec("create table bigrow (id integer primary key, n integer)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table bigrow")
+
+	returning := *SQLite
+	returning.UseReturningToGetID = true
+
+	// a key beyond the range of 32 bits
+	if _, err := db.Exec("insert into bigrow (id, n) values (5000000000, 0)"); err != nil {
+		t.Fatalf("DB error on insert: %v", err)
+	}
+	big := &BigRow{N: 1}
+	if err := returning.Insert(db, "bigrow", big); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if big.ID != 5000000001 {
+		t.Errorf("expected id 5000000001, found %d", big.ID)
+	}
+
+	// a UUID filled in by the database
+	doc := &Doc{Title: "draft"}
+	if err := returning.Insert(db, "doc", doc); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if doc.ID == (UUID{}) {
+		t.Fatalf("expected a new UUID")
+	}
+	doc.Title = "final"
+	if err := returning.Save(db, "doc", doc); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	loaded := &Doc{ID: doc.ID}
+	if err := returning.RefreshColumns(db, "doc", loaded, "title"); err != nil {
+		t.Fatalf("RefreshColumns error: %v", err)
+	}
+	if *loaded != *doc {
+		t.Errorf("expected %v, found %v", doc, loaded)
+	}
+
+	if err := SQLite.Insert(db, "doc", &Doc{Title: "lost"}); err == nil {
+		t.Errorf("expected an error reading back a UUID without RETURNING")
+	}
+	if err := returning.Update(db, "doc", &Doc{Title: "nobody"}); err == nil {
+		t.Errorf("expected an error updating with a zero UUID")
+	}
+
+	type BadKey struct {
+		ID float64 `meddler:"id,pk"`
+	}
+	if _, err := Columns(new(BadKey), true); err == nil {
+		t.Errorf("expected an error for a float primary key")
+	}
+}
+
+func TestExistsMany(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	exists, err := ExistsMany(db, "person", []int64{2, 7, 1}, new(Person))
+	if err != nil {
+		t.Fatalf("ExistsMany error: %v", err)
+	}
+	if expected := map[int64]bool{1: true, 2: true, 7: false}; !reflect.DeepEqual(exists, expected) {
+		t.Errorf("expected %v, found %v", expected, exists)
+	}
+
+	exists, err = ExistsMany(db, "person", nil, new(Person))
+	if err != nil {
+		t.Fatalf("ExistsMany error: %v", err)
+	}
+	if exists == nil || len(exists) != 0 {
+		t.Errorf("expected an empty map, found %#v", exists)
+	}
+
+	if _, err := ExistsMany(db, "person", []int64{1}, new(Quarters)); err == nil {
+		t.Errorf("expected an error for a model without a primary key")
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestBuildQueries(t *testing.T) {
+	once.Do(setup)
+
+	labels := []*Label{{Name: "go", Uses: 1}, {Name: "sql", Uses: 2}}
+	q, args, err := PostgreSQL.BuildInsertMany("label", labels)
+	if err != nil {
+		t.Fatalf("BuildInsertMany error: %v", err)
+	}
+	expected := `INSERT INTO "label" ("name","uses") VALUES ($1,$2),($3,$4)`
+	if q != expected || !reflect.DeepEqual(args, []interface{}{"go", 1, "sql", 2}) {
+		t.Errorf("expected %s %v, found %s %v", expected, []interface{}{"go", 1, "sql", 2}, q, args)
+	}
+
+	q, args, err = PostgreSQL.BuildUpsert("label", labels, "name")
+	if err != nil {
+		t.Fatalf("BuildUpsert error: %v", err)
+	}
+	expected = `INSERT INTO "label" ("name","uses") VALUES ($1,$2),($3,$4) ON CONFLICT ("name") DO UPDATE SET "uses"=EXCLUDED."uses"`
+	if q != expected || len(args) != 4 {
+		t.Errorf("expected %s with 4 args, found %s %v", expected, q, args)
+	}
+
+	q, args, err = MySQL.BuildDeleteMany("person", []int64{3, 5}, new(Person))
+	if err != nil {
+		t.Fatalf("BuildDeleteMany error: %v", err)
+	}
+	expected = "DELETE FROM `person` WHERE `id` IN (?,?)"
+	if q != expected || !reflect.DeepEqual(args, []interface{}{int64(3), int64(5)}) {
+		t.Errorf("expected %s [3 5], found %s %v", expected, q, args)
+	}
+
+	if q, _, err := BuildInsertMany("label", []*Label{}); err != nil || q != "" {
+		t.Errorf("expected an empty query for no records, found %q, %v", q, err)
+	}
+	if _, _, err := BuildDeleteMany("person", []int64{1}, new(Quarters)); err == nil {
+		t.Errorf("expected an error for a model without a primary key")
+	}
+
+	// the executing functions run what the builders return
+	insertAliceBob(t)
+	n, err := SQLite.DeleteMany(db, "person", []int64{2, 7}, new(Person))
+	if err != nil {
+		t.Fatalf("DeleteMany error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 row deleted, found %d", n)
+	}
+	exists, err := ExistsMany(db, "person", []int64{1, 2}, new(Person))
+	if err != nil {
+		t.Fatalf("ExistsMany error: %v", err)
+	}
+	if !exists[1] || exists[2] {
+		t.Errorf("expected only Bob to be deleted, found %v", exists)
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestDeleteByValues(t *testing.T) {
+	once.Do(setup)
+
+	q, args, err := PostgreSQL.BuildDeleteByValues("person", "name", []interface{}{"Alice", "Carol"})
+	if err != nil {
+		t.Fatalf("BuildDeleteByValues error: %v", err)
+	}
+	expected := `DELETE FROM "person" WHERE "name" IN ($1,$2)`
+	if q != expected || !reflect.DeepEqual(args, []interface{}{"Alice", "Carol"}) {
+		t.Errorf("expected %s [Alice Carol], found %s %v", expected, q, args)
+	}
+	if _, _, err := MySQL.BuildDeleteByValues("person", "na`me", []interface{}{1}); err == nil {
+		t.Errorf("expected an error for an invalid column name")
+	}
+
+	insertAliceBob(t)
+	defer db.Exec("delete from person")
+	n, err := SQLite.DeleteByValues(db, "person", "name", nil)
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing to be deleted, found %d, %v", n, err)
+	}
+	n, err = SQLite.DeleteByValues(db, "person", "name", []interface{}{"Alice", "Carol"})
+	if err != nil {
+		t.Fatalf("DeleteByValues error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 row deleted, found %d", n)
+	}
+	exists, err := ExistsMany(db, "person", []int64{1, 2}, new(Person))
+	if err != nil {
+		t.Fatalf("ExistsMany error: %v", err)
+	}
+	if exists[1] || !exists[2] {
+		t.Errorf("expected only Alice to be deleted, found %v", exists)
+	}
+}
+
+func TestQueryAllType(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+	defer db.Exec("delete from person")
+
+	result, err := QueryAllType(db, reflect.TypeOf(Person{}), "select * from person order by id")
+	if err != nil {
+		t.Fatalf("QueryAllType error: %v", err)
+	}
+	lst, ok := result.([]*Person)
+	if !ok {
+		t.Fatalf("expected a []*Person, found %T", result)
+	}
+	if len(lst) != 2 || lst[0].Name != "Alice" || lst[1].Name != "Bob" {
+		t.Errorf("unexpected results: %v", lst)
+	}
+
+	if _, err := QueryAllType(db, reflect.TypeOf(&Person{}), "select * from person"); err == nil {
+		t.Errorf("expected an error for a pointer type")
+	}
+}
+
+func TestQueryAllWithWindowTotal(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	var page []*Person
+	total, err := QueryAllWithWindowTotal(db, &page, "total_count", "select *, count(*) over () as total_count from person order by id limit 1")
+	if err != nil {
+		t.Fatalf("QueryAllWithWindowTotal error: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("expected a total of 2, found %d", total)
+	}
+	if len(page) != 1 || page[0].Name != "Alice" || page[0].Email != "alice@alice.com" {
+		t.Errorf("expected a page holding Alice, found %v", page)
+	}
+
+	page = nil
+	total, err = QueryAllWithWindowTotal(db, &page, "total_count", "select *, count(*) over () as total_count from person where id > 5")
+	if err != nil || total != 0 || len(page) != 0 {
+		t.Errorf("expected no rows and a total of 0, found %v, %d, %v", page, total, err)
+	}
+
+	if _, err := QueryAllWithWindowTotal(db, &page, "total_count", "select * from person"); err == nil {
+		t.Errorf("expected an error for a missing total column")
+	}
+	if _, err := QueryAllWithWindowTotal(db, &page, "name", "select * from person"); err == nil {
+		t.Errorf("expected an error for a total column mapped to a field")
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestForEach(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	total := 0
+	var names []string
+	err := ForEach(db, new(Person), func(rec interface{}) error {
+		p := rec.(*Person)
+		total += p.Age
+		names = append(names, p.Name)
+		return nil
+	}, "select * from person order by id")
+	if err != nil {
+		t.Fatalf("ForEach error: %v", err)
+	}
+	if total != alice.Age+bob.Age || strings.Join(names, ",") != "Alice,Bob" {
+		t.Errorf("unexpected total %d of %v", total, names)
+	}
+
+	// the first error stops the iteration
+	failure := errors.New("failure")
+	calls := 0
+	err = ForEach(db, new(Person), func(rec interface{}) error {
+		calls++
+		return failure
+	}, "select * from person")
+	if err != failure || calls != 1 {
+		t.Errorf("expected one call and the error from fn, found %d calls and %v", calls, err)
+	}
+
+	db.Exec("delete from person")
+}
+
+type Delivery struct {
+	ID      int64  `meddler:"id,pk"`
+	Key     string `meddler:"idem_key"`
+	Payload string `meddler:"payload"`
+}
+
+func TestInsertIdempotent(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table delivery (id integer primary key, idem_key text not null unique, payload text not null unique)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table delivery")
+
+	first := &Delivery{Key: "evt-1", Payload: "a"}
+	inserted, err := SQLite.InsertIdempotent(db, "delivery", "idem_key", first)
+	if err != nil || !inserted {
+		t.Fatalf("expected the first delivery to be inserted, found %v, %v", inserted, err)
+	}
+
+	// the same event delivered again is not an error
+	again := &Delivery{Key: "evt-1", Payload: "b"}
+	inserted, err = SQLite.InsertIdempotent(db, "delivery", "idem_key", again)
+	if err != nil || inserted {
+		t.Errorf("expected the repeated delivery to be skipped, found %v, %v", inserted, err)
+	}
+
+	// a violation on another column is still reported
+	inserted, err = SQLite.InsertIdempotent(db, "delivery", "idem_key", &Delivery{Key: "evt-2", Payload: "a"})
+	if err == nil || inserted {
+		t.Errorf("expected an error for a duplicate payload, found %v, %v", inserted, err)
+	} else if !SQLite.IsUniqueViolation(err) {
+		t.Errorf("expected %v to be a unique violation", err)
+	}
+
+	var count int
+	if err := db.QueryRow("select count(*) from delivery").Scan(&count); err != nil || count != 1 {
+		t.Errorf("expected 1 delivery, found %d, %v", count, err)
+	}
+
+	// without ON CONFLICT, the key is looked up after a unique violation
+	other := *SQLite
+	other.Name = "other"
+	inserted, err = other.InsertIdempotent(db, "delivery", "idem_key", &Delivery{Key: "evt-1", Payload: "c"})
+	if err != nil || inserted {
+		t.Errorf("expected the repeated delivery to be skipped, found %v, %v", inserted, err)
+	}
+	inserted, err = other.InsertIdempotent(db, "delivery", "idem_key", &Delivery{Key: "evt-3", Payload: "a"})
+	if err == nil || inserted {
+		t.Errorf("expected an error for a duplicate payload, found %v, %v", inserted, err)
+	}
+	inserted, err = other.InsertIdempotent(db, "delivery", "idem_key", &Delivery{Key: "evt-3", Payload: "c"})
+	if err != nil || !inserted {
+		t.Errorf("expected a new delivery to be inserted, found %v, %v", inserted, err)
+	}
+	db.Exec("delete from delivery where idem_key = 'evt-3'")
+
+	if _, err := SQLite.InsertIdempotent(db, "delivery", "missing", &Delivery{Key: "evt-3"}); err == nil {
+		t.Errorf("expected an error for an unknown key column")
+	}
+	if IsUniqueViolation(errors.New("no such table: delivery")) || IsUniqueViolation(nil) {
+		t.Errorf("expected other errors not to be unique violations")
+	}
+	if !PostgreSQL.IsUniqueViolation(&dbErr{msg: "meddler.Insert", err: errors.New(`pq: duplicate key value violates unique constraint "delivery_idem_key_key"`)}) {
+		t.Errorf("expected a PostgreSQL unique violation to be recognized")
+	}
+}
+
+type Writer struct {
+	ID    int64  `meddler:"id,pk"`
+	Name  string `meddler:"name"`
+	Books []Book `meddler:"book,hasmany=author_id"`
+}
+
+func TestLoadWithRelations(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table author (id integer primary key, name text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table author")
+	if _, err := db.Exec("create table book (id integer primary key, author_id integer, editor_id integer, title text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table book")
+	db.Exec("insert into author (id, name) values (1, 'Ann'), (2, 'Ben')")
+	db.Exec("insert into book (id, author_id, editor_id, title) values (3, 1, 2, 'Second'), (2, 1, 2, 'First'), (4, 2, 1, 'Other')")
+
+	writer := new(Writer)
+	if err := SQLite.LoadWithRelations(db, "author", writer, 1); err != nil {
+		t.Fatalf("LoadWithRelations error: %v", err)
+	}
+	expected := []Book{{ID: 2, AuthorID: 1, EditorID: 2, Title: "First"}, {ID: 3, AuthorID: 1, EditorID: 2, Title: "Second"}}
+	if writer.Name != "Ann" || !reflect.DeepEqual(writer.Books, expected) {
+		t.Errorf("expected Ann with %v, found %s with %v", expected, writer.Name, writer.Books)
+	}
+
+	// the related rows are not columns
+	if columns, err := Columns(writer, true); err != nil || !reflect.DeepEqual(columns, []string{"id", "name"}) {
+		t.Errorf("expected columns id and name, found %v (%v)", columns, err)
+	}
+
+	db.Exec("delete from book where author_id = 2")
+	writer = new(Writer)
+	if err := SQLite.LoadWithRelations(db, "author", writer, 2); err != nil {
+		t.Fatalf("LoadWithRelations error: %v", err)
+	}
+	if writer.Books == nil || len(writer.Books) != 0 {
+		t.Errorf("expected an empty slice, found %#v", writer.Books)
+	}
+
+	type Shelf struct {
+		ID    int64  `meddler:"id,pk"`
+		Books []Book `meddler:"book,json,hasmany=author_id"`
+	}
+	if err := SQLite.LoadWithRelations(db, "author", new(Shelf), 1); err == nil {
+		t.Errorf("expected an error for a hasmany option with other options")
+	}
+	type Pile struct {
+		ID    int64 `meddler:"id,pk"`
+		Books Book  `meddler:"book,hasmany=author_id"`
+	}
+	if err := SQLite.LoadWithRelations(db, "author", new(Pile), 1); err == nil {
+		t.Errorf("expected an error for a hasmany option on a field that is not a slice")
+	}
+}
+
+type Paper struct {
+	ID    string `meddler:"id,pk"`
+	Title string `meddler:"title"`
+}
+
+func TestPKGenerator(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table paper (id text primary key, title text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table paper")
+
+	d := *SQLite
+	n := 0
+	d.PKGenerator = func(model interface{}) (interface{}, error) {
+		n++
+		return fmt.Sprintf("00000000-0000-4000-8000-%012d", n), nil
+	}
+	doc := &Paper{Title: "first"}
+	if err := d.Insert(db, "paper", doc); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if doc.ID != "00000000-0000-4000-8000-000000000001" {
+		t.Errorf("expected a generated primary key, found %q", doc.ID)
+	}
+	loaded := new(Paper)
+	if err := db.QueryRow("select id, title from paper").Scan(&loaded.ID, &loaded.Title); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if *loaded != *doc {
+		t.Errorf("expected %v, found %v", doc, loaded)
+	}
+
+	d.PKGenerator = func(model interface{}) (interface{}, error) { return 42, nil }
+	if err := d.Insert(db, "paper", &Paper{Title: "second"}); err == nil {
+		t.Errorf("expected an error for a generated key of the wrong type")
+	}
+	d.PKGenerator = func(model interface{}) (interface{}, error) { return "", nil }
+	if err := d.Insert(db, "paper", &Paper{Title: "third"}); err == nil {
+		t.Errorf("expected an error for a zero generated key")
+	}
+
+	// integer keys take other integers, but not truncated floats
+	d.PKGenerator = func(model interface{}) (interface{}, error) { return 7.5, nil }
+	if err := d.generatePrimaryKey(new(Label), "id"); err == nil {
+		t.Errorf("expected an error for a float generated key")
+	}
+	d.PKGenerator = func(model interface{}) (interface{}, error) { return int32(7), nil }
+	label := new(Label)
+	if err := d.generatePrimaryKey(label, "id"); err != nil || label.ID != 7 {
+		t.Errorf("expected the key 7, found %d, %v", label.ID, err)
+	}
+}
+
+func TestQueryAllMap(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	var byName map[string]*Person
+	if err := QueryAllMap(db, "name", &byName, "select * from person"); err != nil {
+		t.Fatalf("QueryAllMap error: %v", err)
+	}
+	if len(byName) != 2 || byName["Alice"] == nil || byName["Alice"].ID != 1 || byName["Bob"] == nil || byName["Bob"].ID != 2 {
+		t.Errorf("unexpected map %v", byName)
+	}
+
+	byID := map[int64]*Person{}
+	if err := QueryAllMap(db, "id", &byID, "select * from person where id = ?", 2); err != nil {
+		t.Fatalf("QueryAllMap error: %v", err)
+	}
+	if len(byID) != 1 || byID[2] == nil || byID[2].Name != "Bob" {
+		t.Errorf("unexpected map %v", byID)
+	}
+
+	if err := QueryAllMap(db, "nickname", &byName, "select * from person"); err == nil {
+		t.Errorf("expected an error for an unknown key column")
+	}
+	if err := QueryAllMap(db, "id", &byName, "select * from person"); err == nil {
+		t.Errorf("expected an error for a key column of the wrong type")
+	}
+	if err := QueryAllMap(db, "Age", &map[int]*Person{}, "select id, name, 30 as Age from person"); err == nil {
+		t.Errorf("expected an error for a duplicate key")
+	}
+
+	// the other policies keep one of the rows with the same key
+	d := *SQLite
+	d.DuplicateKeys = DuplicateKeysKeepFirst
+	byAge := map[int]*Person{}
+	if err := d.QueryAllMap(db, "Age", &byAge, "select id, name, 30 as Age from person order by id"); err != nil {
+		t.Fatalf("QueryAllMap error keeping the first row: %v", err)
+	}
+	if len(byAge) != 1 || byAge[30] == nil || byAge[30].Name != "Alice" {
+		t.Errorf("expected Alice to be kept, found %v", byAge)
+	}
+	d.DuplicateKeys = DuplicateKeysKeepLast
+	byAge = map[int]*Person{}
+	if err := d.QueryAllMap(db, "Age", &byAge, "select id, name, 30 as Age from person order by id"); err != nil {
+		t.Fatalf("QueryAllMap error keeping the last row: %v", err)
+	}
+	if len(byAge) != 1 || byAge[30] == nil || byAge[30].Name != "Bob" {
+		t.Errorf("expected Bob to be kept, found %v", byAge)
+	}
+
+	db.Exec("delete from person")
+}
+
+// argsDB records the statements and arguments given to Exec, and runs
+// nothing, reporting one affected row
+type argsDB struct {
+	DB
+	queries []string
+	args    [][]interface{}
+}
+
+func (a *argsDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	a.queries = append(a.queries, query)
+	a.args = append(a.args, args)
+	return driver.RowsAffected(1), nil
+}
+
+func TestStringKeys(t *testing.T) {
+	once.Do(setup)
+
+	type Tag struct {
+		ID    string `meddler:"id,pk"`
+		Label string `meddler:"label"`
+	}
+
+	// functions that handle several records take any kind of key
+	rec := &argsDB{}
+	tags := []*Tag{{ID: "a", Label: "one"}, {ID: "b", Label: "two"}}
+	if err := PostgreSQL.InsertManyUnnest(rec, "tag", tags); err != nil {
+		t.Errorf("InsertManyUnnest error: %v", err)
+	}
+	if err := PostgreSQL.UpdateMany(rec, "tag", tags); err != nil {
+		t.Errorf("UpdateMany error: %v", err)
+	}
+	if len(rec.args) != 2 || !reflect.DeepEqual(rec.args[1], []interface{}{"a", "one", "b", "two"}) {
+		t.Errorf("unexpected args: %v", rec.args)
+	}
+	if err := PostgreSQL.UpdateMany(rec, "tag", []*Tag{{Label: "none"}}); err == nil {
+		t.Errorf("expected an error for a record without a key")
+	}
+
+	// functions that take or return int64 keys refuse other keys
+	for op, err := range map[string]error{
+		"Load":                SQLite.Load(db, "tag", new(Tag), 1),
+		"LoadOrdered":         SQLite.LoadOrdered(db, "tag", []int64{1}, new([]*Tag)),
+		"DeleteReturning":     SQLite.DeleteReturning(db, "tag", 1, new(Tag)),
+		"UpsertManyReturning": func() error { _, err := PostgreSQL.UpsertManyReturning(rec, "tag", tags, "id"); return err }(),
+	} {
+		if err == nil || !strings.Contains(err.Error(), "is not an integer") {
+			t.Errorf("%s: expected an error for a string key, found %v", op, err)
+		}
+	}
+}
+
+func TestInsertManyUnnest(t *testing.T) {
+	var people []*Person
+	for i := 0; i < 500; i++ {
+		people = append(people, &Person{Name: fmt.Sprintf("Person %d", i), Email: `a"b\c`, Age: i % 3, Opened: when})
+	}
+	rec := &argsDB{}
+	if err := PostgreSQL.InsertManyUnnest(rec, "person", people); err != nil {
+		t.Fatalf("InsertManyUnnest error: %v", err)
+	}
+	expected := `INSERT INTO "person" ("name","Email","Age","opened","closed","updated","height") ` +
+		`SELECT * FROM unnest($1::text[],$2::text[],$3::bigint[],$4::timestamptz[],$5::timestamptz[],$6::timestamptz[],$7::bigint[])`
+	if len(rec.queries) != 1 || rec.queries[0] != expected {
+		t.Fatalf("expected %s, found %v", expected, rec.queries)
+	}
+	args := rec.args[0]
+	if len(args) != 7 {
+		t.Fatalf("expected one argument per column, found %d", len(args))
+	}
+	name := args[0].(string)
+	if !strings.HasPrefix(name, `{"Person 0","Person 1",`) || strings.Count(name, ",") != 499 {
+		t.Errorf("unexpected name array %.60s...", name)
+	}
+	if email := args[1].(string); !strings.HasPrefix(email, `{"a\"b\\c",`) {
+		t.Errorf("expected escaped emails, found %.60s...", email)
+	}
+	if age := args[2].(string); !strings.HasPrefix(age, `{NULL,"1","2",NULL,`) {
+		t.Errorf("expected zero ages as nulls, found %.60s...", age)
+	}
+	if closed := args[4].(string); !strings.HasPrefix(closed, `{NULL,NULL,`) {
+		t.Errorf("expected null close times, found %.60s...", closed)
+	}
+
+	if got := pgArrayLiteral([]interface{}{[]byte{0xde, 0xad}, true, 1.5}); got != `{"\\xdead","true","1.5"}` {
+		t.Errorf("unexpected array literal %s", got)
+	}
+}
+
+func TestMaxQueryLength(t *testing.T) {
+	once.Do(setup)
+
+	var people []*Person
+	for i := 0; i < 50; i++ {
+		people = append(people, &Person{Name: fmt.Sprintf("Person %d", i), Email: "p@p.com", Opened: when})
+	}
+	rec := &recordingDB{DB: db}
+	limited := *SQLite
+	limited.MaxQueryLength = 500
+	err := limited.InsertMany(rec, "person", people)
+	if err == nil || !strings.Contains(err.Error(), "MaxQueryLength") {
+		t.Errorf("expected an error for a long statement, found %v", err)
+	}
+	if len(rec.queries) != 0 {
+		t.Errorf("expected the statement not to be run, found %v", rec.queries)
+	}
+
+	// shorter statements are run
+	if err := limited.InsertMany(rec, "person", people[:2]); err != nil {
+		t.Errorf("InsertMany error: %v", err)
+	}
+	if len(rec.queries) != 1 {
+		t.Errorf("expected one statement to be run, found %d", len(rec.queries))
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestInsertMany(t *testing.T) {
+	once.Do(setup)
+
+	height := 65
+	people := []*Person{
+		{Name: "Alice", Email: "alice@alice.com", Age: 32, Opened: when, Height: &height},
+		{Name: "Bob", Email: "bob@bob.com", Opened: when},
+	}
+	if err := InsertMany(db, "person", people); err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+
+	// nulls only in the rows that have them
+	var lst []*Person
+	if err := QueryAll(db, &lst, "select * from person order by name"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if len(lst) != 2 {
+		t.Fatalf("expected 2 rows, found %d", len(lst))
+	}
+	if lst[0].Height == nil || *lst[0].Height != 65 || lst[0].Age != 32 {
+		t.Errorf("expected Alice to keep her height and age, found %v and %d", lst[0].Height, lst[0].Age)
+	}
+	var nulls int
+	if err := db.QueryRow("select count(*) from person where height is null and Age is null").Scan(&nulls); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if nulls != 1 || lst[1].Height != nil {
+		t.Errorf("expected exactly Bob to have null height and age, found %d rows", nulls)
+	}
+	db.Exec("delete from person")
+
+	// placeholders are numbered across rows
+	var query string
+	pg := *PostgreSQL
+	pg.QueryWrapper = func(ctx context.Context, op, q string, fn func() error) error {
+		query = q
+		return fn()
+	}
+	if err := pg.InsertMany(&argsDB{}, "person", people); err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+	if !strings.HasSuffix(query, "VALUES ($1,$2,$3,$4,$5,$6,$7),($8,$9,$10,$11,$12,$13,$14)") {
+		t.Errorf("unexpected query: %s", query)
+	}
+
+	// explicit keys are inserted, but must be given for all records
+	people[0].ID, people[1].ID = 10, 11
+	if err := InsertMany(db, "person", people); err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+	if err := Load(db, "person", new(Person), 11); err != nil {
+		t.Errorf("Load error: %v", err)
+	}
+	people[1].ID = 0
+	if err := InsertMany(db, "person", people); err == nil {
+		t.Errorf("expected an error with mixed primary keys")
+	}
+	if err := InsertMany(db, "person", people[0]); err == nil {
+		t.Errorf("expected an error for a non-slice")
+	}
+
+	// records that cannot be used are errors rather than panics
+	for _, src := range []interface{}{
+		[]interface{}{&Person{Name: "Carol"}, nil},
+		[]interface{}{Person{Name: "Carol"}},
+		[]*Person{{Name: "Carol"}, nil},
+	} {
+		rec := &argsDB{}
+		if err := InsertMany(rec, "person", src); err == nil || len(rec.queries) != 0 {
+			t.Errorf("expected an error and no statement for %#v, found %v and %v", src, err, rec.queries)
+		}
+		if err := UpdateMany(rec, "person", src); err == nil {
+			t.Errorf("expected an UpdateMany error for %#v", src)
+		}
+	}
+	db.Exec("delete from person")
+}
+
+func TestInsertManyStringKey(t *testing.T) {
+	once.Do(setup)
+
+	type Tag struct {
+		ID    string `meddler:"id,pk"`
+		Label string `meddler:"label"`
+	}
+	if _, err := db.Exec("create table tag (id text primary key default (lower(hex(randomblob(8)))), label text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table tag")
+
+	// the built-in dialects chunk the records by MaxParams
+	if SQLite.MaxParams == 0 {
+		t.Fatalf("expected SQLite to limit the parameters per statement")
+	}
+	if err := SQLite.InsertMany(db, "tag", []*Tag{{ID: "a", Label: "one"}, {ID: "b", Label: "two"}}); err != nil {
+		t.Fatalf("InsertMany error: %v", err)
+	}
+	if err := SQLite.InsertMany(db, "tag", []*Tag{{Label: "three"}}); err != nil {
+		t.Fatalf("InsertMany error with an empty key: %v", err)
+	}
+	if err := SQLite.UpsertMany(db, "tag", []*Tag{{ID: "a", Label: "uno"}}, "id"); err != nil {
+		t.Fatalf("UpsertMany error: %v", err)
+	}
+	if err := SQLite.InsertMany(db, "tag", []*Tag{{ID: "c"}, {Label: "mixed"}}); err == nil {
+		t.Errorf("expected an error with mixed primary keys")
+	}
+
+	var lst []*Tag
+	if err := SQLite.QueryAll(db, &lst, "select * from tag where id in ('a', 'b') order by id"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if len(lst) != 2 || *lst[0] != (Tag{ID: "a", Label: "uno"}) || *lst[1] != (Tag{ID: "b", Label: "two"}) {
+		t.Errorf("unexpected rows: %v", lst)
+	}
+	var generated int
+	if err := db.QueryRow("select count(*) from tag where label = 'three' and length(id) = 16").Scan(&generated); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if generated != 1 {
+		t.Errorf("expected the empty key to be filled in by the database")
+	}
+}
+
+// sequenceDB stands in for a PostgreSQL sequence, which SQLite lacks
+type sequenceDB struct {
+	DB
+	query string
+	args  []interface{}
+}
+
+func (s *sequenceDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	s.query, s.args = query, args
+	return s.DB.Query("with recursive s(n) as (select 1 union all select n+1 from s where n < ?) select n+99 from s", args[1])
+}
+
+func TestNextIDs(t *testing.T) {
+	once.Do(setup)
+
+	seq := &sequenceDB{DB: db}
+	ids, err := PostgreSQL.NextIDs(seq, "person_id_seq", 3)
+	if err != nil {
+		t.Fatalf("NextIDs error: %v", err)
+	}
+	if expected := "SELECT nextval($1) FROM generate_series(1, $2)"; seq.query != expected {
+		t.Errorf("expected %s, found %s", expected, seq.query)
+	}
+	if !reflect.DeepEqual(seq.args, []interface{}{"person_id_seq", 3}) {
+		t.Errorf("unexpected args: %v", seq.args)
+	}
+	if !reflect.DeepEqual(ids, []int64{100, 101, 102}) {
+		t.Errorf("unexpected ids: %v", ids)
+	}
+
+	if ids, err := PostgreSQL.NextIDs(seq, "person_id_seq", 0); err != nil || len(ids) != 0 {
+		t.Errorf("expected no ids, found %v (%v)", ids, err)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+	defer db.Exec("delete from person")
+
+	rec := &recordingDB{DB: db}
+	before := time.Now().Add(-time.Second)
+	if err := SQLite.Touch(rec, "person", 2, "updated", new(Person)); err != nil {
+		t.Fatalf("Touch error: %v", err)
+	}
+	expected := []string{`UPDATE "person" SET "updated"=? WHERE "id"=?`}
+	if !reflect.DeepEqual(rec.queries, expected) {
+		t.Errorf("expected %q, found %q", expected, rec.queries)
+	}
+	p := new(Person)
+	if err := SQLite.Load(db, "person", p, 2); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if p.Updated == nil || p.Updated.Before(before) || p.Name != "Bob" {
+		t.Errorf("expected Bob to be touched, found %v", p)
+	}
+	if err := SQLite.Touch(db, "person", 1, "opened", new(Person)); err != nil {
+		t.Errorf("Touch error: %v", err)
+	}
+
+	if err := SQLite.Touch(db, "person", 99, "updated", new(Person)); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing row, found %v", err)
+	}
+	for _, column := range []string{"name", "nosuchcolumn", "id"} {
+		if err := SQLite.Touch(db, "person", 1, column, new(Person)); err == nil {
+			t.Errorf("expected an error touching column %s", column)
+		}
+	}
+
+	// MySQL reports no affected rows when the time did not change, so
+	// the row is looked up instead
+	unchanged := &unchangedDB{DB: db}
+	if err := MySQL.Touch(unchanged, "person", 1, "updated", new(Person)); err != nil {
+		t.Errorf("Touch error for an unchanged row: %v", err)
+	}
+	if err := MySQL.Touch(unchanged, "person", 99, "updated", new(Person)); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a missing row, found %v", err)
+	}
+}
+
+// unchangedDB runs nothing for Exec, reporting that no rows were affected
+type unchangedDB struct {
+	DB
+}
+
+func (u *unchangedDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func TestUpdateOnlyPrimaryKey(t *testing.T) {
+	once.Do(setup)
+
+	type Marker struct {
+		ID int64 `meddler:"id,pk"`
+	}
+	rec := &argsDB{}
+	err := SQLite.Update(rec, "marker", &Marker{ID: 1})
+	if err == nil || !strings.Contains(err.Error(), "no columns to update") {
+		t.Errorf("expected an error for a record without columns to update, found %v", err)
+	}
+
+	skipping := *SQLite
+	skipping.SkipEmptyUpdates = true
+	if err := skipping.Update(rec, "marker", &Marker{ID: 1}); err != nil {
+		t.Errorf("Update error: %v", err)
+	}
+	if err := skipping.Update(rec, "marker", &Marker{}); err == nil {
+		t.Errorf("expected an error for a zero primary key")
+	}
+	if len(rec.queries) != 0 {
+		t.Errorf("expected no statements, found %v", rec.queries)
+	}
+}
+
+func TestUpdateMany(t *testing.T) {
+	once.Do(setup)
+
+	products := []*Product{{Price: 1, Qty: 1}, {Price: 2, Qty: 2}, {Price: 3, Qty: 3}}
+	for _, elt := range products {
+		if err := Insert(db, "product", elt); err != nil {
+			t.Fatalf("Insert error: %v", err)
+		}
+		elt.Price *= 10
+	}
+
+	var query string
+	pg := *PostgreSQL
+	pg.QueryWrapper = func(ctx context.Context, op, q string, fn func() error) error {
+		query = q
+		return fn()
+	}
+	if err := pg.UpdateMany(&argsDB{}, "product", products); err != nil {
+		t.Fatalf("UpdateMany error: %v", err)
+	}
+	expected := `UPDATE "product" SET "price"=v."price","qty"=v."qty" ` +
+		`FROM (SELECT "id","price","qty" FROM "product" WHERE 1=0 UNION ALL VALUES ($1,$2,$3),($4,$5,$6),($7,$8,$9)) AS v ` +
+		`WHERE "product"."id"=v."id"`
+	if query != expected {
+		t.Errorf("expected %s, found %s", expected, query)
+	}
+
+	// SQLite understands the same form
+	if err := SQLite.UpdateMany(db, "product", products); err != nil {
+		t.Fatalf("UpdateMany error: %v", err)
+	}
+	var lst []*Product
+	if err := QueryAll(db, &lst, "select * from product order by id"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	for i, elt := range lst {
+		if elt.Price != (i+1)*10 || elt.Total != (i+1)*(i+1)*10 {
+			t.Errorf("unexpected record after update: %+v", elt)
+		}
+	}
+
+	products[1].ID = 0
+	if err := SQLite.UpdateMany(db, "product", products); err == nil {
+		t.Errorf("expected an error for a zero primary key")
+	}
+	db.Exec("delete from product")
+}
+
+func TestDriverErr(t *testing.T) {
+	err, ok := DriverErr(io.EOF)
+	if ok {
+		t.Errorf("io.EOF: want driver error = false, got true")
+	}
+	if err != io.EOF {
+		t.Errorf("io.EOF: want itself as returned error, got %v", err)
+	}
+
+	once.Do(setup)
+	// insert into an invalid table
+	alice.ID = 0
+	err = Insert(db, "invalid", alice)
+	if err == nil {
+		t.Fatal("insert into invalid table, want error, got none")
+	}
+	err, ok = DriverErr(err)
+	if !ok {
+		t.Errorf("DriverErr: want ok to be true, got false")
+	}
+	if _, ok := err.(sqlite3.Error); !ok {
+		t.Errorf("DriverErr: want sqlite3 error, got %T", err)
+	}
+}
+
+func TestRefreshColumns(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	elt := new(Person)
+	if err := Load(db, "person", elt, 1); err != nil {
+		t.Fatalf("Load error on Alice: %v", err)
+	}
+	if _, err := db.Exec("update person set Email = ?, name = ? where id = 1", "alice@example.com", "Alicia"); err != nil {
+		t.Fatalf("DB error on update: %v", err)
+	}
+	elt.Age = 40
+
+	if err := RefreshColumns(db, "person", elt, "Email"); err != nil {
+		t.Errorf("RefreshColumns error: %v", err)
+	}
+	if elt.Email != "alice@example.com" {
+		t.Errorf("expected refreshed Email, found %s", elt.Email)
+	}
+	if elt.Name != "Alice" {
+		t.Errorf("expected Name to be left alone, found %s", elt.Name)
+	}
+	if elt.Age != 40 {
+		t.Errorf("expected Age to be left alone, found %d", elt.Age)
+	}
+
+	if err := RefreshColumns(db, "person", elt, "nosuchcolumn"); err == nil {
+		t.Errorf("RefreshColumns with unknown column: want error, got none")
+	}
+	db.Exec("delete from person")
+}
+
+func TestDeleteWhereLimited(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	conditions := map[string]interface{}{"Email": Like("%.com")}
+	n, err := DeleteWhereLimited(db, "person", conditions, 1)
+	if err == nil {
+		t.Errorf("expected an error when the limit is exceeded")
+	}
+	if n != 0 {
+		t.Errorf("expected no rows deleted, found %d", n)
+	}
+	var count int
+	if err := db.QueryRow("select count(*) from person").Scan(&count); err != nil {
+		t.Fatalf("DB error on count: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected both rows to remain, found %d", count)
+	}
+
+	n, err = DeleteWhereLimited(db, "person", conditions, 2)
+	if err != nil {
+		t.Errorf("DeleteWhereLimited error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows deleted, found %d", n)
+	}
+	db.Exec("delete from person")
+}
+
+func TestUpdateAll(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	rec := &recordingDB{DB: db}
+	set := map[string]interface{}{"name": "Anon", "height": 100}
+	n, err := SQLite.UpdateAll(rec, "person", set, map[string]interface{}{"Age": Gt(20), "id": 1})
+	if err != nil {
+		t.Fatalf("UpdateAll error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 row updated, found %d", n)
+	}
+	expected := `UPDATE "person" SET "height"=?,"name"=? WHERE "Age" > ? AND "id" = ?`
+	if len(rec.queries) != 1 || rec.queries[0] != expected {
+		t.Errorf("expected %s, found %v", expected, rec.queries)
+	}
+	elt := new(Person)
+	if err := Load(db, "person", elt, 1); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if elt.Name != "Anon" || elt.Height == nil || *elt.Height != 100 {
+		t.Errorf("unexpected person after update: %#v", elt)
+	}
+
+	// placeholders are numbered across the SET and WHERE parts
+	rec = &recordingDB{DB: db}
+	PostgreSQL.UpdateAll(rec, "person", set, map[string]interface{}{"id": 1})
+	expected = `UPDATE "person" SET "height"=$1,"name"=$2 WHERE "id" = $3`
+	if len(rec.queries) != 1 || rec.queries[0] != expected {
+		t.Errorf("expected %s, found %v", expected, rec.queries)
+	}
+
+	if _, err := SQLite.UpdateAll(db, "person", set, nil); err == nil {
+		t.Errorf("expected an error for an empty condition")
+	}
+	if _, err := SQLite.UpdateAll(db, "person", map[string]interface{}{`na"me`: 1}, map[string]interface{}{"id": 1}); err == nil {
+		t.Errorf("expected an error for an invalid column name")
+	}
+	n, err = SQLite.UpdateAllRows(db, "person", map[string]interface{}{"height": 50})
+	if err != nil {
+		t.Fatalf("UpdateAllRows error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows updated, found %d", n)
+	}
+
+	db.Exec("delete from person")
+}
+
+// recordingDB passes statements through to a DB and keeps track of them
+type recordingDB struct {
+	DB
+	queries []string
+}
+
+func (r *recordingDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	r.queries = append(r.queries, query)
+	return r.DB.Exec(query, args...)
+}
+
+func (r *recordingDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	r.queries = append(r.queries, query)
+	return r.DB.Query(query, args...)
+}
+
+func (r *recordingDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	r.queries = append(r.queries, query)
+	return r.DB.QueryRow(query, args...)
+}
+
+func TestGoldenSQL(t *testing.T) {
+	// every helper numbers its placeholders in the order of its arguments
+	stop := errors.New("stop")
+	for _, test := range []struct {
+		dialect  *Database
+		expected []string
+	}{
+		{MySQL, []string{
+			"SELECT `id`,`name`,`uses` FROM `label` WHERE `id` = ?",
+			"INSERT INTO `label` (`name`,`uses`) VALUES (?,?)",
+			"UPDATE `label` SET `name`=?,`uses`=? WHERE `id`=?",
+			"INSERT INTO `label` (`name`,`uses`) VALUES (?,?),(?,?)",
+			"DELETE FROM `label` WHERE `id` IN (?,?)",
+			"DELETE FROM `label` WHERE `name` IN (?,?)",
+			"`name` = ? AND `uses` > ?",
+		}},
+		{PostgreSQL, []string{
+			`SELECT "id","name","uses" FROM "label" WHERE "id" = $1`,
+			`INSERT INTO "label" ("name","uses") VALUES ($1,$2) RETURNING "id"`,
+			`UPDATE "label" SET "name"=$1,"uses"=$2 WHERE "id"=$3`,
+			`INSERT INTO "label" ("name","uses") VALUES ($1,$2),($3,$4)`,
+			`DELETE FROM "label" WHERE "id" IN ($1,$2)`,
+			`DELETE FROM "label" WHERE "name" IN ($1,$2)`,
+			`"name" = $1 AND "uses" > $2`,
+		}},
+		{SQLite, []string{
+			`SELECT "id","name","uses" FROM "label" WHERE "id" = ?`,
+			`INSERT INTO "label" ("name","uses") VALUES (?,?)`,
+			`UPDATE "label" SET "name"=?,"uses"=? WHERE "id"=?`,
+			`INSERT INTO "label" ("name","uses") VALUES (?,?),(?,?)`,
+			`DELETE FROM "label" WHERE "id" IN (?,?)`,
+			`DELETE FROM "label" WHERE "name" IN (?,?)`,
+			`"name" = ? AND "uses" > ?`,
+		}},
+		{MSSQL, []string{
+			`SELECT "id","name","uses" FROM "label" WHERE "id" = $1`,
+			`INSERT INTO "label" ("name","uses") VALUES ($1,$2) RETURNING "id"`,
+			`UPDATE "label" SET "name"=$1,"uses"=$2 WHERE "id"=$3`,
+			`INSERT INTO "label" ("name","uses") VALUES ($1,$2),($3,$4)`,
+			`DELETE FROM "label" WHERE "id" IN ($1,$2)`,
+			`DELETE FROM "label" WHERE "name" IN ($1,$2)`,
+			`"name" = $1 AND "uses" > $2`,
+		}},
+		{QL, []string{
+			"SELECT id,name,uses FROM label WHERE id = int64($1)",
+			"INSERT INTO label (name,uses) VALUES (string($1),int($2)) RETURNING id",
+			"UPDATE label SET name=string($1),uses=int($2) WHERE id=int64($3)",
+			"INSERT INTO label (name,uses) VALUES (string($1),int($2)),(string($3),int($4))",
+			"DELETE FROM label WHERE id IN (int64($1),int64($2))",
+			"DELETE FROM label WHERE name IN (string($1),string($2))",
+			"name = string($1) AND uses > int($2)",
+		}},
+	} {
+		d := *test.dialect
+		var queries []string
+		d.QueryWrapper = func(ctx context.Context, op, query string, fn func() error) error {
+			queries = append(queries, query)
+			return stop
+		}
+		d.Load(nil, "label", new(Label), 5)
+		d.Insert(nil, "label", &Label{Name: "go", Uses: 1})
+		d.Update(nil, "label", &Label{ID: 5, Name: "go", Uses: 1})
+		d.InsertMany(nil, "label", []*Label{{Name: "a", Uses: 1}, {Name: "b", Uses: 2}})
+		d.DeleteMany(nil, "label", []int64{1, 2}, new(Label))
+		d.DeleteByValues(nil, "label", "name", []interface{}{"a", "b"})
+		clause, _, err := d.WhereClause(And(Col("name", "go"), Col("uses", Gt(1))), 1)
+		if err != nil {
+			t.Fatalf("WhereClause error: %v", err)
+		}
+		queries = append(queries, clause)
+
+		if !reflect.DeepEqual(queries, test.expected) {
+			t.Errorf("%s: expected\n%s\nfound\n%s", d.Name, strings.Join(test.expected, "\n"), strings.Join(queries, "\n"))
+		}
+	}
+}
+
+func TestRequireWhere(t *testing.T) {
+	once.Do(setup)
+
+	// a struct without a primary key cannot be updated or deleted
+	rec := &recordingDB{DB: db}
+	if err := SQLite.Update(rec, "quarters", &Quarters{Region: "north"}); err == nil {
+		t.Errorf("expected an error updating a record without a primary key")
+	}
+	if err := SQLite.DeleteReturning(rec, "quarters", 1, new(Quarters)); err == nil {
+		t.Errorf("expected an error deleting a record without a primary key")
+	}
+	if _, err := SQLite.DeleteMany(rec, "quarters", []int64{1}, new(Quarters)); err == nil {
+		t.Errorf("expected an error deleting records without a primary key")
+	}
+	if _, err := SQLite.DeleteWhereLimited(rec, "quarters", nil, 10); err == nil {
+		t.Errorf("expected an error deleting without conditions")
+	}
+	if len(rec.queries) != 0 {
+		t.Errorf("expected no statements to run, found %v", rec.queries)
+	}
+
+	if _, err := SQLite.UpdateAll(rec, "quarters", map[string]interface{}{"region": "south"}, nil); err == nil {
+		t.Errorf("expected an error updating without conditions")
+	}
+	if len(rec.queries) != 0 {
+		t.Errorf("expected no statements to run, found %v", rec.queries)
+	}
+}
+
+func TestRewriteSQL(t *testing.T) {
+	once.Do(setup)
+
+	tagged := *SQLite
+	tagged.RewriteSQL = func(query string) string {
+		return query + " /* request_id=42 */"
+	}
+	rec := &recordingDB{DB: db}
+
+	alice.ID = 0
+	if err := tagged.Insert(rec, "person", alice); err != nil {
+		t.Errorf("Insert error: %v", err)
+	}
+	elt := new(Person)
+	if err := tagged.Load(rec, "person", elt, alice.ID); err != nil {
+		t.Errorf("Load error: %v", err)
+	}
+	if elt.Name != "Alice" {
+		t.Errorf("expected to load Alice, found %s", elt.Name)
+	}
+	var lst []*Person
+	if err := tagged.QueryAll(rec, &lst, "select * from person where id = ?", alice.ID); err != nil {
+		t.Errorf("QueryAll error: %v", err)
+	}
+
+	if len(rec.queries) != 3 {
+		t.Errorf("expected 3 statements, found %d", len(rec.queries))
+	}
+	for _, q := range rec.queries {
+		if !strings.HasSuffix(q, " /* request_id=42 */") {
+			t.Errorf("statement was not rewritten: %s", q)
+		}
+	}
+	db.Exec("delete from person")
+}
+
+func TestQueryWrapper(t *testing.T) {
+	once.Do(setup)
+
+	var ops []string
+	failure := errors.New("injected")
+	wrapped := *SQLite
+	wrapped.QueryWrapper = func(ctx context.Context, op, query string, fn func() error) error {
+		ops = append(ops, op)
+		err := fn()
+		if strings.Contains(query, "no_such_table") && err == nil {
+			t.Errorf("expected the inner error to be passed to the wrapper")
+		}
+		return err
+	}
+
+	alice.ID = 0
+	if err := wrapped.Insert(db, "person", alice); err != nil {
+		t.Errorf("Insert error: %v", err)
+	}
+	if err := wrapped.Update(db, "person", alice); err != nil {
+		t.Errorf("Update error: %v", err)
+	}
+	if err := wrapped.Load(db, "person", new(Person), alice.ID); err != nil {
+		t.Errorf("Load error: %v", err)
+	}
+	expected := []string{"Insert", "Update", "Load"}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Errorf("expected ops %v, found %v", expected, ops)
+	}
+
+	// errors from the database are propagated
+	if err := wrapped.Load(db, "no_such_table", new(Person), alice.ID); err == nil {
+		t.Errorf("expected an error loading from a missing table")
+	}
+
+	// and so are errors from the wrapper
+	wrapped.QueryWrapper = func(ctx context.Context, op, query string, fn func() error) error {
+		return failure
+	}
+	if err := wrapped.Update(db, "person", alice); err == nil || !strings.Contains(err.Error(), "injected") {
+		t.Errorf("expected the wrapper's error, found %v", err)
+	}
+
+	// the wrapper gets the context of the operation, which the
+	// statements run under
+	type spanKey struct{}
+	var spans []interface{}
+	wrapped.QueryWrapper = func(ctx context.Context, op, query string, fn func() error) error {
+		spans = append(spans, ctx.Value(spanKey{}))
+		return fn()
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), spanKey{}, "parent"))
+	traced := wrapped.WithContext(ctx)
+	if err := traced.Load(db, "person", new(Person), alice.ID); err != nil {
+		t.Errorf("Load error: %v", err)
+	}
+	if err := wrapped.Load(db, "person", new(Person), alice.ID); err != nil {
+		t.Errorf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(spans, []interface{}{"parent", nil}) {
+		t.Errorf("expected the context only under WithContext, found %v", spans)
+	}
+	cancel()
+	if err := traced.Update(db, "person", alice); err == nil {
+		t.Errorf("expected an error under a canceled context")
+	}
+	db.Exec("delete from person")
+}
+
+type ValidatedPerson struct {
+	Person
+}
+
+func (p *ValidatedPerson) Validate() error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	once.Do(setup)
+	rec := &recordingDB{DB: db}
+
+	elt := &ValidatedPerson{Person: Person{Email: "nobody@example.com", Opened: when}}
+	if err := Save(rec, "person", elt); err == nil || err.Error() != "name is required" {
+		t.Errorf("expected the validation error from Save, found %v", err)
+	}
+	elt.ID = 5
+	if err := Update(rec, "person", elt); err == nil {
+		t.Errorf("expected a validation error from Update")
+	}
+	if len(rec.queries) != 0 {
+		t.Errorf("expected no statements, found %v", rec.queries)
+	}
+
+	elt.ID = 0
+	elt.Name = "Nobody"
+	if err := Save(rec, "person", elt); err != nil {
+		t.Errorf("Save error: %v", err)
+	}
+	if len(rec.queries) != 1 {
+		t.Errorf("expected one statement, found %v", rec.queries)
+	}
+	db.Exec("delete from person")
+}
+
+type Gadget struct {
+	ID   int64  `meddler:"id,pk"`
+	Name string `meddler:"name"`
+	Slug string `meddler:"slug,zeroisnull"`
+}
+
+func TestReloadAfterInsert(t *testing.T) {
+	once.Do(setup)
+
+	plain := &Gadget{Name: "Sprocket"}
+	if err := SQLite.Insert(db, "gadget", plain); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if plain.Slug != "" {
+		t.Errorf("expected no slug without reloading, found %s", plain.Slug)
+	}
+
+	reloading := *SQLite
+	reloading.ReloadAfterInsert = true
+	elt := &Gadget{Name: "Widget"}
+	if err := reloading.Insert(db, "gadget", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if elt.ID == 0 {
+		t.Errorf("expected a new primary key")
+	}
+	if elt.Slug != "widget" {
+		t.Errorf("expected slug set by the database, found %q", elt.Slug)
+	}
+
+	// recent versions of SQLite understand RETURNING as well
+	returning := reloading
+	returning.UseReturningToGetID = true
+	elt = &Gadget{Name: "Gizmo"}
+	if err := returning.Insert(db, "gadget", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if elt.ID == 0 || elt.Name != "Gizmo" {
+		t.Errorf("unexpected record after insert with RETURNING: %+v", elt)
+	}
+	db.Exec("delete from gadget")
+}
+
+type Product struct {
+	ID    int64 `meddler:"id,pk"`
+	Price int   `meddler:"price"`
+	Qty   int   `meddler:"qty"`
+	Total int   `meddler:"total,generated"`
+}
+
+func TestGenerated(t *testing.T) {
+	once.Do(setup)
+
+	returning := *SQLite
+	returning.UseReturningToGetID = true
+	rec := &recordingDB{DB: db}
+
+	elt := &Product{Price: 3, Qty: 4, Total: 99}
+	if err := returning.Insert(rec, "product", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	expected := `INSERT INTO "product" ("price","qty") VALUES (?,?) RETURNING "id","total"`
+	if rec.queries[0] != expected {
+		t.Errorf("expected %s, found %s", expected, rec.queries[0])
+	}
+	if elt.ID == 0 || elt.Total != 12 {
+		t.Errorf("expected a new key and the generated total, found %+v", elt)
+	}
+
+	elt.Qty = 5
+	if err := returning.Update(rec, "product", elt); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+	expected = `UPDATE "product" SET "price"=?,"qty"=? WHERE "id"=?`
+	if rec.queries[1] != expected {
+		t.Errorf("expected %s, found %s", expected, rec.queries[1])
+	}
+
+	// generated columns are read like any other
+	loaded := new(Product)
+	if err := returning.Load(db, "product", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Total != 15 {
+		t.Errorf("expected total of 15, found %d", loaded.Total)
+	}
+
+	if err := InsertMany(db, "product", []*Product{{Price: 1, Qty: 2}, {Price: 2, Qty: 2}}); err != nil {
+		t.Errorf("InsertMany error: %v", err)
+	}
+	db.Exec("delete from product")
+}
+
+func TestUpdateReturning(t *testing.T) {
+	once.Do(setup)
+
+	elt := &Product{Price: 3, Qty: 4}
+	if err := SQLite.Insert(db, "product", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+
+	// a plain update does not read anything back
+	rec := &recordingDB{DB: db}
+	elt.Qty = 5
+	if err := SQLite.Update(rec, "product", elt); err != nil {
+		t.Fatalf("Update error: %v", err)
+	}
+	if len(rec.queries) != 1 || strings.Contains(rec.queries[0], "RETURNING") {
+		t.Errorf("expected a single statement without RETURNING, found %v", rec.queries)
+	}
+	if elt.Total != 0 {
+		t.Errorf("expected the total to be left alone, found %d", elt.Total)
+	}
+
+	rec = &recordingDB{DB: db}
+	elt.Qty = 6
+	if err := SQLite.UpdateReturning(rec, "product", elt); err != nil {
+		t.Fatalf("UpdateReturning error: %v", err)
+	}
+	expected := []string{`UPDATE "product" SET "price"=?,"qty"=? WHERE "id"=? RETURNING "total"`}
+	if !reflect.DeepEqual(rec.queries, expected) {
+		t.Errorf("expected %v, found %v", expected, rec.queries)
+	}
+	if elt.Total != 18 {
+		t.Errorf("expected total of 18, found %d", elt.Total)
+	}
+
+	// without RETURNING the columns are read back separately
+	rec = &recordingDB{DB: db}
+	elt.Qty = 7
+	if err := MySQL.UpdateReturning(rec, "product", elt, "total"); err != nil {
+		t.Fatalf("UpdateReturning error: %v", err)
+	}
+	if len(rec.queries) != 2 || elt.Total != 21 {
+		t.Errorf("expected two statements and a total of 21, found %v and %d", rec.queries, elt.Total)
+	}
+
+	// a missing row is reported, the same way with and without RETURNING
+	missing := &Product{ID: elt.ID + 100, Price: 1, Qty: 1}
+	if err := SQLite.Update(db, "product", missing); err != nil {
+		t.Errorf("Update error for a missing row: %v", err)
+	}
+	for _, d := range []*Database{SQLite, MySQL} {
+		if err := d.UpdateReturning(db, "product", missing); err != sql.ErrNoRows {
+			t.Errorf("%s: expected sql.ErrNoRows for a missing row, found %v", d.Name, err)
+		}
+	}
+
+	if err := SQLite.UpdateReturning(db, "product", elt, "nope"); err == nil {
+		t.Errorf("expected an error for an unknown column")
+	}
+	db.Exec("delete from product")
+}
+
+type ProductSummary struct {
+	ID     int64 `meddler:"id,pk"`
+	Price  int   `meddler:"price"`
+	Qty    int   `meddler:"qty"`
+	Orders int   `meddler:"order_count,scanonly"`
+}
+
+func TestScanOnly(t *testing.T) {
+	once.Do(setup)
+
+	rec := &recordingDB{DB: db}
+	elt := &ProductSummary{Price: 3, Qty: 4, Orders: 7}
+	if err := SQLite.Insert(rec, "product", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	expected := `INSERT INTO "product" ("price","qty") VALUES (?,?)`
+	if rec.queries[0] != expected {
+		t.Errorf("expected %s, found %s", expected, rec.queries[0])
+	}
+
+	loaded := new(ProductSummary)
+	if err := QueryRow(db, loaded, "select id, price, qty, price * qty + 1 as order_count from product where id = ?", elt.ID); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if loaded.ID != elt.ID || loaded.Price != 3 || loaded.Qty != 4 || loaded.Orders != 13 {
+		t.Errorf("expected the record and the computed count, found %+v", loaded)
+	}
+
+	// the base column list leaves it out
+	loaded = new(ProductSummary)
+	if err := Load(db, "product", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Price != 3 || loaded.Orders != 0 {
+		t.Errorf("expected the record without a count, found %+v", loaded)
+	}
+	columns, err := Columns(loaded, true)
+	if err != nil {
+		t.Fatalf("Columns error: %v", err)
+	}
+	if !reflect.DeepEqual(columns, []string{"id", "price", "qty"}) {
+		t.Errorf("unexpected columns %v", columns)
+	}
+
+	db.Exec("delete from product")
+}
+
+func TestLoadExcept(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	rec := &recordingDB{DB: db}
+	elt := new(Person)
+	if err := SQLite.LoadExcept(rec, "person", elt, 1, "Email", "updated"); err != nil {
+		t.Fatalf("LoadExcept error: %v", err)
+	}
+	expected := `SELECT "id","name","Age","opened","closed","height" FROM "person" WHERE "id" = ?`
+	if len(rec.queries) != 1 || rec.queries[0] != expected {
+		t.Errorf("expected %s, found %v", expected, rec.queries)
+	}
+	if elt.Name != "Alice" || elt.Email != "" || elt.Updated != nil {
+		t.Errorf("expected Alice without email and update time, found %s %q %v", elt.Name, elt.Email, elt.Updated)
+	}
+
+	if err := SQLite.LoadExcept(rec, "person", elt, 1, "no_such_column"); err == nil {
+		t.Errorf("expected an error for an unknown excluded column")
+	}
+
+	rec.queries = nil
+	var lst []*Person
+	if err := SQLite.QueryAllExcept(rec, &lst, "person", Col("Age", Ne(nil)), "height"); err != nil {
+		t.Fatalf("QueryAllExcept error: %v", err)
+	}
+	expected = `SELECT "id","name","Email","Age","opened","closed","updated" FROM "person" WHERE "Age" IS NOT NULL`
+	if len(rec.queries) != 1 || rec.queries[0] != expected {
+		t.Errorf("expected %s, found %v", expected, rec.queries)
+	}
+	if len(lst) != 1 || lst[0].Name != "Alice" || lst[0].Height != nil {
+		t.Errorf("expected only Alice without height, found %v", lst)
+	}
+
+	var events []*Event
+	if err := SQLite.QueryAllExcept(rec, &events, "event", And(), "event_time"); err != nil {
+		t.Errorf("QueryAllExcept error: %v", err)
+	}
+	expected = `SELECT "id" FROM "event" WHERE 1=1`
+	if rec.queries[len(rec.queries)-1] != expected {
+		t.Errorf("expected both columns of a field to be excluded, found %s", rec.queries[len(rec.queries)-1])
+	}
+	db.Exec("delete from person")
+}
+
+func TestQueryAllOrdered(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+	db.Exec("update person set Age = 32")
+
+	rec := &recordingDB{DB: db}
+	var lst []*Person
+	if err := SQLite.QueryAllOrdered(rec, &lst, "person", And(), 10, Desc("Age"), Asc("id")); err != nil {
+		t.Fatalf("QueryAllOrdered error: %v", err)
+	}
+	expected := `SELECT "id","name","Email","Age","opened","closed","updated","height" FROM "person" WHERE 1=1 ORDER BY "Age" DESC, "id" ASC LIMIT 10`
+	if len(rec.queries) != 1 || rec.queries[0] != expected {
+		t.Errorf("expected %s, found %v", expected, rec.queries)
+	}
+	if len(lst) != 2 || lst[0].Name != "Alice" || lst[1].Name != "Bob" {
+		t.Errorf("expected Alice then Bob, found %v", lst)
+	}
+
+	// the next page after Alice
+	last := lst[0]
+	lst = nil
+	next := Or(Col("Age", Lt(last.Age)), And(Col("Age", last.Age), Col("id", Gt(last.ID))))
+	if err := SQLite.QueryAllOrdered(db, &lst, "person", next, 1, Desc("Age"), Asc("id")); err != nil {
+		t.Fatalf("QueryAllOrdered error: %v", err)
+	}
+	if len(lst) != 1 || lst[0].Name != "Bob" {
+		t.Errorf("expected Bob on the next page, found %v", lst)
+	}
+
+	if err := SQLite.QueryAllOrdered(db, &lst, "person", And(), 0, Asc("nope")); err == nil {
+		t.Errorf("expected an error for an unknown order column")
+	}
+	if err := SQLite.QueryAllOrdered(db, &lst, "person", And(), 0); err == nil {
+		t.Errorf("expected an error without order columns")
+	}
+	db.Exec("delete from person")
+}
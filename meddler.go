@@ -6,7 +6,10 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
+	"math/bits"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -29,9 +32,34 @@ type Meddler interface {
 	PreWrite(field interface{}) (saveValue interface{}, err error)
 }
 
+// MultiColumnMeddler is implemented by meddlers that can store a single
+// struct field in several columns. Such a field names its columns with the
+// columns option in its tag, separated by "+", e.g.:
+//
+//	Event time.Time `meddler:",datetime,columns=event_date+event_time"`
+//
+// The values going to and coming from the database are in the same order
+// as the columns in the tag.
+type MultiColumnMeddler interface {
+	Meddler
+
+	// PreReadColumns is like PreRead, but returns one scan target for each
+	// column.
+	PreReadColumns(fieldAddr interface{}) (scanTargets []interface{}, err error)
+
+	// PostReadColumns is like PostRead, but is given the scan targets of
+	// all columns.
+	PostReadColumns(fieldAddr interface{}, scanTargets []interface{}) error
+
+	// PreWriteColumns is like PreWrite, but returns one value for each
+	// column.
+	PreWriteColumns(field interface{}) (saveValues []interface{}, err error)
+}
+
 // Register sets up a meddler type. Meddlers get a chance to meddle with the
 // data being loaded or saved when a field is annotated with the name of the meddler.
-// The registry is global.
+// The registry is global; see Database.Register for meddlers that are
+// scoped to a single Database.
 func Register(name string, m Meddler) {
 	if name == "pk" {
 		panic("meddler.Register: pk cannot be used as a meddler name")
@@ -41,17 +69,88 @@ func Register(name string, m Meddler) {
 
 var registry = make(map[string]Meddler)
 
+// Register sets up a meddler type that is only visible to this Database.
+// It shadows any global meddler of the same name, so different parts of
+// a program can use their own encodings under a common name by working
+// with separate Database values. A copy of a Database, as made by
+// d := *meddler.SQLite, starts out with the meddlers of the original, and
+// registering on either one does not affect the other.
+func (d *Database) Register(name string, m Meddler) {
+	if name == "pk" {
+		panic("meddler.Register: pk cannot be used as a meddler name")
+	}
+
+	fieldsCacheMutex.Lock()
+	defer fieldsCacheMutex.Unlock()
+
+	// a copy made by WithContext gets struct data of its own from now on
+	d.base = nil
+
+	// the map may be shared with copies of d, so it is never changed
+	registry := make(map[string]Meddler, len(d.registry)+1)
+	for key, value := range d.registry {
+		registry[key] = value
+	}
+	registry[name] = m
+	d.registry = registry
+
+	// forget struct data that was gathered with the old meddlers
+	d.forgetFields()
+}
+
+// ForgetFields discards the struct data cached for this Database. The
+// cache is kept for each Database value, so a program that makes
+// short-lived copies of a Database, such as one for each request, should
+// call it when it is done with a copy; otherwise the cached data of the
+// copy is kept for the life of the program.
+func (d *Database) ForgetFields() {
+	fieldsCacheMutex.Lock()
+	defer fieldsCacheMutex.Unlock()
+	d.forgetFields()
+}
+
+// forgetFields is ForgetFields for callers holding fieldsCacheMutex.
+func (d *Database) forgetFields() {
+	for key := range fieldsCache {
+		if key.db == d {
+			delete(fieldsCache, key)
+		}
+	}
+}
+
+// lookupMeddler finds a meddler by name, consulting the registry of the
+// Database before the global one.
+func (d *Database) lookupMeddler(name string) (Meddler, bool) {
+	if m, present := d.registry[name]; present {
+		return m, true
+	}
+	m, present := registry[name]
+	return m, present
+}
+
 func init() {
 	Register("identity", IdentityMeddler(false))
 	Register("localtime", TimeMeddler{ZeroIsNull: false, Local: true})
 	Register("localtimez", TimeMeddler{ZeroIsNull: true, Local: true})
 	Register("utctime", TimeMeddler{ZeroIsNull: false, Local: false})
 	Register("utctimez", TimeMeddler{ZeroIsNull: true, Local: false})
+	Register("mysqltime", MySQLTimeMeddler{ZeroIsNull: false})
+	Register("mysqltimez", MySQLTimeMeddler{ZeroIsNull: true})
+	Register("datetime", DateTimeMeddler(false))
 	Register("zeroisnull", ZeroIsNullMeddler(false))
 	Register("json", JSONMeddler(false))
 	Register("jsongzip", JSONMeddler(true))
+	Register("jsoncompact", CompactJSONMeddler{Threshold: 256})
 	Register("gob", GobMeddler(false))
 	Register("gobgzip", GobMeddler(true))
+	Register("pgarray", PgArrayMeddler(false))
+	Register("point", PointMeddler(false))
+	Register("iso8601time", ISO8601TimeMeddler(false))
+	Register("iso8601duration", ISO8601DurationMeddler(false))
+	Register("interval", IntervalMeddler(false))
+	Register("uuidbin", UUIDBinaryMeddler(false))
+	Register("range", RangeMeddler(false))
+	Register("normalize", NormalizeMeddler{Normalize: strings.ToLower})
 }
 
 // IdentityMeddler is the default meddler, and it passes the original value through with
@@ -216,6 +315,258 @@ func (elt ZeroIsNullMeddler) PreWrite(field interface{}) (saveValue interface{},
 	return field, nil
 }
 
+// MySQLTimeMeddler reads time.Time fields from MySQL columns that may hold
+// the zero date 0000-00-00, which cannot be parsed as a Go time. The zero
+// date (and null) is read as the zero time.Time. Values are read whether or
+// not the driver parses times itself. On save, the zero time is written as a
+// null column if ZeroIsNull is set, and as the zero date otherwise. Other
+// times are converted to UTC on save and on load.
+type MySQLTimeMeddler struct {
+	ZeroIsNull bool
+}
+
+// mysqlZeroDate is what MySQL uses as its zero DATETIME value
+const mysqlZeroDate = "0000-00-00 00:00:00"
+
+// mysqlTimeFormats are the textual forms of DATE and DATETIME columns
+var mysqlTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func (elt MySQLTimeMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *time.Time:
+		// take the raw value, since the driver may refuse to parse the zero date
+		return new(interface{}), nil
+	default:
+		return nil, fmt.Errorf("meddler.MySQLTimeMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt MySQLTimeMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	tgt, ok := fieldAddr.(*time.Time)
+	if !ok {
+		return fmt.Errorf("meddler.MySQLTimeMeddler.PostRead: unknown struct field type: %T", fieldAddr)
+	}
+
+	var text string
+	switch src := (*scanTarget.(*interface{})).(type) {
+	case nil:
+		*tgt = time.Time{}
+		return nil
+	case time.Time:
+		if src.IsZero() {
+			*tgt = time.Time{}
+		} else {
+			*tgt = src.UTC()
+		}
+		return nil
+	case []byte:
+		text = string(src)
+	case string:
+		text = src
+	default:
+		return fmt.Errorf("meddler.MySQLTimeMeddler.PostRead: unknown column value type: %T", src)
+	}
+
+	if strings.HasPrefix(text, "0000-00-00") {
+		*tgt = time.Time{}
+		return nil
+	}
+	for _, format := range mysqlTimeFormats {
+		if t, err := time.ParseInLocation(format, text, time.UTC); err == nil {
+			*tgt = t
+			return nil
+		}
+	}
+	return fmt.Errorf("meddler.MySQLTimeMeddler.PostRead: cannot parse time value %q", text)
+}
+
+func (elt MySQLTimeMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	tgt, ok := field.(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("meddler.MySQLTimeMeddler.PreWrite: unknown struct field type: %T", field)
+	}
+	if tgt.IsZero() {
+		if elt.ZeroIsNull {
+			return nil, nil
+		}
+		return mysqlZeroDate, nil
+	}
+	return tgt.UTC(), nil
+}
+
+// ZoneTimeMeddler stores time.Time and *time.Time fields in columns
+// without a time zone, holding the wall clock time in Location. Times
+// are converted to Location on save, and read back as times in Location.
+// The zero time and nil pointers are written as null, and null columns
+// are read as the zero time or nil. It is used for fields with the tz
+// option, as in `meddler:"event_at,tz=America/New_York"`.
+type ZoneTimeMeddler struct {
+	Location *time.Location
+}
+
+func (elt ZoneTimeMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *time.Time, **time.Time:
+		return new(*time.Time), nil
+	default:
+		return nil, fmt.Errorf("meddler.ZoneTimeMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt ZoneTimeMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	src := *scanTarget.(**time.Time)
+	var t time.Time
+	if src != nil {
+		// the wall clock time is in Location, regardless of what the
+		// driver says
+		t = time.Date(src.Year(), src.Month(), src.Day(), src.Hour(), src.Minute(), src.Second(), src.Nanosecond(), elt.Location)
+	}
+
+	switch tgt := fieldAddr.(type) {
+	case *time.Time:
+		*tgt = t
+	case **time.Time:
+		if src == nil {
+			*tgt = nil
+		} else {
+			*tgt = &t
+		}
+	default:
+		return fmt.Errorf("meddler.ZoneTimeMeddler.PostRead: unknown struct field type: %T", fieldAddr)
+	}
+	return nil
+}
+
+func (elt ZoneTimeMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	var t time.Time
+	switch tgt := field.(type) {
+	case time.Time:
+		t = tgt
+	case *time.Time:
+		if tgt != nil {
+			t = *tgt
+		}
+	default:
+		return nil, fmt.Errorf("meddler.ZoneTimeMeddler.PreWrite: unknown struct field type: %T", field)
+	}
+	if t.IsZero() {
+		return nil, nil
+	}
+
+	// write the wall clock time in Location without a zone offset
+	t = t.In(elt.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC), nil
+}
+
+// DateTimeMeddler stores a time.Time field in two columns, one holding the
+// date and the other the time of day, as found in some legacy schemas. The
+// field must name the date column and the time column (in that order) with
+// the columns option. Times are written in UTC, and the zero time is written
+// as null in both columns. Null columns are read as the zero time.
+type DateTimeMeddler bool
+
+func (elt DateTimeMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	return nil, fmt.Errorf("meddler.DateTimeMeddler needs a field with a date and a time column")
+}
+
+func (elt DateTimeMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	return fmt.Errorf("meddler.DateTimeMeddler needs a field with a date and a time column")
+}
+
+func (elt DateTimeMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	return nil, fmt.Errorf("meddler.DateTimeMeddler needs a field with a date and a time column")
+}
+
+func (elt DateTimeMeddler) PreReadColumns(fieldAddr interface{}) (scanTargets []interface{}, err error) {
+	if _, ok := fieldAddr.(*time.Time); !ok {
+		return nil, fmt.Errorf("meddler.DateTimeMeddler.PreReadColumns: unknown struct field type: %T", fieldAddr)
+	}
+	return []interface{}{new(interface{}), new(interface{})}, nil
+}
+
+func (elt DateTimeMeddler) PostReadColumns(fieldAddr interface{}, scanTargets []interface{}) error {
+	tgt, ok := fieldAddr.(*time.Time)
+	if !ok {
+		return fmt.Errorf("meddler.DateTimeMeddler.PostReadColumns: unknown struct field type: %T", fieldAddr)
+	}
+	if len(scanTargets) != 2 {
+		return fmt.Errorf("meddler.DateTimeMeddler.PostReadColumns: expected 2 columns, found %d", len(scanTargets))
+	}
+
+	date, err := timeValue(*scanTargets[0].(*interface{}), "2006-01-02")
+	if err != nil {
+		return fmt.Errorf("meddler.DateTimeMeddler.PostReadColumns: date column: %v", err)
+	}
+	clock, err := timeValue(*scanTargets[1].(*interface{}), "15:04:05.999999999")
+	if err != nil {
+		return fmt.Errorf("meddler.DateTimeMeddler.PostReadColumns: time column: %v", err)
+	}
+	if date == nil {
+		*tgt = time.Time{}
+		return nil
+	}
+
+	year, month, day := date.Date()
+	var hour, min, sec, nsec int
+	if clock != nil {
+		hour, min, sec = clock.Clock()
+		nsec = clock.Nanosecond()
+	}
+	*tgt = time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+	return nil
+}
+
+func (elt DateTimeMeddler) PreWriteColumns(field interface{}) (saveValues []interface{}, err error) {
+	tgt, ok := field.(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("meddler.DateTimeMeddler.PreWriteColumns: unknown struct field type: %T", field)
+	}
+	if tgt.IsZero() {
+		return []interface{}{nil, nil}, nil
+	}
+	tgt = tgt.UTC()
+	return []interface{}{tgt.Format("2006-01-02"), tgt.Format("15:04:05.999999999")}, nil
+}
+
+// timeValue interprets a raw column value as a time, parsing it with the
+// given layout if the driver did not already. It returns nil for null.
+func timeValue(raw interface{}, layout string) (*time.Time, error) {
+	var text string
+	switch src := raw.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		return &src, nil
+	case []byte:
+		text = string(src)
+	case string:
+		text = src
+	default:
+		return nil, fmt.Errorf("unknown column value type: %T", raw)
+	}
+
+	// drivers may add a time to a date or a date to a time
+	t, err := time.Parse(layout, text)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339Nano, text)
+	}
+	if err != nil {
+		t, err = time.Parse("2006-01-02 15:04:05.999999999", text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q", text)
+	}
+	return &t, nil
+}
+
+// JSONMeddler encodes fields as JSON, optionally compressed using gzip.
+// Any type encoding/json handles will do, including slices and arrays,
+// which are stored as JSON arrays. A null column sets the field to its
+// zero value, such as a nil slice or map.
 type JSONMeddler bool
 
 func (zip JSONMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
@@ -229,6 +580,11 @@ func (zip JSONMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
 		return fmt.Errorf("JSONMeddler.PostRead: nil pointer")
 	}
 	raw := *ptr
+	if raw == nil {
+		field := reflect.ValueOf(fieldAddr).Elem()
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
 
 	if zip {
 		// un-gzip and decode json
@@ -283,6 +639,67 @@ func (zip JSONMeddler) PreWrite(field interface{}) (saveValue interface{}, err e
 	return buffer.Bytes(), nil
 }
 
+// CompactJSONMeddler stores fields as JSON like JSONMeddler, but only
+// compresses the JSON using gzip if it is longer than Threshold bytes.
+// The stored bytes start with a header byte telling which it is: 0 for
+// plain JSON, and 1 for gzipped JSON. Values written by the jsongzip
+// meddler are read as well, so a column can be switched over to this one.
+// A null column is read as the zero value. It is registered as
+// jsoncompact, with a threshold of 256 bytes.
+type CompactJSONMeddler struct {
+	Threshold int
+}
+
+const (
+	compactPlain = 0
+	compactGzip  = 1
+)
+
+func (elt CompactJSONMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	// give a pointer to a byte buffer to grab the raw data
+	return new([]byte), nil
+}
+
+func (elt CompactJSONMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	raw := *scanTarget.(*[]byte)
+	switch {
+	case raw == nil:
+		// null, as for JSONMeddler
+		field := reflect.ValueOf(fieldAddr).Elem()
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	case len(raw) == 0:
+		return fmt.Errorf("CompactJSONMeddler.PostRead: empty value")
+	case raw[0] == compactPlain:
+		body := raw[1:]
+		return JSONMeddler(false).PostRead(fieldAddr, &body)
+	case raw[0] == compactGzip:
+		body := raw[1:]
+		return JSONMeddler(true).PostRead(fieldAddr, &body)
+	case raw[0] == 0x1f:
+		// written by the jsongzip meddler
+		return JSONMeddler(true).PostRead(fieldAddr, &raw)
+	default:
+		return fmt.Errorf("CompactJSONMeddler.PostRead: unknown header byte %d", raw[0])
+	}
+}
+
+func (elt CompactJSONMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	plain, err := JSONMeddler(false).PreWrite(field)
+	if err != nil {
+		return nil, err
+	}
+	body := plain.([]byte)
+	if len(body) <= elt.Threshold {
+		return append([]byte{compactPlain}, body...), nil
+	}
+	zipped, err := JSONMeddler(true).PreWrite(field)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{compactGzip}, zipped.([]byte)...), nil
+}
+
 type GobMeddler bool
 
 func (zip GobMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
@@ -349,3 +766,474 @@ func (zip GobMeddler) PreWrite(field interface{}) (saveValue interface{}, err er
 	}
 	return buffer.Bytes(), nil
 }
+
+// EnumMeddler saves integer fields, such as the constants of an enum type,
+// as their names in Names. On load it accepts both representations, since
+// an enum column may arrive as a string (as with PostgreSQL enum types) or
+// as an integer (as with a MySQL integer column): a name is mapped back to
+// its value, and an integer is used as it is. Unknown names and values are
+// an error. A null column is read as zero.
+//
+// EnumMeddler is not registered by default; register a pointer to one for
+// each enum type:
+//
+//	meddler.Register("status", &meddler.EnumMeddler{Names: map[int64]string{1: "open", 2: "closed"}})
+type EnumMeddler struct {
+	Names map[int64]string
+}
+
+func (elt *EnumMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	if !isIntegerPtr(fieldAddr) {
+		return nil, fmt.Errorf("meddler.EnumMeddler.PreRead: field must be an integer, found %T", fieldAddr)
+	}
+	return new(interface{}), nil
+}
+
+func (elt *EnumMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	var value int64
+	var err error
+	switch raw := (*scanTarget.(*interface{})).(type) {
+	case nil:
+	case int64:
+		value = raw
+		if _, known := elt.Names[value]; !known {
+			return fmt.Errorf("meddler.EnumMeddler.PostRead: unknown value %d", value)
+		}
+	case []byte:
+		if value, err = elt.value(string(raw)); err != nil {
+			return fmt.Errorf("meddler.EnumMeddler.PostRead: %v", err)
+		}
+	case string:
+		if value, err = elt.value(raw); err != nil {
+			return fmt.Errorf("meddler.EnumMeddler.PostRead: %v", err)
+		}
+	default:
+		return fmt.Errorf("meddler.EnumMeddler.PostRead: unexpected column type %T", raw)
+	}
+
+	fv := reflect.ValueOf(fieldAddr).Elem()
+	switch fv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fv.SetUint(uint64(value))
+	default:
+		fv.SetInt(value)
+	}
+	return nil
+}
+
+// value finds the value of a name, or of an integer in text form.
+func (elt *EnumMeddler) value(s string) (int64, error) {
+	for value, name := range elt.Names {
+		if name == s {
+			return value, nil
+		}
+	}
+	if value, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if _, known := elt.Names[value]; known {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown name %q", s)
+}
+
+func (elt *EnumMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	var value int64
+	fv := reflect.ValueOf(field)
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = fv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = int64(fv.Uint())
+	default:
+		return nil, fmt.Errorf("meddler.EnumMeddler.PreWrite: field must be an integer, found %T", field)
+	}
+	name, known := elt.Names[value]
+	if !known {
+		return nil, fmt.Errorf("meddler.EnumMeddler.PreWrite: unknown value %d", value)
+	}
+	return name, nil
+}
+
+// EnumArrayMeddler saves slices of integers, such as the constants of an
+// enum type, as PostgreSQL arrays of their names in Names, as in a
+// status_enum[] column. On load, each element is mapped back as by
+// EnumMeddler. Unknown names and values are an error, or are left out of
+// the slice if SkipUnknown is set. Null elements are read as zero, and a
+// null array is read as a nil slice.
+//
+// EnumArrayMeddler is not registered by default; register a pointer to
+// one for each enum type:
+//
+//	meddler.Register("statuses", &meddler.EnumArrayMeddler{Names: map[int64]string{1: "open", 2: "closed"}})
+type EnumArrayMeddler struct {
+	Names       map[int64]string
+	SkipUnknown bool
+}
+
+func (elt *EnumArrayMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	if t := reflect.TypeOf(fieldAddr); t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice || !isIntegerKind(t.Elem().Elem().Kind()) {
+		return nil, fmt.Errorf("meddler.EnumArrayMeddler.PreRead: field must be a slice of integers, found %T", fieldAddr)
+	}
+	return new([]byte), nil
+}
+
+func (elt *EnumArrayMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	raw := *scanTarget.(*[]byte)
+	sliceVal := reflect.ValueOf(fieldAddr).Elem()
+	if raw == nil {
+		sliceVal.Set(reflect.Zero(sliceVal.Type()))
+		return nil
+	}
+
+	elements, err := parsePgArray(string(raw))
+	if err != nil {
+		return fmt.Errorf("meddler.EnumArrayMeddler.PostRead: %v", err)
+	}
+	enum := &EnumMeddler{Names: elt.Names}
+	result := reflect.MakeSlice(sliceVal.Type(), 0, len(elements))
+	for i, element := range elements {
+		var value int64
+		if element != nil {
+			if value, err = enum.value(*element); err != nil {
+				if elt.SkipUnknown {
+					continue
+				}
+				return fmt.Errorf("meddler.EnumArrayMeddler.PostRead: %v in element %d", err, i)
+			}
+		}
+		v := reflect.New(sliceVal.Type().Elem()).Elem()
+		switch v.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v.SetUint(uint64(value))
+		default:
+			v.SetInt(value)
+		}
+		result = reflect.Append(result, v)
+	}
+	sliceVal.Set(result)
+
+	return nil
+}
+
+func (elt *EnumArrayMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	sliceVal := reflect.ValueOf(field)
+	if sliceVal.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("meddler.EnumArrayMeddler.PreWrite: field must be a slice of integers, found %T", field)
+	}
+	if sliceVal.IsNil() {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := 0; i < sliceVal.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		var value int64
+		switch ev := sliceVal.Index(i); ev.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value = ev.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value = int64(ev.Uint())
+		default:
+			return nil, fmt.Errorf("meddler.EnumArrayMeddler.PreWrite: field must be a slice of integers, found %T", field)
+		}
+		name, known := elt.Names[value]
+		if !known {
+			return nil, fmt.Errorf("meddler.EnumArrayMeddler.PreWrite: unknown value %d in element %d", value, i)
+		}
+
+		// quote every element, escaping quotes and backslashes
+		buf.WriteByte('"')
+		for _, c := range []byte(name) {
+			if c == '"' || c == '\\' {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(c)
+		}
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+
+	return buf.String(), nil
+}
+
+// FlagsMeddler saves string slice fields holding the names of flags, such
+// as permissions, as an integer bit mask. Bits maps each name to the
+// position of its bit, counting from 0 for the lowest. On load, the names
+// are listed in the order of their bits. Bits set in the column without a
+// name in Bits are ignored, or an error if Strict is set. Saving a name
+// that is not in Bits is always an error, as is using a Bits map that
+// gives the same bit to two names. A null column is read as a nil slice.
+//
+// FlagsMeddler is not registered by default; register a pointer to one for
+// each set of flags:
+//
+//	meddler.Register("perms", &meddler.FlagsMeddler{Bits: map[string]uint{"read": 0, "write": 1}})
+type FlagsMeddler struct {
+	Bits   map[string]uint
+	Strict bool
+}
+
+func (elt *FlagsMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	if !isStringSlicePtr(fieldAddr) {
+		return nil, fmt.Errorf("meddler.FlagsMeddler.PreRead: field must be a slice of strings, found %T", fieldAddr)
+	}
+	return new(*int64), nil
+}
+
+func (elt *FlagsMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	fv := reflect.ValueOf(fieldAddr).Elem()
+	ptr := *scanTarget.(**int64)
+	if ptr == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+	mask := uint64(*ptr)
+	table, err := elt.names()
+	if err != nil {
+		return fmt.Errorf("meddler.FlagsMeddler.PostRead: %v", err)
+	}
+
+	names := reflect.MakeSlice(fv.Type(), 0, bits.OnesCount64(mask))
+	for bit := uint(0); bit < 64; bit++ {
+		if mask&(1<<bit) == 0 {
+			continue
+		}
+		name := table[bit]
+		if name == "" {
+			if elt.Strict {
+				return fmt.Errorf("meddler.FlagsMeddler.PostRead: unknown bit %d", bit)
+			}
+			continue
+		}
+		names = reflect.Append(names, reflect.ValueOf(name).Convert(fv.Type().Elem()))
+	}
+	fv.Set(names)
+	return nil
+}
+
+// names returns the name of each bit, checking that no bit has two.
+func (elt *FlagsMeddler) names() ([64]string, error) {
+	var table [64]string
+	for name, bit := range elt.Bits {
+		if bit > 63 {
+			return table, fmt.Errorf("bit %d of flag %q is out of range", bit, name)
+		}
+		if other := table[bit]; other != "" {
+			if other > name {
+				other, name = name, other
+			}
+			return table, fmt.Errorf("bit %d is given to both %q and %q", bit, other, name)
+		}
+		table[bit] = name
+	}
+	return table, nil
+}
+
+func (elt *FlagsMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	fv := reflect.ValueOf(field)
+	if fv.Kind() != reflect.Slice || fv.Type().Elem().Kind() != reflect.String {
+		return nil, fmt.Errorf("meddler.FlagsMeddler.PreWrite: field must be a slice of strings, found %T", field)
+	}
+	if _, err := elt.names(); err != nil {
+		return nil, fmt.Errorf("meddler.FlagsMeddler.PreWrite: %v", err)
+	}
+	var mask uint64
+	for i := 0; i < fv.Len(); i++ {
+		name := fv.Index(i).String()
+		bit, known := elt.Bits[name]
+		if !known {
+			return nil, fmt.Errorf("meddler.FlagsMeddler.PreWrite: unknown flag %q", name)
+		}
+		mask |= 1 << bit
+	}
+	return int64(mask), nil
+}
+
+// NormalizeMeddler saves string fields, and pointers to them, in a
+// normalized form given by Normalize, such as lowercased e-mail
+// addresses, so that a unique index on the column ignores the
+// differences it removes. The field keeps the value as it was entered
+// until it is loaded again, which reads the stored form as it is. A nil
+// pointer is saved as null. It is registered as "normalize", using
+// strings.ToLower; register another one for other normalizations, such
+// as Unicode NFC using golang.org/x/text/unicode/norm:
+//
+//	meddler.Register("nfc", meddler.NormalizeMeddler{Normalize: norm.NFC.String})
+type NormalizeMeddler struct {
+	Normalize func(string) string
+}
+
+func (elt NormalizeMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	return fieldAddr, nil
+}
+
+func (elt NormalizeMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	return nil
+}
+
+func (elt NormalizeMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	v := reflect.ValueOf(field)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String {
+		return nil, fmt.Errorf("meddler.NormalizeMeddler.PreWrite: field must be a string, found %T", field)
+	}
+	return elt.Normalize(v.String()), nil
+}
+
+func isStringSlicePtr(fieldAddr interface{}) bool {
+	t := reflect.TypeOf(fieldAddr)
+	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice && t.Elem().Elem().Kind() == reflect.String
+}
+
+func isIntegerPtr(fieldAddr interface{}) bool {
+	t := reflect.TypeOf(fieldAddr)
+	if t.Kind() != reflect.Ptr {
+		return false
+	}
+	switch t.Elem().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// PgArrayMeddler handles PostgreSQL arrays of JSON values, such as jsonb[]
+// columns or the result of array_agg over json values. Each element of the
+// array is decoded as JSON into an element of a slice field. Null elements
+// become zero values, and a null array becomes a nil slice. Nested arrays
+// are not supported.
+type PgArrayMeddler bool
+
+func (elt PgArrayMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	if t := reflect.TypeOf(fieldAddr); t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("meddler.PgArrayMeddler.PreRead: field must be a slice, found %T", fieldAddr)
+	}
+
+	// give a pointer to a byte buffer to grab the raw data
+	return new([]byte), nil
+}
+
+func (elt PgArrayMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	raw := *scanTarget.(*[]byte)
+	sliceVal := reflect.ValueOf(fieldAddr).Elem()
+	if raw == nil {
+		sliceVal.Set(reflect.Zero(sliceVal.Type()))
+		return nil
+	}
+
+	elements, err := parsePgArray(string(raw))
+	if err != nil {
+		return fmt.Errorf("meddler.PgArrayMeddler.PostRead: %v", err)
+	}
+	result := reflect.MakeSlice(sliceVal.Type(), len(elements), len(elements))
+	for i, element := range elements {
+		if element == nil {
+			continue
+		}
+		if err := json.Unmarshal([]byte(*element), result.Index(i).Addr().Interface()); err != nil {
+			return fmt.Errorf("meddler.PgArrayMeddler.PostRead: JSON decode error in element %d: %v", i, err)
+		}
+	}
+	sliceVal.Set(result)
+
+	return nil
+}
+
+func (elt PgArrayMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	sliceVal := reflect.ValueOf(field)
+	if sliceVal.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("meddler.PgArrayMeddler.PreWrite: field must be a slice, found %T", field)
+	}
+	if sliceVal.IsNil() {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := 0; i < sliceVal.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encoded, err := json.Marshal(sliceVal.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("meddler.PgArrayMeddler.PreWrite: JSON encoding error in element %d: %v", i, err)
+		}
+
+		// quote every element, escaping quotes and backslashes
+		buf.WriteByte('"')
+		for _, c := range encoded {
+			if c == '"' || c == '\\' {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(c)
+		}
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+
+	return buf.String(), nil
+}
+
+// parsePgArray splits the text form of a one-dimensional PostgreSQL array
+// into its elements. Null elements are returned as nil.
+func parsePgArray(s string) ([]*string, error) {
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, fmt.Errorf("invalid array literal %q", s)
+	}
+	s = s[1 : len(s)-1]
+
+	var elements []*string
+	for i := 0; i < len(s); {
+		var element []byte
+		quoted := s[i] == '"'
+		if quoted {
+			for i++; ; i++ {
+				if i >= len(s) {
+					return nil, fmt.Errorf("unterminated quoted element in array literal")
+				}
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				} else if s[i] == '"' {
+					i++
+					break
+				}
+				element = append(element, s[i])
+			}
+		} else {
+			for ; i < len(s) && s[i] != ','; i++ {
+				if s[i] == '{' {
+					return nil, fmt.Errorf("nested arrays are not supported")
+				}
+				element = append(element, s[i])
+			}
+		}
+
+		if !quoted && strings.EqualFold(string(element), "NULL") {
+			elements = append(elements, nil)
+		} else {
+			str := string(element)
+			elements = append(elements, &str)
+		}
+
+		if i < len(s) {
+			if s[i] != ',' {
+				return nil, fmt.Errorf("expected comma in array literal at offset %d", i+1)
+			}
+			i++
+			if i == len(s) {
+				return nil, fmt.Errorf("trailing comma in array literal")
+			}
+		}
+	}
+
+	return elements, nil
+}
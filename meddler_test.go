@@ -1,7 +1,13 @@
 package meddler
 
 import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type ItemJson struct {
@@ -64,6 +70,184 @@ func TestJsonMeddler(t *testing.T) {
 	}
 }
 
+func TestJsonMeddlerSlice(t *testing.T) {
+	once.Do(setup)
+
+	type Series struct {
+		ID     int64  `meddler:"id,pk"`
+		Points []int  `meddler:"points,json"`
+		Pair   [2]int `meddler:"pair,json"`
+	}
+	if _, err := db.Exec("create table series (id integer primary key, points text, pair text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table series")
+
+	elt := &Series{Points: []int{3, 1, 2}, Pair: [2]int{4, 5}}
+	if err := Insert(db, "series", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var points, pair string
+	if err := db.QueryRow("select points, pair from series where id = ?", elt.ID).Scan(&points, &pair); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if points != "[3,1,2]\n" || pair != "[4,5]\n" {
+		t.Errorf("expected JSON arrays, found %q and %q", points, pair)
+	}
+
+	loaded := new(Series)
+	if err := Load(db, "series", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, elt) {
+		t.Errorf("expected %v, found %v", elt, loaded)
+	}
+
+	// null columns give the zero value
+	if _, err := db.Exec("update series set points = null, pair = null where id = ?", elt.ID); err != nil {
+		t.Fatalf("DB error on update: %v", err)
+	}
+	if err := Load(db, "series", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Points != nil || loaded.Pair != [2]int{} {
+		t.Errorf("expected a nil slice and a zero array, found %v and %v", loaded.Points, loaded.Pair)
+	}
+}
+
+func TestBindValue(t *testing.T) {
+	once.Do(setup)
+
+	elt := &ItemJson{Stuff: map[string]bool{"hello": true}, StuffZ: map[string]bool{}}
+	if err := Save(db, "item", elt); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	defer db.Exec("delete from `item`")
+
+	// a filter value is encoded the same way the stored value was
+	val, err := BindValue(new(ItemJson), "stuff", map[string]bool{"hello": true})
+	if err != nil {
+		t.Fatalf("BindValue error: %v", err)
+	}
+	var id int64
+	if err := db.QueryRow("select id from item where stuff = ?", val).Scan(&id); err != nil {
+		t.Fatalf("DB error finding the item by its bound value: %v", err)
+	}
+	if id != elt.ID {
+		t.Errorf("expected id %d, found %d", elt.ID, id)
+	}
+
+	// values convertible to the field type are accepted
+	type Stamped struct {
+		ID   int64     `meddler:"id,pk"`
+		When time.Time `meddler:"when,utctime"`
+		Age  int64     `meddler:"age,zeroisnull"`
+	}
+	if val, err := BindValue(new(Stamped), "age", 0); err != nil || val != nil {
+		t.Errorf("expected a zero age to bind as nil, found %v, %v", val, err)
+	}
+	local := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("east", 3600))
+	if val, err := BindValue(new(Stamped), "when", local); err != nil || val != local.UTC() {
+		t.Errorf("expected %v, found %v, %v", local.UTC(), val, err)
+	}
+
+	if _, err := BindValue(new(Stamped), "missing", 1); err == nil {
+		t.Errorf("expected an error for an unknown column")
+	}
+	if _, err := BindValue(new(Stamped), "when", "yesterday"); err == nil {
+		t.Errorf("expected an error for a value of the wrong type")
+	}
+
+	// conversions only within the same kind of value
+	type Named struct {
+		ID   int64  `meddler:"id,pk"`
+		Name string `meddler:"name"`
+	}
+	if val, err := BindValue(new(Named), "id", int32(5)); err != nil || val != int64(5) {
+		t.Errorf("expected int64(5), found %#v, %v", val, err)
+	}
+	if _, err := BindValue(new(Named), "name", 65); err == nil {
+		t.Errorf("expected an error converting an int to a string")
+	}
+	if _, err := BindValue(new(Named), "id", 2.9); err == nil {
+		t.Errorf("expected an error converting a float to an int")
+	}
+}
+
+type ItemCompact struct {
+	ID    int64          `meddler:"id,pk"`
+	Stuff map[string]int `meddler:"stuff,jsoncompact"`
+}
+
+func TestCompactJSONMeddler(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table itemcompact (id integer primary key, stuff blob)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table itemcompact")
+
+	large := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		large[fmt.Sprintf("key%d", i)] = i
+	}
+	for _, test := range []struct {
+		stuff  map[string]int
+		header byte
+	}{
+		{map[string]int{"a": 1}, 0},
+		{large, 1},
+	} {
+		elt := &ItemCompact{Stuff: test.stuff}
+		if err := Insert(db, "itemcompact", elt); err != nil {
+			t.Fatalf("Insert error: %v", err)
+		}
+		var raw []byte
+		if err := db.QueryRow("select stuff from itemcompact where id = ?", elt.ID).Scan(&raw); err != nil {
+			t.Fatalf("DB error on query: %v", err)
+		}
+		if len(raw) == 0 || raw[0] != test.header {
+			t.Errorf("expected header byte %d, found %v", test.header, raw)
+		}
+		loaded := new(ItemCompact)
+		if err := Load(db, "itemcompact", loaded, elt.ID); err != nil {
+			t.Fatalf("Load error: %v", err)
+		}
+		if !reflect.DeepEqual(loaded.Stuff, test.stuff) {
+			t.Errorf("expected %v, found %v", test.stuff, loaded.Stuff)
+		}
+	}
+
+	// values written by jsongzip are understood
+	zipped, err := JSONMeddler(true).PreWrite(large)
+	if err != nil {
+		t.Fatalf("PreWrite error: %v", err)
+	}
+	res, err := db.Exec("insert into itemcompact (stuff) values (?)", zipped)
+	if err != nil {
+		t.Fatalf("DB error on insert: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	loaded := new(ItemCompact)
+	if err := Load(db, "itemcompact", loaded, id); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Stuff, large) {
+		t.Errorf("expected the jsongzip value, found %v", loaded.Stuff)
+	}
+
+	// null is read as the zero value
+	if _, err := db.Exec("update itemcompact set stuff = null where id = ?", id); err != nil {
+		t.Fatalf("DB error on update: %v", err)
+	}
+	if err := Load(db, "itemcompact", loaded, id); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Stuff != nil {
+		t.Errorf("expected a nil map for null, found %v", loaded.Stuff)
+	}
+}
+
 func TestGobMeddler(t *testing.T) {
 	once.Do(setup)
 
@@ -111,3 +295,861 @@ func TestGobMeddler(t *testing.T) {
 		t.Errorf("error wiping item table: %v", err)
 	}
 }
+
+func TestDatabaseRegister(t *testing.T) {
+	once.Do(setup)
+
+	// a scoped "json" meddler that actually uses gob
+	scoped := *SQLite
+	scoped.Register("json", GobMeddler(false))
+
+	data, err := scoped.getFields(reflect.TypeOf((*ItemJson)(nil)))
+	if err != nil {
+		t.Fatalf("Error in getFields: %v", err)
+	}
+	if data.fields["stuff"].meddler != GobMeddler(false) {
+		t.Errorf("expected scoped meddler to shadow the global one")
+	}
+	if data.fields["stuffz"].meddler != registry["jsongzip"] {
+		t.Errorf("expected unshadowed meddler to fall back to the global one")
+	}
+	data, err = SQLite.getFields(reflect.TypeOf((*ItemJson)(nil)))
+	if err != nil {
+		t.Fatalf("Error in getFields: %v", err)
+	}
+	if data.fields["stuff"].meddler != registry["json"] {
+		t.Errorf("expected other databases to keep using the global meddler")
+	}
+
+	elt := &ItemJson{
+		Stuff:  map[string]bool{"hello": true},
+		StuffZ: map[string]bool{"world": true},
+	}
+	if err := scoped.Save(db, "item", elt); err != nil {
+		t.Errorf("Save error: %v", err)
+	}
+
+	// the stored value is gob, so only the scoped database can read it
+	loaded := new(ItemJson)
+	if err := scoped.Load(db, "item", loaded, elt.ID); err != nil {
+		t.Errorf("Load error: %v", err)
+	}
+	if !loaded.Stuff["hello"] || !loaded.StuffZ["world"] {
+		t.Errorf("contents wrong: %v %v", loaded.Stuff, loaded.StuffZ)
+	}
+	if err := SQLite.Load(db, "item", new(ItemJson), elt.ID); err == nil {
+		t.Errorf("expected global json meddler to fail on gob data")
+	}
+	if _, err := db.Exec("delete from `item`"); err != nil {
+		t.Errorf("error wiping item table: %v", err)
+	}
+
+	// registering on a copy leaves the original alone
+	copied := scoped
+	copied.Register("json", JSONMeddler(false))
+	data, err = scoped.getFields(reflect.TypeOf((*ItemJson)(nil)))
+	if err != nil {
+		t.Fatalf("Error in getFields: %v", err)
+	}
+	if data.fields["stuff"].meddler != GobMeddler(false) {
+		t.Errorf("expected the original to keep its scoped meddler")
+	}
+	if m, _ := scoped.lookupMeddler("json"); m != GobMeddler(false) {
+		t.Errorf("expected the original registry to be unchanged, found %v", m)
+	}
+	data, err = copied.getFields(reflect.TypeOf((*ItemJson)(nil)))
+	if err != nil {
+		t.Fatalf("Error in getFields: %v", err)
+	}
+	if data.fields["stuff"].meddler != JSONMeddler(false) {
+		t.Errorf("expected the copy to use its own meddler")
+	}
+
+	// cached data is dropped on request
+	copied.ForgetFields()
+	fieldsCacheMutex.Lock()
+	for key := range fieldsCache {
+		if key.db == &copied {
+			t.Errorf("expected no cached data for %v after ForgetFields", key.typ)
+		}
+	}
+	fieldsCacheMutex.Unlock()
+}
+
+type Flag struct {
+	ID      int64 `meddler:"id,pk"`
+	Enabled bool  `meddler:"enabled"`
+}
+
+func TestBoolAcrossDialects(t *testing.T) {
+	once.Do(setup)
+
+	// a tinyint column, as bools are stored by MySQL
+	if _, err := db.Exec("create table flag (id integer primary key, enabled tinyint not null)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table flag")
+
+	for _, d := range []*Database{MySQL, SQLite} {
+		for _, enabled := range []bool{true, false} {
+			elt := &Flag{Enabled: enabled}
+			if err := d.Insert(db, "flag", elt); err != nil {
+				t.Fatalf("%s: Insert error: %v", d.Name, err)
+			}
+			var stored int64
+			if err := db.QueryRow("select enabled from flag where id = ?", elt.ID).Scan(&stored); err != nil {
+				t.Fatalf("%s: DB error on query: %v", d.Name, err)
+			}
+			if enabled && stored != 1 || !enabled && stored != 0 {
+				t.Errorf("%s: expected %v to be stored as an integer, found %d", d.Name, enabled, stored)
+			}
+			loaded := new(Flag)
+			if err := d.Load(db, "flag", loaded, elt.ID); err != nil {
+				t.Fatalf("%s: Load error: %v", d.Name, err)
+			}
+			if loaded.Enabled != enabled {
+				t.Errorf("%s: expected %v, found %v", d.Name, enabled, loaded.Enabled)
+			}
+		}
+	}
+
+	// drivers using a text protocol send a tinyint as text
+	elt := new(Flag)
+	if err := QueryRow(db, elt, "select 1 as id, '1' as enabled"); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if !elt.Enabled {
+		t.Errorf("expected text 1 to be read as true")
+	}
+}
+
+func TestMySQLTimeMeddler(t *testing.T) {
+	m := MySQLTimeMeddler{}
+	for _, raw := range []interface{}{[]byte("0000-00-00 00:00:00"), "0000-00-00", nil, time.Time{}} {
+		when := time.Now()
+		target, err := m.PreRead(&when)
+		if err != nil {
+			t.Fatalf("PreRead error: %v", err)
+		}
+		*target.(*interface{}) = raw
+		if err := m.PostRead(&when, target); err != nil {
+			t.Errorf("PostRead error on %v: %v", raw, err)
+		}
+		if !when.IsZero() {
+			t.Errorf("expected zero time for %v, found %v", raw, when)
+		}
+	}
+
+	var when time.Time
+	target, _ := m.PreRead(&when)
+	*target.(*interface{}) = []byte("2013-06-23 15:30:12")
+	if err := m.PostRead(&when, target); err != nil {
+		t.Errorf("PostRead error: %v", err)
+	}
+	if expected := time.Date(2013, 6, 23, 15, 30, 12, 0, time.UTC); !when.Equal(expected) {
+		t.Errorf("expected %v, found %v", expected, when)
+	}
+
+	*target.(*interface{}) = []byte("not a time")
+	if err := m.PostRead(&when, target); err == nil {
+		t.Errorf("expected an error for an unparsable time")
+	}
+
+	if val, _ := m.PreWrite(time.Time{}); val != mysqlZeroDate {
+		t.Errorf("expected zero date, found %v", val)
+	}
+	if val, _ := (MySQLTimeMeddler{ZeroIsNull: true}).PreWrite(time.Time{}); val != nil {
+		t.Errorf("expected null, found %v", val)
+	}
+}
+
+type Event struct {
+	ID int64     `meddler:"id,pk"`
+	At time.Time `meddler:",datetime,columns=event_date+event_time"`
+}
+
+func TestDateTimeMeddler(t *testing.T) {
+	once.Do(setup)
+
+	names, err := Columns(new(Event), false)
+	if err != nil {
+		t.Fatalf("Error getting Columns: %v", err)
+	}
+	if len(names) != 2 || names[0] != "event_date" || names[1] != "event_time" {
+		t.Errorf("unexpected columns: %v", names)
+	}
+
+	at := time.Date(2013, 6, 23, 15, 30, 12, 0, time.UTC)
+	elt := &Event{At: at.In(time.FixedZone("UTC+2", 2*60*60))}
+	if err := Insert(db, "event", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var date, clock string
+	if err := db.QueryRow("select event_date, event_time from event where id = ?", elt.ID).Scan(&date, &clock); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if date != "2013-06-23" || clock != "15:30:12" {
+		t.Errorf("expected separate date and time in UTC, found %s and %s", date, clock)
+	}
+
+	loaded := new(Event)
+	if err := Load(db, "event", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !loaded.At.Equal(at) {
+		t.Errorf("expected %v, found %v", at, loaded.At)
+	}
+
+	// the zero time is stored as nulls
+	empty := new(Event)
+	if err := Insert(db, "event", empty); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	loaded.At = time.Now()
+	if err := Load(db, "event", loaded, empty.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !loaded.At.IsZero() {
+		t.Errorf("expected zero time, found %v", loaded.At)
+	}
+
+	// both columns are needed
+	half := new(Event)
+	err = QueryRow(db, half, "select id, event_date from event where id = ?", elt.ID)
+	if err == nil {
+		t.Errorf("expected an error when only the date column is read")
+	}
+	db.Exec("delete from event")
+}
+
+type Shift struct {
+	ID      int64      `meddler:"id,pk"`
+	Eastern time.Time  `meddler:"eastern_at,tz=America/New_York"`
+	Tokyo   *time.Time `meddler:"tokyo_at,tz=Asia/Tokyo"`
+}
+
+func TestZoneTimeMeddler(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table shift (id integer primary key, eastern_at datetime, tokyo_at datetime)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table shift")
+
+	at := time.Date(2013, 6, 23, 15, 30, 12, 0, time.UTC)
+	elt := &Shift{Eastern: at, Tokyo: &at}
+	if err := Insert(db, "shift", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var eastern, tokyo string
+	if err := db.QueryRow("select cast(eastern_at as text), cast(tokyo_at as text) from shift where id = ?", elt.ID).Scan(&eastern, &tokyo); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if !strings.HasPrefix(eastern, "2013-06-23 11:30:12") || !strings.HasPrefix(tokyo, "2013-06-24 00:30:12") {
+		t.Errorf("expected wall clock times of each zone, found %s and %s", eastern, tokyo)
+	}
+
+	loaded := new(Shift)
+	if err := Load(db, "shift", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !loaded.Eastern.Equal(at) || loaded.Eastern.Location().String() != "America/New_York" {
+		t.Errorf("expected %v in America/New_York, found %v", at, loaded.Eastern)
+	}
+	if loaded.Tokyo == nil || !loaded.Tokyo.Equal(at) || loaded.Tokyo.Location().String() != "Asia/Tokyo" {
+		t.Errorf("expected %v in Asia/Tokyo, found %v", at, loaded.Tokyo)
+	}
+
+	// zero and nil are null
+	empty := new(Shift)
+	if err := Insert(db, "shift", empty); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if err := Load(db, "shift", loaded, empty.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !loaded.Eastern.IsZero() || loaded.Tokyo != nil {
+		t.Errorf("expected zero values, found %v", loaded)
+	}
+
+	type BadZone struct {
+		ID int64     `meddler:"id,pk"`
+		At time.Time `meddler:"at,tz=Nowhere/Special"`
+	}
+	if _, err := Columns(new(BadZone), true); err == nil {
+		t.Errorf("expected an error for an unknown time zone")
+	}
+}
+
+type Interval struct {
+	ID     int64         `meddler:"id,pk"`
+	Start  time.Time     `meddler:"start,iso8601time"`
+	End    *time.Time    `meddler:"end,iso8601time"`
+	Length time.Duration `meddler:"length,iso8601duration"`
+}
+
+func TestISO8601Meddlers(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec(`create table interval (id integer primary key, start text, "end" text, length text)`); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table interval")
+
+	start := time.Date(2013, 6, 23, 15, 30, 12, 500000000, time.FixedZone("UTC+2", 2*60*60))
+	end := start.Add(90*time.Minute + 30*time.Second)
+	elt := &Interval{Start: start, End: &end, Length: end.Sub(start)}
+	if err := SQLite.Insert(db, "interval", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var startText, endText, lengthText string
+	if err := db.QueryRow(`select start, "end", length from interval where id = ?`, elt.ID).Scan(&startText, &endText, &lengthText); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if startText != "2013-06-23T13:30:12.5Z" || endText != "2013-06-23T15:00:42.5Z" || lengthText != "PT1H30M30S" {
+		t.Errorf("unexpected text columns %s, %s, %s", startText, endText, lengthText)
+	}
+
+	loaded := new(Interval)
+	if err := SQLite.Load(db, "interval", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !loaded.Start.Equal(start) || loaded.End == nil || !loaded.End.Equal(end) || loaded.Length != elt.Length {
+		t.Errorf("expected %v, found %v", elt, loaded)
+	}
+
+	// malformed text is an error
+	for _, update := range []string{
+		"update interval set start = 'yesterday'",
+		"update interval set length = '90 minutes'",
+	} {
+		if _, err := db.Exec(update); err != nil {
+			t.Fatalf("DB error on update: %v", err)
+		}
+		if err := SQLite.Load(db, "interval", loaded, elt.ID); err == nil {
+			t.Errorf("%s: expected an error", update)
+		}
+	}
+}
+
+func TestISO8601Duration(t *testing.T) {
+	for _, test := range []struct {
+		d    time.Duration
+		text string
+	}{
+		{0, "PT0S"},
+		{90 * time.Minute, "PT1H30M"},
+		{36 * time.Hour, "PT36H"},
+		{1500 * time.Millisecond, "PT1.5S"},
+		{time.Nanosecond, "PT0.000000001S"},
+		{-(2*time.Hour + 5*time.Second), "-PT2H5S"},
+	} {
+		if text := formatISO8601Duration(test.d); text != test.text {
+			t.Errorf("format %v: expected %s, found %s", test.d, test.text, text)
+		}
+		if d, err := parseISO8601Duration(test.text); err != nil || d != test.d {
+			t.Errorf("parse %s: expected %v, found %v, %v", test.text, test.d, d, err)
+		}
+	}
+
+	for text, expected := range map[string]time.Duration{
+		"P1D":      24 * time.Hour,
+		"P1W":      7 * 24 * time.Hour,
+		"P1DT12H":  36 * time.Hour,
+		"PT0,5H":   30 * time.Minute,
+		"PT1M0.5S": time.Minute + 500*time.Millisecond,
+	} {
+		if d, err := parseISO8601Duration(text); err != nil || d != expected {
+			t.Errorf("parse %s: expected %v, found %v, %v", text, expected, d, err)
+		}
+	}
+
+	for _, text := range []string{"", "P", "PT", "1H", "PT1D", "P1H", "P1Y", "P2M", "PT1.2.3S", "PTH", "P1DT"} {
+		if _, err := parseISO8601Duration(text); err == nil {
+			t.Errorf("parse %q: expected an error", text)
+		}
+	}
+}
+
+type Timer struct {
+	ID     int64         `meddler:"id,pk"`
+	Period time.Duration `meddler:"period,interval"`
+}
+
+func TestIntervalMeddler(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table timer (id integer primary key, period text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table timer")
+
+	elt := &Timer{Period: 90 * time.Minute}
+	if err := Insert(db, "timer", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var text string
+	if err := db.QueryRow("select period from timer where id = ?", elt.ID).Scan(&text); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if text != "1:30:00" {
+		t.Errorf("expected 1:30:00, found %s", text)
+	}
+
+	// the forms PostgreSQL may send are understood
+	for stored, expected := range map[string]time.Duration{
+		"1:30:00":                90 * time.Minute,
+		"90 minutes":             90 * time.Minute,
+		"01:30:00.25":            90*time.Minute + 250*time.Millisecond,
+		"1 day 02:00:00":         26 * time.Hour,
+		"2 days -01:00:00":       47 * time.Hour,
+		"-00:00:05":              -5 * time.Second,
+		"@ 1 hour 30 mins":       90 * time.Minute,
+		"@ 3 secs ago":           -3 * time.Second,
+		"1 week 500 ms":          7*24*time.Hour + 500*time.Millisecond,
+		"PT1H30M":                90 * time.Minute,
+		"00:00:00":               0,
+		"36:00:00":               36 * time.Hour,
+		"1 hour 15 minutes 10 s": time.Hour + 15*time.Minute + 10*time.Second,
+	} {
+		if _, err := db.Exec("update timer set period = ? where id = ?", stored, elt.ID); err != nil {
+			t.Fatalf("DB error on update: %v", err)
+		}
+		loaded := new(Timer)
+		if err := Load(db, "timer", loaded, elt.ID); err != nil {
+			t.Errorf("Load error on %s: %v", stored, err)
+			continue
+		}
+		if loaded.Period != expected {
+			t.Errorf("%s: expected %v, found %v", stored, expected, loaded.Period)
+		}
+	}
+
+	for _, stored := range []string{"soon", "1 mon", "2 years", "90", "1:2:3:4", "5 fortnights", ""} {
+		if _, err := db.Exec("update timer set period = ? where id = ?", stored, elt.ID); err != nil {
+			t.Fatalf("DB error on update: %v", err)
+		}
+		if err := Load(db, "timer", new(Timer), elt.ID); err == nil {
+			t.Errorf("%q: expected an error", stored)
+		}
+	}
+
+	for d, expected := range map[time.Duration]string{
+		0:                       "0:00:00",
+		-90 * time.Second:       "-0:01:30",
+		1500 * time.Millisecond: "0:00:01.5",
+		49 * time.Hour:          "49:00:00",
+	} {
+		if text := formatInterval(d); text != expected {
+			t.Errorf("format %v: expected %s, found %s", d, expected, text)
+		}
+	}
+}
+
+// RawID is a UUID type with its own text form
+type RawID [16]byte
+
+func (id RawID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// BinaryID is a UUID type that marshals itself
+type BinaryID struct {
+	hi, lo uint64
+}
+
+func (id BinaryID) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, id.hi)
+	binary.BigEndian.PutUint64(b[8:], id.lo)
+	return b, nil
+}
+
+func (id *BinaryID) UnmarshalBinary(b []byte) error {
+	id.hi = binary.BigEndian.Uint64(b)
+	id.lo = binary.BigEndian.Uint64(b[8:])
+	return nil
+}
+
+type Token struct {
+	ID      int64     `meddler:"id,pk"`
+	Raw     RawID     `meddler:"raw,uuidbin"`
+	Binary  BinaryID  `meddler:"bin,uuidbin"`
+	Parent  *RawID    `meddler:"parent,uuidbin"`
+	Partner *BinaryID `meddler:"partner,uuidbin"`
+}
+
+func TestUUIDBinaryMeddler(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table token (id integer primary key, raw blob, bin blob, parent blob, partner blob)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table token")
+
+	raw := RawID{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x41, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+	text := raw.String()
+	elt := &Token{Raw: raw, Binary: BinaryID{hi: 1, lo: 2}, Parent: &raw}
+	if err := Insert(db, "token", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var length int
+	var partner []byte
+	if err := db.QueryRow("select length(raw), partner from token where id = ?", elt.ID).Scan(&length, &partner); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if length != 16 || partner != nil {
+		t.Errorf("expected 16 bytes and a null partner, found %d and %v", length, partner)
+	}
+
+	loaded := new(Token)
+	if err := Load(db, "token", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Raw.String() != text || loaded.Parent == nil || loaded.Parent.String() != text {
+		t.Errorf("expected %s, found %s and %v", text, loaded.Raw, loaded.Parent)
+	}
+	if loaded.Binary != elt.Binary || loaded.Partner != nil {
+		t.Errorf("unexpected binary ids %v and %v", loaded.Binary, loaded.Partner)
+	}
+
+	// wrong lengths are rejected
+	db.Exec("update token set raw = x'0102' where id = ?", elt.ID)
+	if err := Load(db, "token", loaded, elt.ID); err == nil {
+		t.Errorf("expected an error reading 2 bytes")
+	}
+}
+
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type ItemPgArray struct {
+	ID     int64  `meddler:"id,pk"`
+	Stuff  []Tag  `meddler:"stuff,pgarray"`
+	StuffZ []byte `meddler:"stuffz"`
+}
+
+func TestPgArrayMeddler(t *testing.T) {
+	once.Do(setup)
+
+	m := PgArrayMeddler(false)
+	var tags []Tag
+	target, err := m.PreRead(&tags)
+	if err != nil {
+		t.Fatalf("PreRead error: %v", err)
+	}
+	*target.(*[]byte) = []byte(`{"{\"name\": \"a\", \"count\": 1}","{\"name\": \"b,\\\\c\", \"count\": 2}",NULL}`)
+	if err := m.PostRead(&tags, target); err != nil {
+		t.Fatalf("PostRead error: %v", err)
+	}
+	expected := []Tag{{"a", 1}, {`b,\c`, 2}, {}}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, found %v", expected, tags)
+	}
+
+	*target.(*[]byte) = nil
+	if err := m.PostRead(&tags, target); err != nil || tags != nil {
+		t.Errorf("expected a nil slice for a null array, found %v (%v)", tags, err)
+	}
+	for _, bad := range []string{`{"unterminated}`, `{{"nested"}}`, `not an array`, `{"a",}`} {
+		*target.(*[]byte) = []byte(bad)
+		if err := m.PostRead(&tags, target); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+
+	// round trip through the database
+	elt := &ItemPgArray{Stuff: expected[:2], StuffZ: []byte{}}
+	if err := Insert(db, "item", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	loaded := new(ItemPgArray)
+	if err := Load(db, "item", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Stuff, expected[:2]) {
+		t.Errorf("expected %v, found %v", expected[:2], loaded.Stuff)
+	}
+	if _, err := db.Exec("delete from `item`"); err != nil {
+		t.Errorf("error wiping item table: %v", err)
+	}
+}
+
+type Status int
+
+func TestEnumMeddler(t *testing.T) {
+	m := &EnumMeddler{Names: map[int64]string{1: "open", 2: "closed"}}
+
+	for _, raw := range []interface{}{"closed", []byte("closed"), int64(2), []byte("2")} {
+		var status Status
+		target, err := m.PreRead(&status)
+		if err != nil {
+			t.Fatalf("PreRead error: %v", err)
+		}
+		*target.(*interface{}) = raw
+		if err := m.PostRead(&status, target); err != nil {
+			t.Errorf("PostRead error on %v: %v", raw, err)
+		}
+		if status != 2 {
+			t.Errorf("expected 2 for %v, found %d", raw, status)
+		}
+	}
+
+	var status Status
+	target, _ := m.PreRead(&status)
+	for _, raw := range []interface{}{"pending", int64(3), []byte("7")} {
+		*target.(*interface{}) = raw
+		if err := m.PostRead(&status, target); err == nil {
+			t.Errorf("expected an error for %v", raw)
+		}
+	}
+	if _, err := m.PreRead(new(string)); err == nil {
+		t.Errorf("expected an error for a string field")
+	}
+
+	if val, err := m.PreWrite(Status(1)); err != nil || val != "open" {
+		t.Errorf("expected open, found %v (%v)", val, err)
+	}
+	if _, err := m.PreWrite(Status(5)); err == nil {
+		t.Errorf("expected an error writing an unknown value")
+	}
+}
+
+type Ticket struct {
+	ID       int64    `meddler:"id,pk"`
+	Statuses []Status `meddler:"statuses,statuses"`
+}
+
+func TestNormalizeMeddler(t *testing.T) {
+	once.Do(setup)
+
+	type Login struct {
+		ID    int64   `meddler:"id,pk"`
+		Email string  `meddler:"email,normalize"`
+		Alias *string `meddler:"alias,normalize"`
+	}
+	if _, err := db.Exec("create table login (id integer primary key, email text not null unique, alias text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table login")
+
+	alias := "Ally"
+	elt := &Login{Email: "Alice@Example.COM", Alias: &alias}
+	if err := Insert(db, "login", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if elt.Email != "Alice@Example.COM" {
+		t.Errorf("expected the field to be left alone, found %s", elt.Email)
+	}
+	loaded := new(Login)
+	if err := Load(db, "login", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Email != "alice@example.com" || loaded.Alias == nil || *loaded.Alias != "ally" {
+		t.Errorf("expected the normalized values, found %s and %v", loaded.Email, loaded.Alias)
+	}
+
+	// the unique index now ignores case
+	if err := Insert(db, "login", &Login{Email: "ALICE@example.com"}); err == nil {
+		t.Errorf("expected a unique violation for the same address in other case")
+	}
+	other := &Login{Email: "Bob@Example.com"}
+	if err := Insert(db, "login", other); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if err := Load(db, "login", loaded, other.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Alias != nil {
+		t.Errorf("expected a nil alias, found %v", *loaded.Alias)
+	}
+
+	if _, err := (NormalizeMeddler{Normalize: strings.ToLower}).PreWrite(42); err == nil {
+		t.Errorf("expected an error for a non-string field")
+	}
+}
+
+func TestEnumArrayMeddler(t *testing.T) {
+	once.Do(setup)
+
+	m := &EnumArrayMeddler{Names: map[int64]string{1: "open", 2: "closed"}}
+	d := *SQLite
+	d.Register("statuses", m)
+	if _, err := db.Exec("create table ticket (id integer primary key, statuses text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table ticket")
+
+	elt := &Ticket{Statuses: []Status{2, 1}}
+	if err := d.Insert(db, "ticket", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var raw string
+	if err := db.QueryRow("select statuses from ticket where id = ?", elt.ID).Scan(&raw); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if raw != `{"closed","open"}` {
+		t.Errorf("expected {\"closed\",\"open\"}, found %s", raw)
+	}
+	loaded := new(Ticket)
+	if err := d.Load(db, "ticket", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Statuses, []Status{2, 1}) {
+		t.Errorf("expected [2 1], found %v", loaded.Statuses)
+	}
+
+	// unknown names
+	db.Exec("update ticket set statuses = '{open,pending,NULL}' where id = ?", elt.ID)
+	if err := d.Load(db, "ticket", loaded, elt.ID); err == nil {
+		t.Errorf("expected an error for an unknown name")
+	}
+	m.SkipUnknown = true
+	if err := d.Load(db, "ticket", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Statuses, []Status{1, 0}) {
+		t.Errorf("expected [1 0], found %v", loaded.Statuses)
+	}
+
+	db.Exec("update ticket set statuses = null where id = ?", elt.ID)
+	if err := d.Load(db, "ticket", loaded, elt.ID); err != nil || loaded.Statuses != nil {
+		t.Errorf("expected a nil slice for a null array, found %v (%v)", loaded.Statuses, err)
+	}
+	if _, err := m.PreWrite([]Status{3}); err == nil {
+		t.Errorf("expected an error writing an unknown value")
+	}
+	if _, err := m.PreRead(new([]string)); err == nil {
+		t.Errorf("expected an error for a slice of strings")
+	}
+}
+
+// Perms is a set of flags saved as a bit mask
+type Perms []string
+
+type Grant struct {
+	ID    int64 `meddler:"id,pk"`
+	Perms Perms `meddler:"perms,perms"`
+}
+
+func TestFlagsMeddler(t *testing.T) {
+	once.Do(setup)
+
+	m := &FlagsMeddler{Bits: map[string]uint{"read": 0, "write": 1, "admin": 4}}
+	d := *SQLite
+	d.Register("perms", m)
+	if _, err := db.Exec("create table grant (id integer primary key, perms integer)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table grant")
+
+	elt := &Grant{Perms: Perms{"admin", "read"}}
+	if err := d.Insert(db, "grant", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var mask int64
+	if err := db.QueryRow("select perms from grant where id = ?", elt.ID).Scan(&mask); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if mask != 17 {
+		t.Errorf("expected mask 17, found %d", mask)
+	}
+	loaded := new(Grant)
+	if err := d.Load(db, "grant", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Perms, Perms{"read", "admin"}) {
+		t.Errorf("expected read and admin, found %v", loaded.Perms)
+	}
+
+	// unknown bits
+	db.Exec("update grant set perms = 42 where id = ?", elt.ID)
+	if err := d.Load(db, "grant", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Perms, Perms{"write"}) {
+		t.Errorf("expected write only, found %v", loaded.Perms)
+	}
+	m.Strict = true
+	if err := d.Load(db, "grant", loaded, elt.ID); err == nil {
+		t.Errorf("expected an error for unknown bits")
+	}
+
+	db.Exec("update grant set perms = null where id = ?", elt.ID)
+	if err := d.Load(db, "grant", loaded, elt.ID); err != nil || loaded.Perms != nil {
+		t.Errorf("expected nil flags for null, found %v (%v)", loaded.Perms, err)
+	}
+	if _, err := m.PreWrite(Perms{"delete"}); err == nil {
+		t.Errorf("expected an error writing an unknown flag")
+	}
+
+	// two names for one bit are rejected, rather than picking one
+	dup := &FlagsMeddler{Bits: map[string]uint{"read": 0, "view": 0}}
+	db.Exec("update grant set perms = 1 where id = ?", elt.ID)
+	d.Register("perms", dup)
+	if err := d.Load(db, "grant", loaded, elt.ID); err == nil || !strings.Contains(err.Error(), `"read" and "view"`) {
+		t.Errorf("expected an error for a bit with two names, found %v", err)
+	}
+	if _, err := dup.PreWrite(Perms{"read"}); err == nil {
+		t.Errorf("expected an error writing with a bit with two names")
+	}
+}
+
+// Tags is a defined collection type, saved as JSON by a meddler
+type Tags []string
+
+// CSV is a defined collection type that converts itself
+type CSV []string
+
+func (c CSV) Value() (driver.Value, error) {
+	return strings.Join(c, ","), nil
+}
+
+func (c *CSV) Scan(src interface{}) error {
+	switch raw := src.(type) {
+	case nil:
+		*c = nil
+	case string:
+		*c = strings.Split(raw, ",")
+	case []byte:
+		*c = strings.Split(string(raw), ",")
+	default:
+		return fmt.Errorf("cannot scan %T into CSV", src)
+	}
+	return nil
+}
+
+type ItemCollection struct {
+	ID     int64 `meddler:"id,pk"`
+	Stuff  Tags  `meddler:"stuff,json"`
+	StuffZ CSV   `meddler:"stuffz"`
+}
+
+func TestCollectionTypes(t *testing.T) {
+	once.Do(setup)
+
+	elt := &ItemCollection{Stuff: Tags{"a", "b"}, StuffZ: CSV{"x", "y", "z"}}
+	if err := Insert(db, "item", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var stuff, stuffz string
+	if err := db.QueryRow("select stuff, stuffz from item where id = ?", elt.ID).Scan(&stuff, &stuffz); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if stuff != "[\"a\",\"b\"]\n" || stuffz != "x,y,z" {
+		t.Errorf("unexpected stored values %q and %q", stuff, stuffz)
+	}
+
+	loaded := new(ItemCollection)
+	if err := Load(db, "item", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Stuff, elt.Stuff) || !reflect.DeepEqual(loaded.StuffZ, elt.StuffZ) {
+		t.Errorf("expected %v and %v, found %v and %v", elt.Stuff, elt.StuffZ, loaded.Stuff, loaded.StuffZ)
+	}
+	if _, err := db.Exec("delete from `item`"); err != nil {
+		t.Errorf("error wiping item table: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package meddler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Named rewrites a query using named parameters such as :id into one
+// using the placeholders of the database, and returns it with the values
+// of the parameters in order. A parameter may appear more than once; with
+// numbered placeholders every use of it shares one placeholder, otherwise
+// its value is passed once for each use. Text within quotes and
+// PostgreSQL casts such as ::text are left alone. Every parameter in the
+// query must have a value in params.
+func (d *Database) Named(query string, params map[string]interface{}) (string, []interface{}, error) {
+	numbered := d.numberedPlaceholders()
+	positions := make(map[string]int)
+	var b strings.Builder
+	var args []interface{}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return "", nil, fmt.Errorf("meddler.Named: unterminated quote in query: %s", query)
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			b.WriteString("::")
+			i++
+		case c == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			end := i + 1
+			for end < len(query) && (isNameStart(query[end]) || query[end] >= '0' && query[end] <= '9') {
+				end++
+			}
+			name := query[i+1 : end]
+			value, present := params[name]
+			if !present {
+				return "", nil, fmt.Errorf("meddler.Named: no value for parameter %s", name)
+			}
+			n, seen := positions[name]
+			if !numbered || !seen {
+				args = append(args, value)
+				n = len(args)
+				positions[name] = n
+			}
+			b.WriteString(d.argPlaceholder(n, value))
+			i = end - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), args, nil
+}
+
+// Named using the Default Database type
+func Named(query string, params map[string]interface{}) (string, []interface{}, error) {
+	return Default.Named(query, params)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
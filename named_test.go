@@ -0,0 +1,61 @@
+package meddler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamed(t *testing.T) {
+	once.Do(setup)
+
+	query := "select * from person where name = :name or (age = :age and name <> :name) or email = ':name' or height::text = :height"
+	params := map[string]interface{}{"name": "Alice", "age": 32, "height": 65}
+
+	// numbered placeholders are reused for repeated parameters
+	q, args, err := PostgreSQL.Named(query, params)
+	if err != nil {
+		t.Fatalf("Named error: %v", err)
+	}
+	expected := "select * from person where name = $1 or (age = $2 and name <> $1) or email = ':name' or height::text = $3"
+	if q != expected {
+		t.Errorf("expected %s, found %s", expected, q)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"Alice", 32, 65}) {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	// other placeholders get the value once for each use
+	q, args, err = SQLite.Named("select id from person where name = :name or (age = :age and name <> :name) order by id", params)
+	if err != nil {
+		t.Fatalf("Named error: %v", err)
+	}
+	if q != "select id from person where name = ? or (age = ? and name <> ?) order by id" {
+		t.Errorf("unexpected query: %s", q)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"Alice", 32, "Alice"}) {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	insertAliceBob(t)
+	defer db.Exec("delete from person")
+	var ids []int64
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("DB error on scan: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if !reflect.DeepEqual(ids, []int64{1}) {
+		t.Errorf("expected Alice only, found %v", ids)
+	}
+
+	if _, _, err := SQLite.Named("select * from person where id = :id", params); err == nil {
+		t.Errorf("expected an error for a missing parameter")
+	}
+}
@@ -0,0 +1,213 @@
+package meddler
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Point is a geographic location given by latitude and longitude in
+// degrees.
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// PointMeddler saves Point and *Point fields, registered as "point". It
+// has two modes:
+//
+// Stored in a single column, a point is written as extended WKT with the
+// WGS 84 SRID, such as "SRID=4326;POINT(13.4 52.5)", which PostGIS accepts
+// for geography and geometry columns. On read, WKT and the hex-encoded
+// (E)WKB returned by PostGIS are both understood.
+//
+// Stored in two columns, named with the columns option as in
+// `meddler:",point,columns=lat+lng"`, the latitude and the longitude are
+// written as numbers.
+//
+// A nil *Point is saved as null, and null columns are read as the zero
+// Point, or as nil for *Point fields.
+type PointMeddler bool
+
+// pointField returns the Point behind a field value, which is nil for a
+// nil *Point.
+func pointField(field interface{}) (*Point, error) {
+	switch p := field.(type) {
+	case Point:
+		return &p, nil
+	case *Point:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown struct field type: %T", field)
+	}
+}
+
+// setPointField stores p in the field at fieldAddr; a nil p means null.
+func setPointField(fieldAddr interface{}, p *Point) error {
+	switch tgt := fieldAddr.(type) {
+	case *Point:
+		if p == nil {
+			*tgt = Point{}
+		} else {
+			*tgt = *p
+		}
+	case **Point:
+		*tgt = p
+	default:
+		return fmt.Errorf("unknown struct field type: %T", fieldAddr)
+	}
+	return nil
+}
+
+func (elt PointMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *Point, **Point:
+		return new(interface{}), nil
+	default:
+		return nil, fmt.Errorf("meddler.PointMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt PointMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	var text string
+	switch raw := (*scanTarget.(*interface{})).(type) {
+	case nil:
+		if err := setPointField(fieldAddr, nil); err != nil {
+			return fmt.Errorf("meddler.PointMeddler.PostRead: %v", err)
+		}
+		return nil
+	case []byte:
+		text = string(raw)
+	case string:
+		text = raw
+	default:
+		return fmt.Errorf("meddler.PointMeddler.PostRead: unexpected column type %T", raw)
+	}
+
+	p, err := parsePoint(text)
+	if err != nil {
+		return fmt.Errorf("meddler.PointMeddler.PostRead: %v", err)
+	}
+	if err := setPointField(fieldAddr, p); err != nil {
+		return fmt.Errorf("meddler.PointMeddler.PostRead: %v", err)
+	}
+	return nil
+}
+
+func (elt PointMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	p, err := pointField(field)
+	if err != nil {
+		return nil, fmt.Errorf("meddler.PointMeddler.PreWrite: %v", err)
+	}
+	if p == nil {
+		return nil, nil
+	}
+	return fmt.Sprintf("SRID=4326;POINT(%s %s)",
+		strconv.FormatFloat(p.Lng, 'g', -1, 64), strconv.FormatFloat(p.Lat, 'g', -1, 64)), nil
+}
+
+func (elt PointMeddler) PreReadColumns(fieldAddr interface{}) (scanTargets []interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *Point, **Point:
+		return []interface{}{new(*float64), new(*float64)}, nil
+	default:
+		return nil, fmt.Errorf("meddler.PointMeddler.PreReadColumns: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt PointMeddler) PostReadColumns(fieldAddr interface{}, scanTargets []interface{}) error {
+	if len(scanTargets) != 2 {
+		return fmt.Errorf("meddler.PointMeddler.PostReadColumns: expected 2 columns, found %d", len(scanTargets))
+	}
+	lat, lng := *scanTargets[0].(**float64), *scanTargets[1].(**float64)
+
+	var p *Point
+	switch {
+	case lat == nil && lng == nil:
+	case lat == nil || lng == nil:
+		return fmt.Errorf("meddler.PointMeddler.PostReadColumns: only one of latitude and longitude is null")
+	default:
+		p = &Point{Lat: *lat, Lng: *lng}
+	}
+	if err := setPointField(fieldAddr, p); err != nil {
+		return fmt.Errorf("meddler.PointMeddler.PostReadColumns: %v", err)
+	}
+	return nil
+}
+
+func (elt PointMeddler) PreWriteColumns(field interface{}) (saveValues []interface{}, err error) {
+	p, err := pointField(field)
+	if err != nil {
+		return nil, fmt.Errorf("meddler.PointMeddler.PreWriteColumns: %v", err)
+	}
+	if p == nil {
+		return []interface{}{nil, nil}, nil
+	}
+	return []interface{}{p.Lat, p.Lng}, nil
+}
+
+// parsePoint parses a point in (extended) WKT, or in hex-encoded (E)WKB.
+func parsePoint(text string) (*Point, error) {
+	text = strings.TrimSpace(text)
+	if i := strings.Index(text, ";"); i >= 0 && strings.HasPrefix(strings.ToUpper(text), "SRID=") {
+		text = text[i+1:]
+	}
+
+	upper := strings.ToUpper(text)
+	if !strings.HasPrefix(upper, "POINT") {
+		return parsePointWKB(text)
+	}
+	body := strings.TrimSpace(text[len("POINT"):])
+	if len(body) < 2 || body[0] != '(' || body[len(body)-1] != ')' {
+		return nil, fmt.Errorf("invalid point %q", text)
+	}
+	coords := strings.Fields(body[1 : len(body)-1])
+	if len(coords) != 2 {
+		return nil, fmt.Errorf("invalid point %q", text)
+	}
+	lng, err := strconv.ParseFloat(coords[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude in point %q", text)
+	}
+	lat, err := strconv.ParseFloat(coords[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude in point %q", text)
+	}
+	return &Point{Lat: lat, Lng: lng}, nil
+}
+
+// parsePointWKB parses a point in hex-encoded WKB, with or without the
+// SRID of the extended form used by PostGIS.
+func parsePointWKB(text string) (*Point, error) {
+	raw, err := hex.DecodeString(text)
+	if err != nil || len(raw) < 5 {
+		return nil, fmt.Errorf("invalid point %q", text)
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	if raw[0] == 1 {
+		order = binary.LittleEndian
+	}
+	typ := order.Uint32(raw[1:5])
+	raw = raw[5:]
+	if typ&0x20000000 != 0 {
+		// skip the SRID
+		if len(raw) < 4 {
+			return nil, fmt.Errorf("invalid point %q", text)
+		}
+		raw = raw[4:]
+		typ &^= 0x20000000
+	}
+	if typ != 1 {
+		return nil, fmt.Errorf("geometry is not a two-dimensional point: %q", text)
+	}
+	if len(raw) != 16 {
+		return nil, fmt.Errorf("invalid point %q", text)
+	}
+	lng := math.Float64frombits(order.Uint64(raw[0:8]))
+	lat := math.Float64frombits(order.Uint64(raw[8:16]))
+	return &Point{Lat: lat, Lng: lng}, nil
+}
@@ -0,0 +1,88 @@
+package meddler
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Place struct {
+	ID       int64  `meddler:"id,pk"`
+	Name     string `meddler:"name"`
+	Location *Point `meddler:"location,point"`
+	Center   Point  `meddler:",point,columns=lat+lng"`
+}
+
+func TestPointMeddler(t *testing.T) {
+	once.Do(setup)
+
+	berlin := Point{Lat: 52.52, Lng: 13.405}
+	elt := &Place{Name: "Berlin", Location: &berlin, Center: berlin}
+	if err := Insert(db, "place", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var location string
+	var lat, lng float64
+	if err := db.QueryRow("select location, lat, lng from place where id = ?", elt.ID).Scan(&location, &lat, &lng); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if location != "SRID=4326;POINT(13.405 52.52)" || lat != 52.52 || lng != 13.405 {
+		t.Errorf("unexpected stored values %s, %v, %v", location, lat, lng)
+	}
+
+	loaded := new(Place)
+	if err := Load(db, "place", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Location == nil || *loaded.Location != berlin || loaded.Center != berlin {
+		t.Errorf("expected %v in both modes, found %v and %v", berlin, loaded.Location, loaded.Center)
+	}
+
+	// null columns are read as no point
+	empty := &Place{Name: "Nowhere"}
+	if err := Insert(db, "place", empty); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if _, err := db.Exec("update place set lat = null, lng = null where id = ?", empty.ID); err != nil {
+		t.Fatalf("DB error on update: %v", err)
+	}
+	loaded.Center = berlin
+	if err := Load(db, "place", loaded, empty.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if loaded.Location != nil || !reflect.DeepEqual(loaded.Center, Point{}) {
+		t.Errorf("expected no location and the zero point, found %v and %v", loaded.Location, loaded.Center)
+	}
+	if _, err := db.Exec("update place set lat = 1 where id = ?", empty.ID); err != nil {
+		t.Fatalf("DB error on update: %v", err)
+	}
+	if err := Load(db, "place", loaded, empty.ID); err == nil {
+		t.Errorf("expected an error when only the latitude is set")
+	}
+	db.Exec("delete from place")
+}
+
+func TestParsePoint(t *testing.T) {
+	expected := Point{Lat: 52.52, Lng: 13.405}
+	for _, text := range []string{
+		"POINT(13.405 52.52)",
+		"SRID=4326;POINT (13.405 52.52)",
+		// EWKB with SRID 4326 as returned by PostGIS
+		"0101000020E61000008FC2F5285CCF2A40C3F5285C8F424A40",
+		// plain WKB, big-endian
+		"0000000001402ACF5C28F5C28F404A428F5C28F5C3",
+	} {
+		p, err := parsePoint(text)
+		if err != nil {
+			t.Errorf("error parsing %s: %v", text, err)
+			continue
+		}
+		if *p != expected {
+			t.Errorf("expected %v for %s, found %v", expected, text, *p)
+		}
+	}
+	for _, text := range []string{"POINT(1)", "LINESTRING(1 2, 3 4)", "0102000000", "POINT(a b)"} {
+		if _, err := parsePoint(text); err == nil {
+			t.Errorf("expected an error for %s", text)
+		}
+	}
+}
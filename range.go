@@ -0,0 +1,310 @@
+package meddler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeRange is a range of times, as stored in a PostgreSQL tstzrange or
+// tsrange column. A bound that is marked as unbounded extends the range
+// to infinity on its side, and its time is ignored. An empty range holds
+// no times at all.
+type TimeRange struct {
+	Lower, Upper                   time.Time
+	LowerInclusive, UpperInclusive bool
+	LowerUnbounded, UpperUnbounded bool
+	Empty                          bool
+}
+
+// NumRange is a range of numbers, as stored in a PostgreSQL numrange,
+// int4range or int8range column, with bounds as for TimeRange.
+type NumRange struct {
+	Lower, Upper                   float64
+	LowerInclusive, UpperInclusive bool
+	LowerUnbounded, UpperUnbounded bool
+	Empty                          bool
+}
+
+// RangeMeddler saves TimeRange and NumRange fields, and pointers to them,
+// registered as "range". Ranges are written in the text form of
+// PostgreSQL ranges, such as ["2026-01-01 00:00:00Z","2026-02-01
+// 00:00:00Z") for a half-open range of times, with nothing in place of
+// a missing bound, and are parsed from the same form on read. A nil
+// pointer is saved as null, and null columns are read as the zero range,
+// or as nil for pointer fields. Ranges of integers, which PostgreSQL
+// returns in their canonical half-open form, are read like other numeric
+// ranges.
+type RangeMeddler bool
+
+// rangeParts holds the text form of the bounds of a range; a nil bound is
+// unbounded.
+type rangeParts struct {
+	lower, upper                   *string
+	lowerInclusive, upperInclusive bool
+	empty                          bool
+}
+
+func (elt RangeMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	switch fieldAddr.(type) {
+	case *TimeRange, **TimeRange, *NumRange, **NumRange:
+		return new(interface{}), nil
+	default:
+		return nil, fmt.Errorf("meddler.RangeMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+}
+
+func (elt RangeMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	var text string
+	isNull := false
+	switch raw := (*scanTarget.(*interface{})).(type) {
+	case nil:
+		isNull = true
+	case []byte:
+		text = string(raw)
+	case string:
+		text = raw
+	default:
+		return fmt.Errorf("meddler.RangeMeddler.PostRead: unexpected column type %T", raw)
+	}
+
+	var parts rangeParts
+	if !isNull {
+		var err error
+		if parts, err = parseRange(text); err != nil {
+			return fmt.Errorf("meddler.RangeMeddler.PostRead: %v", err)
+		}
+	}
+
+	switch tgt := fieldAddr.(type) {
+	case *TimeRange:
+		*tgt = TimeRange{}
+		if !isNull {
+			return timeRangeFrom(tgt, parts)
+		}
+	case **TimeRange:
+		*tgt = nil
+		if !isNull {
+			*tgt = new(TimeRange)
+			return timeRangeFrom(*tgt, parts)
+		}
+	case *NumRange:
+		*tgt = NumRange{}
+		if !isNull {
+			return numRangeFrom(tgt, parts)
+		}
+	case **NumRange:
+		*tgt = nil
+		if !isNull {
+			*tgt = new(NumRange)
+			return numRangeFrom(*tgt, parts)
+		}
+	default:
+		return fmt.Errorf("meddler.RangeMeddler.PostRead: unknown struct field type: %T", fieldAddr)
+	}
+	return nil
+}
+
+func (elt RangeMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	var parts rangeParts
+	switch r := field.(type) {
+	case *TimeRange:
+		if r == nil {
+			return nil, nil
+		}
+		parts = r.parts()
+	case TimeRange:
+		parts = r.parts()
+	case *NumRange:
+		if r == nil {
+			return nil, nil
+		}
+		parts = r.parts()
+	case NumRange:
+		parts = r.parts()
+	default:
+		return nil, fmt.Errorf("meddler.RangeMeddler.PreWrite: unknown struct field type: %T", field)
+	}
+	return parts.String(), nil
+}
+
+func (r TimeRange) parts() rangeParts {
+	parts := rangeParts{empty: r.Empty, lowerInclusive: r.LowerInclusive, upperInclusive: r.UpperInclusive}
+	if !r.LowerUnbounded {
+		s := r.Lower.Format(rangeTimeLayouts[0])
+		parts.lower = &s
+	}
+	if !r.UpperUnbounded {
+		s := r.Upper.Format(rangeTimeLayouts[0])
+		parts.upper = &s
+	}
+	return parts
+}
+
+func (r NumRange) parts() rangeParts {
+	parts := rangeParts{empty: r.Empty, lowerInclusive: r.LowerInclusive, upperInclusive: r.UpperInclusive}
+	if !r.LowerUnbounded {
+		s := strconv.FormatFloat(r.Lower, 'g', -1, 64)
+		parts.lower = &s
+	}
+	if !r.UpperUnbounded {
+		s := strconv.FormatFloat(r.Upper, 'g', -1, 64)
+		parts.upper = &s
+	}
+	return parts
+}
+
+// rangeTimeLayouts are the forms of times accepted as range bounds. The
+// first is used for writing.
+var rangeTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+func timeRangeFrom(r *TimeRange, parts rangeParts) error {
+	if parts.empty {
+		r.Empty = true
+		return nil
+	}
+	r.LowerInclusive, r.UpperInclusive = parts.lowerInclusive, parts.upperInclusive
+	r.LowerUnbounded, r.UpperUnbounded = parts.lower == nil, parts.upper == nil
+	for _, bound := range []struct {
+		text *string
+		dst  *time.Time
+	}{{parts.lower, &r.Lower}, {parts.upper, &r.Upper}} {
+		if bound.text == nil {
+			continue
+		}
+		parsed := false
+		for _, layout := range rangeTimeLayouts {
+			if t, err := time.Parse(layout, *bound.text); err == nil {
+				*bound.dst, parsed = t, true
+				break
+			}
+		}
+		if !parsed {
+			return fmt.Errorf("meddler.RangeMeddler.PostRead: invalid time %q in range", *bound.text)
+		}
+	}
+	return nil
+}
+
+func numRangeFrom(r *NumRange, parts rangeParts) error {
+	if parts.empty {
+		r.Empty = true
+		return nil
+	}
+	r.LowerInclusive, r.UpperInclusive = parts.lowerInclusive, parts.upperInclusive
+	r.LowerUnbounded, r.UpperUnbounded = parts.lower == nil, parts.upper == nil
+	var err error
+	if parts.lower != nil {
+		if r.Lower, err = strconv.ParseFloat(*parts.lower, 64); err != nil {
+			return fmt.Errorf("meddler.RangeMeddler.PostRead: invalid number %q in range", *parts.lower)
+		}
+	}
+	if parts.upper != nil {
+		if r.Upper, err = strconv.ParseFloat(*parts.upper, 64); err != nil {
+			return fmt.Errorf("meddler.RangeMeddler.PostRead: invalid number %q in range", *parts.upper)
+		}
+	}
+	return nil
+}
+
+// String gives the text form of a range, quoting every bound and leaving
+// out the missing ones.
+func (parts rangeParts) String() string {
+	if parts.empty {
+		return "empty"
+	}
+	var b strings.Builder
+	if parts.lower != nil && parts.lowerInclusive {
+		b.WriteByte('[')
+	} else {
+		b.WriteByte('(')
+	}
+	if parts.lower != nil {
+		b.WriteString(strconv.Quote(*parts.lower))
+	}
+	b.WriteByte(',')
+	if parts.upper != nil {
+		b.WriteString(strconv.Quote(*parts.upper))
+	}
+	if parts.upper != nil && parts.upperInclusive {
+		b.WriteByte(']')
+	} else {
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// parseRange splits the text form of a range into its bounds.
+func parseRange(s string) (rangeParts, error) {
+	var parts rangeParts
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "empty") {
+		parts.empty = true
+		return parts, nil
+	}
+	if len(s) < 3 || (s[0] != '[' && s[0] != '(') || (s[len(s)-1] != ']' && s[len(s)-1] != ')') {
+		return parts, fmt.Errorf("invalid range literal %q", s)
+	}
+	parts.lowerInclusive, parts.upperInclusive = s[0] == '[', s[len(s)-1] == ']'
+	body := s[1 : len(s)-1]
+
+	var bounds []*string
+	for i := 0; ; {
+		var bound []byte
+		present := false
+		for ; i < len(body) && body[i] != ','; i++ {
+			present = true
+			if body[i] != '"' {
+				if body[i] == '\\' && i+1 < len(body) {
+					i++
+				}
+				bound = append(bound, body[i])
+				continue
+			}
+			for i++; ; i++ {
+				if i >= len(body) {
+					return parts, fmt.Errorf("unterminated quoted bound in range literal %q", s)
+				}
+				if body[i] == '\\' && i+1 < len(body) {
+					i++
+				} else if body[i] == '"' {
+					if i+1 < len(body) && body[i+1] == '"' {
+						i++
+					} else {
+						break
+					}
+				}
+				bound = append(bound, body[i])
+			}
+		}
+		if present {
+			str := string(bound)
+			bounds = append(bounds, &str)
+		} else {
+			bounds = append(bounds, nil)
+		}
+		if i >= len(body) {
+			break
+		}
+		i++
+	}
+	if len(bounds) != 2 {
+		return parts, fmt.Errorf("invalid range literal %q", s)
+	}
+	parts.lower, parts.upper = bounds[0], bounds[1]
+	if parts.lower == nil {
+		parts.lowerInclusive = false
+	}
+	if parts.upper == nil {
+		parts.upperInclusive = false
+	}
+	return parts, nil
+}
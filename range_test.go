@@ -0,0 +1,85 @@
+package meddler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Validity struct {
+	ID     int64     `meddler:"id,pk"`
+	Period TimeRange `meddler:"period,range"`
+	Price  *NumRange `meddler:"price,range"`
+}
+
+func TestRangeMeddler(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table validity (id integer primary key, period text, price text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table validity")
+
+	// a half-open range of times, and a range of numbers without an upper bound
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	elt := &Validity{
+		Period: TimeRange{Lower: start, Upper: start.AddDate(0, 1, 0), LowerInclusive: true},
+		Price:  &NumRange{Lower: 9.5, LowerInclusive: true, UpperUnbounded: true},
+	}
+	if err := SQLite.Insert(db, "validity", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var period, price string
+	if err := db.QueryRow("select period, price from validity where id = ?", elt.ID).Scan(&period, &price); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if period != `["2026-01-01 00:00:00Z","2026-02-01 00:00:00Z")` || price != `["9.5",)` {
+		t.Errorf("unexpected stored values %s and %s", period, price)
+	}
+
+	loaded := new(Validity)
+	if err := SQLite.Load(db, "validity", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !loaded.Period.Lower.Equal(elt.Period.Lower) || !loaded.Period.Upper.Equal(elt.Period.Upper) ||
+		!loaded.Period.LowerInclusive || loaded.Period.UpperInclusive || loaded.Period.LowerUnbounded || loaded.Period.UpperUnbounded {
+		t.Errorf("expected %v, found %v", elt.Period, loaded.Period)
+	}
+	if loaded.Price == nil || *loaded.Price != *elt.Price {
+		t.Errorf("expected %v, found %v", elt.Price, loaded.Price)
+	}
+
+	// the forms returned by PostgreSQL
+	if _, err := db.Exec(`update validity set period = '(,"2026-03-01 12:30:00+01"]', price = '[1,5)' where id = ?`, elt.ID); err != nil {
+		t.Fatalf("DB error on update: %v", err)
+	}
+	if err := SQLite.Load(db, "validity", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	upper := time.Date(2026, 3, 1, 11, 30, 0, 0, time.UTC)
+	if !loaded.Period.LowerUnbounded || loaded.Period.LowerInclusive || !loaded.Period.Upper.Equal(upper) || !loaded.Period.UpperInclusive {
+		t.Errorf("expected an unbounded range up to and including %v, found %v", upper, loaded.Period)
+	}
+	if expected := (NumRange{Lower: 1, Upper: 5, LowerInclusive: true}); loaded.Price == nil || *loaded.Price != expected {
+		t.Errorf("expected %v, found %v", expected, loaded.Price)
+	}
+
+	if _, err := db.Exec("update validity set period = 'empty', price = null where id = ?", elt.ID); err != nil {
+		t.Fatalf("DB error on update: %v", err)
+	}
+	if err := SQLite.Load(db, "validity", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Period, TimeRange{Empty: true}) || loaded.Price != nil {
+		t.Errorf("expected an empty range and no price, found %v and %v", loaded.Period, loaded.Price)
+	}
+
+	for _, bad := range []string{"[1,2", "1,2)", "[1,2,3)", `["1,2)`, "[a,b)"} {
+		if _, err := db.Exec("update validity set price = ? where id = ?", bad, elt.ID); err != nil {
+			t.Fatalf("DB error on update: %v", err)
+		}
+		if err := SQLite.Load(db, "validity", loaded, elt.ID); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package meddler
+
+import "strings"
+
+// reservedWords lists, in lower case, words that cannot be used as table
+// or column names without quoting. The words listed under "" are reserved
+// in all dialects, the others only in the dialect of that name.
+var reservedWords = map[string][]string{
+	"": {
+		"all", "alter", "and", "any", "as", "asc", "between", "by", "case",
+		"check", "column", "constraint", "create", "cross", "default",
+		"delete", "desc", "distinct", "drop", "else", "end", "exists",
+		"foreign", "from", "full", "grant", "group", "having", "in",
+		"inner", "insert", "into", "is", "join", "key", "left", "like",
+		"limit", "not", "null", "on", "or", "order", "outer", "primary",
+		"references", "right", "select", "set", "table", "then", "to",
+		"union", "unique", "update", "user", "using", "values", "when",
+		"where", "with",
+	},
+	"mysql": {
+		"change", "condition", "database", "databases", "div", "dual",
+		"explain", "force", "ignore", "index", "interval", "keys", "kill",
+		"load", "lock", "match", "mod", "range", "read", "regexp",
+		"rename", "replace", "require", "schema", "show", "signal",
+		"usage", "write", "xor",
+	},
+	"postgres": {
+		"analyse", "analyze", "array", "both", "cast", "collate",
+		"current_date", "current_time", "current_timestamp",
+		"current_user", "deferrable", "do", "except", "false", "fetch",
+		"for", "initially", "intersect", "lateral", "leading", "localtime",
+		"localtimestamp", "offset", "only", "placing", "returning",
+		"session_user", "some", "symmetric", "trailing", "true", "variadic",
+		"window",
+	},
+	"sqlite": {
+		"abort", "action", "autoincrement", "collate", "conflict",
+		"deferrable", "escape", "except", "glob", "index", "indexed",
+		"instead", "intersect", "isnull", "notnull", "offset", "pragma",
+		"raise", "regexp", "replace", "returning", "transaction", "vacuum",
+	},
+	"mssql": {
+		"backup", "browse", "bulk", "cascade", "clustered", "collate",
+		"contains", "database", "deny", "file", "fillfactor", "identity",
+		"index", "kill", "merge", "nonclustered", "offsets", "percent",
+		"pivot", "plan", "proc", "procedure", "public", "rule", "schema",
+		"top", "tran", "transaction", "trigger", "truncate", "view",
+	},
+	"ql": {
+		"bigint", "bigrat", "blob", "bool", "byte", "complex128",
+		"complex64", "duration", "false", "float", "float32", "float64",
+		"int", "int16", "int32", "int64", "int8", "offset", "rune",
+		"string", "time", "true", "uint", "uint16", "uint32", "uint64",
+		"uint8",
+	},
+}
+
+var reservedSets = make(map[string]map[string]bool)
+
+func init() {
+	for dialect, words := range reservedWords {
+		set := make(map[string]bool)
+		for _, word := range reservedWords[""] {
+			set[word] = true
+		}
+		for _, word := range words {
+			set[word] = true
+		}
+		reservedSets[dialect] = set
+	}
+}
+
+// needsQuote reports whether a name must be quoted when QuoteReservedOnly
+// is set: if it is a reserved word of the dialect, or if it is not a plain
+// identifier made of letters, digits, and underscores.
+func (d *Database) needsQuote(name string) bool {
+	set, ok := reservedSets[d.Name]
+	if !ok {
+		set = reservedSets[""]
+	}
+	if set[strings.ToLower(name)] {
+		return true
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return true
+		}
+	}
+	return name == ""
+}
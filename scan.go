@@ -1,13 +1,20 @@
 package meddler
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"math/big"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // the name of our struct tag
@@ -17,37 +24,199 @@ const tagName = "meddler"
 // MySQL, PostgreSQL, and SQLite are provided for convenience.
 // Setting Default to any of these lets you use the package-level convenience functions.
 type Database struct {
+	Name                         string // the name of the dialect, as used by the dialect tag option
 	Quote                        string // the quote character for table and column names
 	Placeholder                  string // the placeholder style to use in generated queries
 	CastPlaceholdersToGoTypeKind bool
 	UseReturningToGetID          bool // use PostgreSQL-style RETURNING "ID" instead of calling sql.Result.LastInsertID
+
+	// ReloadAfterInsert makes Insert read back the whole row of records
+	// with a primary key, so columns filled in by the database (defaults,
+	// triggers) are reflected in the struct.
+	ReloadAfterInsert bool
+
+	// RewriteSQL, if set, is called with every statement right before it
+	// is sent to the database, and the statement it returns is used
+	// instead. It can be used to tag queries with comments, but it must
+	// leave the placeholders alone.
+	RewriteSQL func(query string) string
+
+	// QueryWrapper, if set, is called around every statement meddler
+	// sends to the database, for example to record metrics or tracing
+	// spans. It receives the context of the operation, as set with
+	// WithContext or given to a function such as IterateContext, so spans
+	// can be parented to the caller's; it is context.Background()
+	// otherwise. It also receives the name of the operation (such as
+	// "Load" or "Insert"), the statement, and a function that runs it. It
+	// should call fn and return its error. A wrapper that does not call
+	// fn must return an error, which the operation then fails with. For
+	// queries returning several rows, fn covers running the query but not
+	// reading the rows.
+	QueryWrapper func(ctx context.Context, op, query string, fn func() error) error
+
+	// MaxQueryLength, if positive, is the length in bytes of the
+	// longest statement meddler sends to the database. Longer ones, such
+	// as those of InsertMany with too many records, fail without being
+	// run. The limit applies after RewriteSQL.
+	MaxQueryLength int
+
+	// MaxParams, if positive, is the largest number of parameters the
+	// database accepts in one statement. InsertMany and UpsertMany split
+	// their records across as many statements as needed to stay under it.
+	MaxParams int
+
+	// EmptySlices makes ScanAll (and QueryAll) leave an empty, non-nil
+	// slice in its destination if no rows are found and the slice was
+	// nil, so that it encodes as [] and not as null in JSON. By default,
+	// a nil slice stays nil.
+	EmptySlices bool
+
+	// WarnPrecisionLoss makes scans into float32 and float64 fields log a
+	// warning if a numeric value sent as text by the database, such as a
+	// DECIMAL, cannot be represented exactly. Consider a decimal type
+	// with its own meddler for such columns.
+	WarnPrecisionLoss bool
+
+	// QuoteReservedOnly makes generated queries quote only table and
+	// column names that are reserved words in the dialect given by Name,
+	// or that are not plain identifiers. Other names are left bare, and so
+	// are subject to the case folding rules of the database.
+	QuoteReservedOnly bool
+
+	// UpsertReplace makes Upsert, UpsertWhere and UpsertMany use INSERT OR
+	// REPLACE, for SQLite before 3.24, which lacks ON CONFLICT DO UPDATE.
+	// The conflict columns are still checked against the struct, but the
+	// database replaces a row conflicting on any unique index. Replacing
+	// deletes the old row and inserts a new one, so delete triggers fire,
+	// columns not written get their defaults back, and a zero primary key
+	// gives the row a new one.
+	UpsertReplace bool
+
+	// LockRetries is how many times ProcessTx tries a transaction again
+	// after a lock timeout, 3 if it is zero. A negative value disables
+	// the retries.
+	LockRetries int
+
+	// LockRetryDelay is the pause before the first retry of ProcessTx,
+	// 50ms if it is zero. It doubles with each further retry.
+	LockRetryDelay time.Duration
+
+	// SkipEmptyUpdates makes Update do nothing for records that have no
+	// columns to write besides the primary key, such as the rows of a
+	// join table, instead of returning an error.
+	SkipEmptyUpdates bool
+
+	// IgnoreUnexportedTags makes meddler silently skip unexported struct
+	// fields that have a meddler tag. By default such a field is an
+	// error, as it was probably renamed by mistake and lost its column.
+	IgnoreUnexportedTags bool
+
+	// ColumnOverrides maps struct types, as in reflect.TypeOf(T{}), to
+	// field names to column names. A column given here is used instead of
+	// the one from the tag or the field name, which helps with structs
+	// that cannot be edited. For the fields of embedded structs, the
+	// embedded type is looked up. It must be set before the Database is
+	// used with the types involved.
+	ColumnOverrides map[reflect.Type]map[string]string
+
+	// MapNulls selects how null columns appear in the maps returned by
+	// ScanRowExtra. By default they are stored as nil.
+	MapNulls MapNulls
+
+	// DuplicateKeys selects what QueryAllMap does when several rows have
+	// the same key. By default it returns an error.
+	DuplicateKeys DuplicateKeys
+
+	// PKGenerator, if set, is called by Insert for records whose primary
+	// key is zero, as for keys such as UUIDs that are made by the
+	// application. The value it returns is stored in the primary key field
+	// and inserted with the record, so it must be assignable or
+	// convertible to the type of the field.
+	PKGenerator func(model interface{}) (interface{}, error)
+
+	registry map[string]Meddler // meddlers registered for this Database only
+
+	subtypes     map[string]*subtypeTable // tables shared by several types, see RegisterSubtype
+	subtypeNames map[reflect.Type]string  // the discriminator value of each registered type
+
+	ctx  context.Context // the context set with WithContext, if any
+	base *Database       // the Database a WithContext copy shares its cached struct data with
 }
 
+// MapNulls selects how null columns are represented in result maps.
+type MapNulls int
+
+const (
+	// MapNullsNil stores null columns as nil values.
+	MapNullsNil MapNulls = iota
+
+	// MapNullsSentinel stores null columns as Null, so they can be told
+	// apart from columns missing from the map, and from values that the
+	// driver returned as nil for other reasons.
+	MapNullsSentinel
+
+	// MapNullsOmit leaves null columns out of the map.
+	MapNullsOmit
+)
+
+// DuplicateKeys selects how rows with the same key are handled when
+// results are gathered into a map.
+type DuplicateKeys int
+
+const (
+	// DuplicateKeysError makes a repeated key an error.
+	DuplicateKeysError DuplicateKeys = iota
+
+	// DuplicateKeysKeepFirst keeps the first row found for each key and
+	// ignores the later ones.
+	DuplicateKeysKeepFirst
+
+	// DuplicateKeysKeepLast keeps the last row found for each key, each
+	// one replacing the row before it.
+	DuplicateKeysKeepLast
+)
+
+// Null is stored in result maps in place of null columns when MapNulls is
+// set to MapNullsSentinel.
+var Null = NullValue{}
+
+// NullValue is the type of Null.
+type NullValue struct{}
+
 var MySQL = &Database{
+	Name:                "mysql",
 	Quote:               "`",
 	Placeholder:         "?",
 	UseReturningToGetID: false,
+	MaxParams:           65535,
 }
 
 var PostgreSQL = &Database{
+	Name:                "postgres",
 	Quote:               `"`,
 	Placeholder:         "$1",
 	UseReturningToGetID: true,
+	MaxParams:           65535,
 }
 
 var SQLite = &Database{
+	Name:                "sqlite",
 	Quote:               `"`,
 	Placeholder:         "?",
 	UseReturningToGetID: false,
+	MaxParams:           32766,
 }
 
 var MSSQL = &Database{
+	Name:                "mssql",
 	Quote:               `"`,
 	Placeholder:         "$1",
 	UseReturningToGetID: true,
+	MaxParams:           2100,
 }
 
 var QL = &Database{
+	Name:                         "ql",
 	Quote:                        ``,
 	Placeholder:                  "$1",
 	CastPlaceholdersToGoTypeKind: true,
@@ -57,14 +226,31 @@ var QL = &Database{
 var Default = MySQL
 
 func (d *Database) quoted(s string) string {
+	if d.QuoteReservedOnly && !d.needsQuote(s) {
+		return s
+	}
 	return d.Quote + s + d.Quote
 }
 
+// quotedList quotes a list of names and joins them with commas.
+func (d *Database) quotedList(names []string) string {
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, d.quoted(name))
+	}
+	return strings.Join(parts, ",")
+}
+
 // NthPlaceholder returns the nth placeholder
 func (d *Database) NthPlaceholder(n int, src interface{}, fieldName string) string {
 	return d.placeholder(n, d.goTypeKind(nil, src, fieldName))
 }
 
+// placeholder returns the nth placeholder of a statement, cast to the
+// given Go kind unless kind is empty. All generated statements get their
+// placeholders from here, from argPlaceholder for values that belong to
+// no field, or from writePlaceholders for the fields of a record, so a
+// Placeholder of "$1" gives $1, $2, ... in the order of the arguments.
 func (d *Database) placeholder(n int, kind string) string {
 	ph := strings.Replace(d.Placeholder, "1", strconv.FormatInt(int64(n), 10), 1)
 	if kind == "" {
@@ -73,33 +259,118 @@ func (d *Database) placeholder(n int, kind string) string {
 	return kind + "(" + ph + ")"
 }
 
+// argPlaceholder returns the nth placeholder for an argument value
+// that is not tied to a struct field.
+func (d *Database) argPlaceholder(n int, value interface{}) string {
+	kind := ""
+	if d.CastPlaceholdersToGoTypeKind && value != nil {
+		kind = reflect.TypeOf(value).Kind().String()
+	}
+	return d.placeholder(n, kind)
+}
+
+// numberedPlaceholders reports whether placeholders are numbered, as in
+// $1, so that an argument can be referred to more than once.
+func (d *Database) numberedPlaceholders() bool {
+	return strings.Contains(d.Placeholder, "1")
+}
+
 // Debug enables debug mode, where unused columns and struct fields will be logged
 var Debug = true
 
 type structField struct {
-	column     string
-	index      int
-	kind       reflect.Kind
-	primaryKey bool
-	meddler    Meddler
+	column      string
+	index       []int // index path of the field, as for reflect.Value.FieldByIndex
+	kind        reflect.Kind
+	primaryKey  bool
+	meddler     Meddler
+	columns     []string // all of the columns of a field that is stored in several
+	part        int      // position of this column in columns
+	generated   bool     // filled in by the database, never written
+	groups      [][]int  // index paths of enclosing embedded structs that are pointers or have an IsZero method
+	nullable    bool     // a meddled field of an optional struct, scanned into a target that notes null
+	meddlerName string   // the name the meddler was found under, or the tag option giving it
+	references  string   // the table, or table.column, named by the fk option
 }
 
 type structData struct {
-	columns []string
-	fields  map[string]*structField
-	pk      string
+	columns       []string
+	fields        map[string]*structField
+	pk            string
+	etag          string   // column holding a hash of the other columns
+	discriminator string   // column naming the type of the record, see RegisterSubtype
+	subtype       string   // the value written to the discriminator column
+	natural       []string // columns of the natural key, if any
+
+	// index paths of pointer struct fields given a prefix, which are
+	// left nil when all of their columns are null
+	optional [][]int
+
+	// slice fields holding the rows of other tables that refer to the
+	// record, as loaded by LoadWithRelations
+	hasMany []relation
 }
 
-// cache reflection data
-var fieldsCache = make(map[reflect.Type]*structData)
+// relation describes a slice field tagged with the hasmany option.
+type relation struct {
+	index  []int  // index path of the slice field
+	table  string // the table of the related rows
+	column string // the column of the related rows holding the primary key of the record
+}
+
+// resultField finds the field for a column of a query result. A column
+// name without an exact match is tried again without a table qualifier
+// and quotes, since some drivers report the columns of joins as
+// "users"."id" or users.id. An exact match always takes precedence.
+func (data *structData) resultField(column string) (*structField, bool) {
+	if field, present := data.fields[column]; present {
+		return field, true
+	}
+	name := column
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Trim(name, "\"`[]")
+	if name == column {
+		return nil, false
+	}
+	field, present := data.fields[name]
+	return field, present
+}
+
+// checkResult reports an error if a column of a query result is matched
+// to a field only after its qualifier is stripped, while another column
+// of the result matches the same field, as users.id and posts.id do.
+func (data *structData) checkResult(op string, columns []string) error {
+	matched := make(map[*structField]string)
+	for _, name := range columns {
+		if field, present := data.resultField(name); present {
+			if other, dup := matched[field]; dup && other != name {
+				return fmt.Errorf("meddler.%s: columns [%s] and [%s] both match the field for column %s; give one of them an alias", op, other, name, field.column)
+			}
+			matched[field] = name
+		}
+	}
+	return nil
+}
+
+// cache reflection data, separately for each Database since
+// each one may have its own meddler registry
+type fieldsKey struct {
+	db  *Database
+	typ reflect.Type
+}
+
+var fieldsCache = make(map[fieldsKey]*structData)
 var fieldsCacheMutex sync.Mutex
 
 // getFields gathers the list of columns from a struct using reflection.
-func getFields(dstType reflect.Type) (*structData, error) {
+func (d *Database) getFields(dstType reflect.Type) (*structData, error) {
 	fieldsCacheMutex.Lock()
 	defer fieldsCacheMutex.Unlock()
 
-	if result, present := fieldsCache[dstType]; present {
+	key := fieldsKey{db: d.cacheOwner(), typ: dstType}
+	if result, present := fieldsCache[key]; present {
 		return result, nil
 	}
 
@@ -115,78 +386,472 @@ func getFields(dstType reflect.Type) (*structData, error) {
 	// gather the list of fields in the struct
 	data := new(structData)
 	data.fields = make(map[string]*structField)
+	if err := d.addFields(data, structType, nil, ""); err != nil {
+		return nil, err
+	}
+	for _, field := range data.fields {
+		field.groups = zeroGroups(structType, field.index)
+		if _, plain := field.readMeddler().(ZeroIsNullMeddler); !plain && field.columns == nil {
+			for _, path := range data.optional {
+				field.nullable = field.nullable || hasIndexPrefix(field.index, path)
+			}
+		}
+	}
+	data.subtype = d.subtypeNames[dstType]
+
+	fieldsCache[key] = data
+	return data, nil
+}
 
+// addFields adds the columns for the fields of a struct type to data.
+// The fields of embedded structs are treated as if they were fields of
+// the outer struct; parent is the index path leading to such a struct,
+// and prefix is put in front of the column names of its fields.
+func (d *Database) addFields(data *structData, structType reflect.Type, parent []int, prefix string) error {
 	for i := 0; i < structType.NumField(); i++ {
 		f := structType.Field(i)
 
-		// skip non-exported fields
+		// a struct tag that is not valid Go syntax, such as one with an
+		// unescaped backslash, hides the meddler tag from Lookup
+		text, tagged := f.Tag.Lookup(tagName)
+		if !tagged && strings.Contains(string(f.Tag), tagName+":") {
+			return fmt.Errorf("meddler found field %s with an invalid struct tag %s; a backslash in the %s tag must be doubled", f.Name, f.Tag, tagName)
+		}
+
+		// skip non-exported fields, which cannot be read or written, but
+		// complain about tagged ones, which were meant to be columns
 		if f.PkgPath != "" {
+			if tagged && text != "-" && !d.IgnoreUnexportedTags {
+				return fmt.Errorf("meddler found unexported field %s with a %s tag, which cannot be used as a column", f.Name, tagName)
+			}
 			continue
 		}
 
 		// examine the tag for metadata
-		tag := strings.Split(f.Tag.Get(tagName), ",")
+		tag, err := parseTag(text)
+		if err != nil {
+			return fmt.Errorf("meddler found field %s with a malformed tag: %v", f.Name, err)
+		}
 
 		// was this field marked for skipping?
-		if len(tag) > 0 && tag[0] == "-" {
+		if tag.column == "-" {
 			continue
 		}
 
+		index := append(append([]int{}, parent...), i)
+
+		// descend into embedded structs unless they are given a column
+		// name, and into struct fields given a prefix for their columns
+		nested, hasPrefix := "", false
+		if len(tag.options) == 1 && tag.column == "" && tag.options[0].hasValue && tag.options[0].key == "prefix" {
+			nested, hasPrefix = tag.options[0].value, true
+		}
+		if (f.Anonymous && tag.column == "" || hasPrefix) && isEmbeddedStruct(f.Type) {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if err := d.addFields(data, embedded, index, prefix+nested); err != nil {
+				return err
+			}
+			if hasPrefix && f.Type.Kind() == reflect.Ptr {
+				data.optional = append(data.optional, index)
+			}
+			continue
+		}
+		if hasPrefix {
+			return fmt.Errorf("meddler found field %s with a prefix, but it is not a struct", f.Name)
+		}
+
 		// default to the field name
 		name := f.Name
 
-		// the tag can override the field name
-		if len(tag) > 0 && tag[0] != "" {
-			name = tag[0]
+		// the tag can override the field name, and ColumnOverrides the tag
+		if tag.column != "" {
+			name = tag.column
+		}
+		if column, present := d.ColumnOverrides[structType][f.Name]; present {
+			name = column
+		}
+		name = prefix + name
+
+		// slices of related rows are not columns
+		if last := len(tag.options) - 1; last >= 0 && tag.options[last].hasValue && tag.options[last].key == "hasmany" {
+			column := tag.options[last].value
+			elem := f.Type
+			if elem.Kind() == reflect.Slice {
+				elem = elem.Elem()
+			}
+			if elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			if f.Type.Kind() != reflect.Slice || elem.Kind() != reflect.Struct {
+				return fmt.Errorf("meddler found field %s with a hasmany option, but it is not a slice of structs", f.Name)
+			}
+			if len(tag.options) != 1 || column == "" {
+				return fmt.Errorf("meddler found field %s with a hasmany option, which must name a column and be the only option of its tag", f.Name)
+			}
+			data.hasMany = append(data.hasMany, relation{index: index, table: name, column: column})
+			continue
 		}
 
 		// check for a meddler
-		var meddler Meddler = registry["identity"]
-		for j := 1; j < len(tag); j++ {
-			if tag[j] == "pk" {
+		meddler, _ := d.lookupMeddler("identity")
+		meddlerName := "identity"
+		var columns []string
+		references := ""
+		generated := false
+		etag := false
+		discriminator := false
+		natural := false
+		scanOnly := false
+		wanted := true
+		for _, opt := range tag.options {
+			if opt.hasValue {
+				key, value := opt.key, opt.value
+				switch key {
+				case "columns":
+					columns = strings.Split(value, "+")
+				case "fk":
+					if value == "" {
+						return fmt.Errorf("meddler found field %s with an empty fk option", f.Name)
+					}
+					references = value
+				case "tz":
+					loc, err := time.LoadLocation(value)
+					if err != nil {
+						return fmt.Errorf("meddler found field %s with unknown time zone %s: %v", f.Name, value, err)
+					}
+					meddler = ZoneTimeMeddler{Location: loc}
+					meddlerName = opt.String()
+				case "prefix":
+					return fmt.Errorf("meddler found field %s with a prefix, which must be the only part of its tag", f.Name)
+				case "hasmany":
+					return fmt.Errorf("meddler found field %s with a hasmany option, which must name a column and be the only option of its tag", f.Name)
+				case "dialect":
+					// the field only exists under the named dialects
+					wanted = false
+					for _, name := range strings.Split(value, "+") {
+						if name == d.Name {
+							wanted = true
+						}
+					}
+				default:
+					return fmt.Errorf("meddler found field %s with unknown option %s", f.Name, key)
+				}
+			} else if opt.key == "pk" {
 				if f.Type.Kind() == reflect.Ptr {
-					return nil, fmt.Errorf("meddler found field %s which is marked as the primary key but is a pointer", f.Name)
+					return fmt.Errorf("meddler found field %s which is marked as the primary key but is a pointer", f.Name)
 				}
 
-				// make sure it is an int of some kind
+				// make sure it is an int of some kind, a string, or a
+				// type such as a UUID that knows how to scan itself
 				switch f.Type.Kind() {
 				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				case reflect.String:
 				default:
-					return nil, fmt.Errorf("meddler found field %s which is marked as the primary key, but is not an integer type", f.Name)
+					if !reflect.PtrTo(f.Type).Implements(scannerType) {
+						return fmt.Errorf("meddler found field %s which is marked as the primary key, but is not an integer, string, or sql.Scanner type", f.Name)
+					}
 				}
 
 				if data.pk != "" {
-					return nil, fmt.Errorf("meddler found field %s which is marked as the primary key, but a primary key field was already found", f.Name)
+					return fmt.Errorf("meddler found field %s which is marked as the primary key, but a primary key field was already found", f.Name)
 				}
 				data.pk = name
-			} else if m, present := registry[tag[j]]; present {
+			} else if opt.key == "generated" {
+				generated = true
+			} else if opt.key == "etag" {
+				etag = true
+			} else if opt.key == "discriminator" {
+				discriminator = true
+			} else if opt.key == "natural" {
+				natural = true
+			} else if opt.key == "scanonly" {
+				scanOnly = true
+			} else if m, present := d.lookupMeddler(opt.key); present {
 				meddler = m
+				meddlerName = opt.key
 			} else {
-				return nil, fmt.Errorf("meddler found field %s with meddler %s, but that meddler is not registered", f.Name, tag[j])
+				return fmt.Errorf("meddler found field %s with meddler %s, but that meddler is not registered", f.Name, opt.key)
+			}
+		}
+
+		// fields without a meddler may have a registered scanner
+		if meddlerName == "identity" && columns == nil {
+			if m, present := lookupScanner(f.Type); present {
+				meddler = m
+			}
+		}
+
+		if !wanted {
+			if data.pk == name {
+				return fmt.Errorf("meddler found field %s which is marked as the primary key, but is limited to some dialects", f.Name)
+			}
+			continue
+		}
+		if generated && data.pk == name {
+			return fmt.Errorf("meddler found field %s which is marked as both the primary key and generated", f.Name)
+		}
+		if etag {
+			if f.Type.Kind() != reflect.String || data.pk == name || generated || columns != nil {
+				return fmt.Errorf("meddler found field %s which is marked as etag, but is not a plain string field", f.Name)
+			}
+			if data.etag != "" {
+				return fmt.Errorf("meddler found field %s which is marked as etag, but an etag field was already found", f.Name)
+			}
+			data.etag = name
+		}
+		if discriminator {
+			if f.Type.Kind() != reflect.String || data.pk == name || generated || etag || columns != nil {
+				return fmt.Errorf("meddler found field %s which is marked as discriminator, but is not a plain string field", f.Name)
+			}
+			if data.discriminator != "" {
+				return fmt.Errorf("meddler found field %s which is marked as discriminator, but a discriminator field was already found", f.Name)
+			}
+			data.discriminator = name
+		}
+		if natural {
+			if generated || columns != nil {
+				return fmt.Errorf("meddler found field %s which is marked as part of the natural key, but is not a plain field", f.Name)
+			}
+			data.natural = append(data.natural, name)
+		}
+		if scanOnly && (data.pk == name || generated || etag || discriminator || natural || columns != nil) {
+			return fmt.Errorf("meddler found field %s which is marked as scanonly, but is not a plain field", f.Name)
+		}
+		if columns != nil {
+			if data.pk == name {
+				return fmt.Errorf("meddler found field %s which is marked as the primary key, but is stored in several columns", f.Name)
+			}
+			if references != "" {
+				return fmt.Errorf("meddler found field %s with an fk option, but it is stored in several columns", f.Name)
 			}
+			if err := data.addMultiColumnField(f, index, meddler, columns); err != nil {
+				return err
+			}
+			for _, column := range columns {
+				data.fields[column].generated = generated
+				data.fields[column].meddlerName = meddlerName
+			}
+			continue
+		}
+
+		if _, present := data.fields[name]; present {
+			return fmt.Errorf("meddler found multiple fields for column %s", name)
+		}
+		data.fields[name] = &structField{
+			column:      name,
+			primaryKey:  name == data.pk,
+			index:       index,
+			kind:        f.Type.Kind(),
+			meddler:     meddler,
+			generated:   generated,
+			meddlerName: meddlerName,
+			references:  references,
 		}
 
+		// scan-only fields are filled in from query results, but are
+		// not columns of the table
+		if !scanOnly {
+			data.columns = append(data.columns, name)
+		}
+	}
+
+	return nil
+}
+
+// addMultiColumnField adds the columns of a field that is stored in
+// several columns.
+func (data *structData) addMultiColumnField(f reflect.StructField, index []int, meddler Meddler, columns []string) error {
+	if _, ok := meddler.(MultiColumnMeddler); !ok {
+		return fmt.Errorf("meddler found field %s stored in several columns, but its meddler does not support that", f.Name)
+	}
+	for part, name := range columns {
+		if name == "" {
+			return fmt.Errorf("meddler found field %s with an empty column name", f.Name)
+		}
 		if _, present := data.fields[name]; present {
-			return nil, fmt.Errorf("meddler found multiple fields for column %s", name)
+			return fmt.Errorf("meddler found multiple fields for column %s", name)
 		}
 		data.fields[name] = &structField{
-			column:     name,
-			primaryKey: name == data.pk,
-			index:      i,
-			kind:       f.Type.Kind(),
-			meddler:    meddler,
+			column:  name,
+			index:   index,
+			kind:    f.Type.Kind(),
+			meddler: meddler,
+			columns: columns,
+			part:    part,
 		}
 		data.columns = append(data.columns, name)
 	}
 
-	fieldsCache[dstType] = data
-	return data, nil
+	return nil
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// sameKindConvertible reports whether a value of type from can be
+// converted to type to while staying the same kind of value: integers to
+// integers, floats to floats, and otherwise only between types of the
+// same reflect.Kind. This rules out conversions that change the meaning
+// of a value, such as an int to a string holding that rune, or a float
+// truncated to an int.
+func sameKindConvertible(from, to reflect.Type) bool {
+	if !from.ConvertibleTo(to) {
+		return false
+	}
+	switch {
+	case isIntegerKind(from.Kind()):
+		return isIntegerKind(to.Kind())
+	case from.Kind() == reflect.Float32 || from.Kind() == reflect.Float64:
+		return to.Kind() == reflect.Float32 || to.Kind() == reflect.Float64
+	}
+	return from.Kind() == to.Kind()
+}
+
+// isIntegerKind reports whether k is one of the integer kinds.
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// isEmbeddedStruct reports whether an embedded field of type t holds
+// columns of its own, rather than being a column value itself.
+func isEmbeddedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	ptr := reflect.PtrTo(t)
+	return !ptr.Implements(scannerType) && !ptr.Implements(valuerType)
+}
+
+// zeroer is implemented by embedded structs that can report being absent.
+// All of the columns of such a struct are written as null if its IsZero
+// method returns true.
+type zeroer interface {
+	IsZero() bool
+}
+
+var zeroerType = reflect.TypeOf((*zeroer)(nil)).Elem()
+
+// zeroGroups returns the index paths of the embedded structs enclosing
+// the field with the given index that are pointers or implement zeroer.
+func zeroGroups(structType reflect.Type, index []int) [][]int {
+	var groups [][]int
+	t := structType
+	for k := 0; k < len(index)-1; k++ {
+		t = t.Field(index[k]).Type
+		ptr := t.Kind() == reflect.Ptr
+		if ptr {
+			t = t.Elem()
+		}
+		if ptr || reflect.PtrTo(t).Implements(zeroerType) {
+			groups = append(groups, index[:k+1])
+		}
+	}
+	return groups
+}
+
+// absent reports whether the field is part of an embedded struct that
+// says it is zero, or that is a nil pointer.
+func (field *structField) absent(structVal reflect.Value) bool {
+	for _, index := range field.groups {
+		v := fieldByIndex(structVal, index, false)
+		if !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+			return true
+		}
+		if v.Kind() != reflect.Ptr {
+			v = v.Addr()
+		}
+		if z, ok := v.Interface().(zeroer); ok && z.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// readMeddler returns the meddler used to read the field. Plain fields of
+// embedded structs that can be absent accept null, since all of their
+// columns are null when the struct was saved as absent, or when it comes
+// from the unmatched side of an outer join.
+func (field *structField) readMeddler() Meddler {
+	if _, ok := field.meddler.(IdentityMeddler); ok && field.groups != nil {
+		return ZeroIsNullMeddler(false)
+	}
+	return field.meddler
+}
+
+// fieldByIndex returns the struct field with the given index path.
+// Nil pointers to embedded structs along the path are allocated if
+// alloc is set; otherwise, the zero Value is returned when one is
+// encountered.
+func fieldByIndex(structVal reflect.Value, index []int, alloc bool) reflect.Value {
+	v := structVal
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// writeColumns returns the columns saved by Insert and Update. These are
+// all of the columns except generated ones, and except the primary key
+// unless includePk is set.
+func (data *structData) writeColumns(includePk bool) []string {
+	var names []string
+	for _, name := range data.columns {
+		if !includePk && name == data.pk || data.fields[name].generated {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// generatedColumns returns the columns of generated fields.
+func (data *structData) generatedColumns() []string {
+	var names []string
+	for _, name := range data.columns {
+		if data.fields[name].generated {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// writePlaceholders returns the placeholders for writing columns of src,
+// numbered starting with first.
+func (d *Database) writePlaceholders(data *structData, src interface{}, columns []string, first int) []string {
+	var placeholders []string
+	for i, name := range columns {
+		placeholders = append(placeholders, d.placeholder(first+i, d.goTypeKind(data, src, name)))
+	}
+	return placeholders
 }
 
 // Columns returns a list of column names for its input struct.
 func (d *Database) Columns(src interface{}, includePk bool) ([]string, error) {
-	data, err := getFields(reflect.TypeOf(src))
+	data, err := d.getFields(reflect.TypeOf(src))
 	if err != nil {
 		return nil, err
 	}
@@ -207,21 +872,76 @@ func Columns(src interface{}, includePk bool) ([]string, error) {
 	return Default.Columns(src, includePk)
 }
 
+// FieldMeddlers returns the name of the meddler used for each column of a
+// struct, keyed by column name. Columns without a meddler in their tag use
+// "identity"; for the tz option, the option itself is given.
+func (d *Database) FieldMeddlers(src interface{}) (map[string]string, error) {
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	for _, name := range data.columns {
+		names[name] = data.fields[name].meddlerName
+	}
+	return names, nil
+}
+
+// FieldMeddlers using the Default Database type
+func FieldMeddlers(src interface{}) (map[string]string, error) {
+	return Default.FieldMeddlers(src)
+}
+
+// ColumnsExcept returns the list of column names for its input struct,
+// including the primary key, but without the columns named in exclude.
+// Every excluded column must be mapped to a field of the struct. Excluding
+// one column of a field stored in several columns excludes all of them.
+func (d *Database) ColumnsExcept(src interface{}, exclude ...string) ([]string, error) {
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return nil, err
+	}
+	return data.columnsExcept(exclude)
+}
+
+// ColumnsExcept using the Default Database type
+func ColumnsExcept(src interface{}, exclude ...string) ([]string, error) {
+	return Default.ColumnsExcept(src, exclude...)
+}
+
+func (data *structData) columnsExcept(exclude []string) ([]string, error) {
+	skip := make(map[string]bool)
+	for _, name := range exclude {
+		field, present := data.fields[name]
+		if !present {
+			return nil, fmt.Errorf("meddler.ColumnsExcept: excluded column [%s] not found in struct", name)
+		}
+		skip[name] = true
+		for _, other := range field.columns {
+			skip[other] = true
+		}
+	}
+
+	var names []string
+	for _, name := range data.columns {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
 // ColumnsQuoted is similar to Columns, but it return the list of columns in the form:
 //   `column1`,`column2`,...
 // using Quote as the quote character.
 func (d *Database) ColumnsQuoted(src interface{}, includePk bool) (string, error) {
-	unquoted, err := Columns(src, includePk)
+	unquoted, err := d.Columns(src, includePk)
 	if err != nil {
 		return "", err
 	}
 
-	var parts []string
-	for _, elt := range unquoted {
-		parts = append(parts, d.quoted(elt))
-	}
-
-	return strings.Join(parts, ","), nil
+	return d.quotedList(unquoted), nil
 }
 
 // ColumnsQuoted using the Default Database type
@@ -230,9 +950,11 @@ func ColumnsQuoted(src interface{}, includePk bool) (string, error) {
 }
 
 // PrimaryKey returns the name and value of the primary key field. The name
-// is the empty string if there is not primary key field marked.
+// is the empty string if there is not primary key field marked. It returns
+// an error for keys that are not integers, such as strings and UUIDs;
+// those are supported by Insert, Update, Save, Upsert, and RefreshColumns.
 func (d *Database) PrimaryKey(src interface{}) (name string, pk int64, err error) {
-	data, err := getFields(reflect.TypeOf(src))
+	data, err := d.getFields(reflect.TypeOf(src))
 	if err != nil {
 		return "", 0, err
 	}
@@ -242,7 +964,11 @@ func (d *Database) PrimaryKey(src interface{}) (name string, pk int64, err error
 	}
 
 	name = data.pk
-	field := reflect.ValueOf(src).Elem().Field(data.fields[name].index)
+	field := fieldByIndex(reflect.ValueOf(src).Elem(), data.fields[name].index, false)
+	if !field.IsValid() {
+		// the primary key is part of a nil embedded struct
+		return name, 0, nil
+	}
 	switch field.Type().Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		pk = field.Int()
@@ -255,6 +981,35 @@ func (d *Database) PrimaryKey(src interface{}) (name string, pk int64, err error
 	return name, pk, nil
 }
 
+// primaryKeyValue returns the name of the primary key column of src, the
+// value of its field, and whether that is set to anything but the zero
+// value. Unlike PrimaryKey, it works for keys that are not integers.
+func (d *Database) primaryKeyValue(src interface{}) (name string, value interface{}, set bool, err error) {
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return "", nil, false, err
+	}
+	if data.pk == "" {
+		return "", nil, false, nil
+	}
+
+	field := fieldByIndex(reflect.ValueOf(src).Elem(), data.fields[data.pk].index, false)
+	if !field.IsValid() {
+		// the primary key is part of a nil embedded struct
+		return data.pk, nil, false, nil
+	}
+	return data.pk, field.Interface(), !field.IsZero(), nil
+}
+
+// integerKey returns an error for op, which takes or returns primary keys
+// as int64 values, if the primary key of the struct is not an integer.
+func (data *structData) integerKey(op string) error {
+	if data.pk != "" && !isIntegerKind(data.fields[data.pk].kind) {
+		return fmt.Errorf("meddler.%s: primary key %s is not an integer, which this function requires", op, data.pk)
+	}
+	return nil
+}
+
 // PrimaryKey using the Default Database type
 func PrimaryKey(src interface{}) (name string, pk int64, err error) {
 	return Default.PrimaryKey(src)
@@ -262,7 +1017,7 @@ func PrimaryKey(src interface{}) (name string, pk int64, err error) {
 
 // SetPrimaryKey sets the primary key field to the given int value.
 func (d *Database) SetPrimaryKey(src interface{}, pk int64) error {
-	data, err := getFields(reflect.TypeOf(src))
+	data, err := d.getFields(reflect.TypeOf(src))
 	if err != nil {
 		return err
 	}
@@ -271,7 +1026,7 @@ func (d *Database) SetPrimaryKey(src interface{}, pk int64) error {
 		return fmt.Errorf("meddler.SetPrimaryKey: no primary key field found")
 	}
 
-	field := reflect.ValueOf(src).Elem().Field(data.fields[data.pk].index)
+	field := fieldByIndex(reflect.ValueOf(src).Elem(), data.fields[data.pk].index, true)
 	switch field.Type().Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		field.SetInt(pk)
@@ -292,7 +1047,8 @@ func SetPrimaryKey(src interface{}, pk int64) error {
 // Values returns a list of PreWrite processed values suitable for
 // use in an INSERT or UPDATE query. If includePk is false, the primary
 // key field is omitted. The columns used are the same ones (in the same
-// order) as returned by Columns.
+// order) as returned by Columns. Like SomeValues, it updates the etag and
+// discriminator fields of src.
 func (d *Database) Values(src interface{}, includePk bool) ([]interface{}, error) {
 	columns, err := d.Columns(src, includePk)
 	if err != nil {
@@ -301,22 +1057,148 @@ func (d *Database) Values(src interface{}, includePk bool) ([]interface{}, error
 	return d.SomeValues(src, columns)
 }
 
+// appendValue appends an encoding of a value as written to the database,
+// which tells apart values the driver would store differently. Values
+// are converted the way the driver would, so pointers are followed.
+func appendValue(b []byte, value interface{}) []byte {
+	if v, err := driver.DefaultParameterConverter.ConvertValue(value); err == nil {
+		value = v
+	}
+	switch v := value.(type) {
+	case nil:
+		return append(b, 'n')
+	case int64:
+		return strconv.AppendInt(append(b, 'i'), v, 10)
+	case float64:
+		return strconv.AppendFloat(append(b, 'f'), v, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(append(b, 'b'), v)
+	case string:
+		return append(strconv.AppendInt(append(b, 's'), int64(len(v)), 10), ":"+v...)
+	case []byte:
+		b = strconv.AppendInt(append(b, 'x'), int64(len(v)), 10)
+		return append(append(b, ':'), v...)
+	case time.Time:
+		return v.UTC().AppendFormat(append(b, 't'), time.RFC3339Nano)
+	default:
+		s := fmt.Sprint(v)
+		return append(strconv.AppendInt(append(b, '?'), int64(len(s)), 10), ":"+s...)
+	}
+}
+
+// updateETag sets the etag field of src to the SHA-256 hash of the values
+// of the columns that are written when saving it, in hex. The values are
+// hashed in the encoding of appendValue, so the hash does not depend on
+// how Go prints them.
+func (d *Database) updateETag(data *structData, src interface{}) error {
+	var content []string
+	for _, name := range data.writeColumns(false) {
+		if name != data.etag {
+			content = append(content, name)
+		}
+	}
+	values, err := d.SomeValues(src, content)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	var b []byte
+	for i, name := range content {
+		b = appendValue(append(append(b[:0], name...), '='), values[i])
+		h.Write(append(b, 0))
+	}
+	field := fieldByIndex(reflect.ValueOf(src).Elem(), data.fields[data.etag].index, true)
+	field.SetString(hex.EncodeToString(h.Sum(nil)))
+	return nil
+}
+
 // Values using the Default Database type
 func Values(src interface{}, includePk bool) ([]interface{}, error) {
 	return Default.Values(src, includePk)
 }
 
+// Fields returns the columns that Insert writes for src, with their
+// PreWrite processed values in the same order, for building statements
+// by hand. Generated columns are left out, as is the primary key unless
+// includePk is set. Like SomeValues, it updates the etag and
+// discriminator fields of src.
+func (d *Database) Fields(src interface{}, includePk bool) ([]string, []interface{}, error) {
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := data.writeColumns(includePk)
+	values, err := d.SomeValues(src, columns)
+	if err != nil {
+		return nil, nil, err
+	}
+	return columns, values, nil
+}
+
+// Fields using the Default Database type
+func Fields(src interface{}, includePk bool) ([]string, []interface{}, error) {
+	return Default.Fields(src, includePk)
+}
+
+// InsertParts returns the columns, placeholders, and values that Insert
+// would use for src, so that other columns can be added before building
+// the statement. The primary key is included if it is non-zero. The
+// placeholders are numbered from 1, so the ones for extra values follow
+// on from len(placeholders)+1.
+func (d *Database) InsertParts(src interface{}) (columns []string, placeholders []string, values []interface{}, err error) {
+	data, err := d.getFields(reflect.TypeOf(src))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	_, _, pkSet, err := d.primaryKeyValue(src)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	columns = data.writeColumns(pkSet)
+	values, err = d.SomeValues(src, columns)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return columns, d.writePlaceholders(data, src, columns, 1), values, nil
+}
+
+// InsertParts using the Default Database type
+func InsertParts(src interface{}) (columns []string, placeholders []string, values []interface{}, err error) {
+	return Default.InsertParts(src)
+}
+
 // SomeValues returns a list of PreWrite processed values suitable for
 // use in an INSERT or UPDATE query. The columns used are the same ones (in
-// the same order) as specified in the columns argument.
+// the same order) as specified in the columns argument. Note that it
+// modifies src: if the columns include the one of a field marked as
+// etag, that field is updated first, and the field marked as
+// discriminator of a type registered with RegisterSubtype is set to the
+// name it was registered under.
 func (d *Database) SomeValues(src interface{}, columns []string) ([]interface{}, error) {
-	data, err := getFields(reflect.TypeOf(src))
+	data, err := d.getFields(reflect.TypeOf(src))
 	if err != nil {
 		return nil, err
 	}
 	structVal := reflect.ValueOf(src).Elem()
 
+	if data.discriminator != "" && data.subtype != "" {
+		fieldByIndex(structVal, data.fields[data.discriminator].index, true).SetString(data.subtype)
+	}
+
+	if data.etag != "" {
+		for _, name := range columns {
+			if name == data.etag {
+				if err := d.updateETag(data, src); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
 	var values []interface{}
+	var multi map[string][]interface{}
 	for _, name := range columns {
 		field, present := data.fields[name]
 		if !present {
@@ -329,7 +1211,34 @@ func (d *Database) SomeValues(src interface{}, columns []string) ([]interface{},
 			continue
 		}
 
-		saveVal, err := field.meddler.PreWrite(structVal.Field(field.index).Interface())
+		fieldVal := fieldByIndex(structVal, field.index, false)
+		if !fieldVal.IsValid() || field.absent(structVal) {
+			// the field is part of a nil or absent embedded struct
+			values = append(values, nil)
+			continue
+		}
+
+		if field.columns != nil {
+			// a field stored in several columns is meddled with only once
+			parts, done := multi[field.columns[0]]
+			if !done {
+				parts, err = field.meddler.(MultiColumnMeddler).PreWriteColumns(fieldVal.Interface())
+				if err != nil {
+					return nil, fmt.Errorf("meddler.SomeValues: PreWriteColumns error on column [%s]: %v", name, err)
+				}
+				if len(parts) != len(field.columns) {
+					return nil, fmt.Errorf("meddler.SomeValues: PreWriteColumns returned %d values for %d columns", len(parts), len(field.columns))
+				}
+				if multi == nil {
+					multi = make(map[string][]interface{})
+				}
+				multi[field.columns[0]] = parts
+			}
+			values = append(values, parts[field.part])
+			continue
+		}
+
+		saveVal, err := d.preWrite(field.meddler, fieldVal.Interface())
 		if err != nil {
 			return nil, fmt.Errorf("meddler.SomeValues: PreWrite error on column [%s]: %v", name, err)
 		}
@@ -344,10 +1253,56 @@ func SomeValues(src interface{}, columns []string) ([]interface{}, error) {
 	return Default.SomeValues(src, columns)
 }
 
+// BindValue converts a value to the form it would be written to the given
+// column in, by running it through the PreWrite method of the column's
+// meddler. This lets hand-written conditions compare against columns
+// stored with a meddler, such as json or utctime columns. It is no use
+// for meddlers that write a different value each time, such as
+// EncryptedMeddler, which seals with a random nonce. model is a pointer
+// to a struct with the column, and value must be assignable to the type
+// of its field, or convertible to it without changing its kind of value,
+// as from int to int64 or from string to a string type.
+func (d *Database) BindValue(model interface{}, column string, value interface{}) (interface{}, error) {
+	data, err := d.getFields(reflect.TypeOf(model))
+	if err != nil {
+		return nil, err
+	}
+	field, present := data.fields[column]
+	if !present {
+		return nil, fmt.Errorf("meddler.BindValue: column [%s] not found in struct", column)
+	}
+	if field.columns != nil {
+		return nil, fmt.Errorf("meddler.BindValue: column [%s] is part of a field stored in several columns", column)
+	}
+
+	fieldType := reflect.TypeOf(model).Elem().FieldByIndex(field.index).Type
+	val := reflect.ValueOf(value)
+	switch {
+	case value == nil:
+		val = reflect.Zero(fieldType)
+	case val.Type().AssignableTo(fieldType):
+	case sameKindConvertible(val.Type(), fieldType):
+		val = val.Convert(fieldType)
+	default:
+		return nil, fmt.Errorf("meddler.BindValue: cannot use %T as a value for column [%s] of type %s", value, column, fieldType)
+	}
+
+	saveVal, err := d.preWrite(field.meddler, val.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("meddler.BindValue: PreWrite error on column [%s]: %v", column, err)
+	}
+	return saveVal, nil
+}
+
+// BindValue using the Default Database type
+func BindValue(model interface{}, column string, value interface{}) (interface{}, error) {
+	return Default.BindValue(model, column, value)
+}
+
 // Placeholders returns a list of placeholders suitable for an INSERT or UPDATE query.
 // If includePk is false, the primary key field is omitted.
 func (d *Database) Placeholders(src interface{}, includePk bool) ([]string, error) {
-	data, err := getFields(reflect.TypeOf(src))
+	data, err := d.getFields(reflect.TypeOf(src))
 	if err != nil {
 		return nil, err
 	}
@@ -394,11 +1349,11 @@ func (d *Database) goTypeKind(data *structData, src interface{}, fieldName strin
 		return ""
 	}
 	if data == nil {
-		d, err := getFields(reflect.TypeOf(src))
+		fields, err := d.getFields(reflect.TypeOf(src))
 		if err != nil {
 			return ""
 		}
-		data = d
+		data = fields
 	}
 	return data.fields[fieldName].kind.String()
 }
@@ -428,6 +1383,7 @@ func (d *Database) scanRow(data *structData, rows *sql.Rows, dst interface{}, co
 	if err := d.WriteTargets(dst, columns, targets); err != nil {
 		return err
 	}
+	atomic.AddInt64(&rowsRead, 1)
 
 	return rows.Err()
 }
@@ -437,21 +1393,52 @@ func (d *Database) scanRow(data *structData, rows *sql.Rows, dst interface{}, co
 // the Scan is performed, the same values should be handed to
 // WriteTargets to finalize the values and record them in the struct.
 func (d *Database) Targets(dst interface{}, columns []string) ([]interface{}, error) {
-	data, err := getFields(reflect.TypeOf(dst))
+	data, err := d.getFields(reflect.TypeOf(dst))
 	if err != nil {
 		return nil, err
 	}
 
+	if err := data.checkResult("Targets", columns); err != nil {
+		return nil, err
+	}
+
 	structVal := reflect.ValueOf(dst).Elem()
 
 	var targets []interface{}
+	var multi map[string][]interface{}
 	for _, name := range columns {
-		if field, present := data.fields[name]; present {
-			fieldAddr := structVal.Field(field.index).Addr().Interface()
-			scanTarget, err := field.meddler.PreRead(fieldAddr)
+		if field, present := data.resultField(name); present {
+			fieldAddr := fieldByIndex(structVal, field.index, true).Addr().Interface()
+			if field.columns != nil {
+				// a field stored in several columns is meddled with only once
+				parts, done := multi[field.columns[0]]
+				if !done {
+					parts, err = field.meddler.(MultiColumnMeddler).PreReadColumns(fieldAddr)
+					if err != nil {
+						return nil, fmt.Errorf("meddler.Targets: PreReadColumns error on column %s: %v", name, err)
+					}
+					if len(parts) != len(field.columns) {
+						return nil, fmt.Errorf("meddler.Targets: PreReadColumns returned %d targets for %d columns", len(parts), len(field.columns))
+					}
+					if multi == nil {
+						multi = make(map[string][]interface{})
+					}
+					multi[field.columns[0]] = parts
+				}
+				targets = append(targets, parts[field.part])
+				continue
+			}
+			if _, ok := field.readMeddler().(IdentityMeddler); ok && d.WarnPrecisionLoss && (field.kind == reflect.Float64 || field.kind == reflect.Float32) {
+				targets = append(targets, &floatTarget{column: name, dst: fieldByIndex(structVal, field.index, true)})
+				continue
+			}
+			scanTarget, err := d.preRead(field.readMeddler(), fieldAddr)
 			if err != nil {
 				return nil, fmt.Errorf("meddler.Targets: PreRead error on column %s: %v", name, err)
 			}
+			if field.nullable {
+				scanTarget = nullableTarget(scanTarget)
+			}
 			targets = append(targets, scanTarget)
 		} else {
 			// no destination, so throw this away
@@ -466,6 +1453,46 @@ func (d *Database) Targets(dst interface{}, columns []string) ([]interface{}, er
 	return targets, nil
 }
 
+// floatTarget scans a value into a float field, logging a warning if a
+// value given as text does not survive the conversion.
+type floatTarget struct {
+	column string
+	dst    reflect.Value
+}
+
+func (t *floatTarget) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		return fmt.Errorf("converting NULL to %s is unsupported", t.dst.Kind())
+	case float64:
+		t.dst.SetFloat(v)
+		return nil
+	case int64:
+		t.dst.SetFloat(float64(v))
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("unsupported type %T for a %s field", src, t.dst.Kind())
+	}
+
+	bits := t.dst.Type().Bits()
+	f, err := strconv.ParseFloat(text, bits)
+	if err != nil {
+		return fmt.Errorf("converting %q to %s: %v", text, t.dst.Kind(), err)
+	}
+	exact, ok := new(big.Rat).SetString(text)
+	rounded, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, bits))
+	if ok && rounded != nil && exact.Cmp(rounded) != 0 {
+		log.Printf("meddler.Targets: column [%s] value %s loses precision as %s, use a decimal type", t.column, text, t.dst.Kind())
+	}
+	t.dst.SetFloat(f)
+	return nil
+}
+
 // Targets using the Default Database type
 func Targets(dst interface{}, columns []string) ([]interface{}, error) {
 	return Default.Targets(dst, columns)
@@ -480,16 +1507,50 @@ func (d *Database) WriteTargets(dst interface{}, columns []string, targets []int
 			len(columns), len(targets))
 	}
 
-	data, err := getFields(reflect.TypeOf(dst))
+	data, err := d.getFields(reflect.TypeOf(dst))
 	if err != nil {
 		return err
 	}
 	structVal := reflect.ValueOf(dst).Elem()
 
+	var multi map[string][]interface{}
+	seen := make([]bool, len(data.optional))
+	allNull := make([]bool, len(data.optional))
+	for j := range allNull {
+		allNull[j] = true
+	}
 	for i, name := range columns {
-		if field, present := data.fields[name]; present {
-			fieldAddr := structVal.Field(field.index).Addr().Interface()
-			err := field.meddler.PostRead(fieldAddr, targets[i])
+		if field, present := data.resultField(name); present {
+			for j, path := range data.optional {
+				if hasIndexPrefix(field.index, path) {
+					seen[j] = true
+					allNull[j] = allNull[j] && isNullTarget(field, targets[i])
+				}
+			}
+			if field.columns != nil {
+				// gather the targets of a field stored in several columns
+				if multi == nil {
+					multi = make(map[string][]interface{})
+				}
+				parts := multi[field.columns[0]]
+				if parts == nil {
+					parts = make([]interface{}, len(field.columns))
+					multi[field.columns[0]] = parts
+				}
+				parts[field.part] = targets[i]
+				continue
+			}
+			fieldVal := fieldByIndex(structVal, field.index, true)
+			target := targets[i]
+			if field.nullable {
+				var null bool
+				if target, null = unwrapNullable(target); null {
+					// a null column leaves the meddler out, and the field zero
+					fieldVal.Set(reflect.Zero(fieldVal.Type()))
+					continue
+				}
+			}
+			err := d.postRead(field.readMeddler(), fieldVal.Addr().Interface(), target)
 			if err != nil {
 				return fmt.Errorf("meddler.WriteTargets: PostRead error on column [%s]: %v", name, err)
 			}
@@ -501,9 +1562,101 @@ func (d *Database) WriteTargets(dst interface{}, columns []string, targets []int
 		}
 	}
 
+	// write the fields stored in several columns
+	for key, parts := range multi {
+		field := data.fields[key]
+		for j, part := range parts {
+			if part == nil {
+				return fmt.Errorf("meddler.WriteTargets: column [%s] is missing, but is needed along with %v", field.columns[j], field.columns)
+			}
+		}
+		fieldAddr := fieldByIndex(structVal, field.index, true).Addr().Interface()
+		if err := field.meddler.(MultiColumnMeddler).PostReadColumns(fieldAddr, parts); err != nil {
+			return fmt.Errorf("meddler.WriteTargets: PostReadColumns error on columns %v: %v", field.columns, err)
+		}
+	}
+
+	// drop optional structs that only had null columns
+	for j, path := range data.optional {
+		if seen[j] && allNull[j] {
+			if v := fieldByIndex(structVal, path, false); v.IsValid() {
+				v.Set(reflect.Zero(v.Type()))
+			}
+		}
+	}
+
 	return nil
 }
 
+// hasIndexPrefix reports whether the index path of a field starts with
+// the index path of an enclosing struct.
+func hasIndexPrefix(index, prefix []int) bool {
+	if len(index) <= len(prefix) {
+		return false
+	}
+	for k, x := range prefix {
+		if index[k] != x {
+			return false
+		}
+	}
+	return true
+}
+
+// isNullTarget reports whether a scan target of the field was given a
+// null column. This is only known for the fields of optional structs,
+// whose plain fields are read with ZeroIsNullMeddler, and whose meddled
+// fields are scanned into a nullableTarget.
+func isNullTarget(field *structField, target interface{}) bool {
+	if field.nullable {
+		_, null := unwrapNullable(target)
+		return null
+	}
+	if _, ok := field.readMeddler().(ZeroIsNullMeddler); !ok || field.columns != nil {
+		return false
+	}
+	return reflect.ValueOf(target).Elem().IsNil()
+}
+
+// nullScanner wraps a scan target that is an sql.Scanner, noting a null
+// column instead of passing it on.
+type nullScanner struct {
+	sql.Scanner
+	null bool
+}
+
+func (n *nullScanner) Scan(src interface{}) error {
+	if src == nil {
+		n.null = true
+		return nil
+	}
+	return n.Scanner.Scan(src)
+}
+
+// nullableTarget wraps the scan target of a meddler so that a null column
+// can be told apart before the meddler sees it. A Scanner is wrapped in a
+// nullScanner; other targets are replaced by a pointer to their type,
+// which database/sql leaves nil for null, and otherwise points to a new
+// value holding the column.
+func nullableTarget(target interface{}) interface{} {
+	if s, ok := target.(sql.Scanner); ok {
+		return &nullScanner{Scanner: s}
+	}
+	return reflect.New(reflect.TypeOf(target)).Interface()
+}
+
+// unwrapNullable returns the meddler's scan target held by a
+// nullableTarget, and whether the column was null.
+func unwrapNullable(target interface{}) (interface{}, bool) {
+	if n, ok := target.(*nullScanner); ok {
+		return n.Scanner, n.null
+	}
+	v := reflect.ValueOf(target).Elem()
+	if v.IsNil() {
+		return nil, true
+	}
+	return v.Interface(), false
+}
+
 // WriteTargets using the Default Database type
 func WriteTargets(dst interface{}, columns []string, targets []interface{}) error {
 	return Default.WriteTargets(dst, columns, targets)
@@ -514,7 +1667,7 @@ func WriteTargets(dst interface{}, columns []string, targets []interface{}) erro
 // Returns sql.ErrNoRows if there is no data to read.
 func (d *Database) Scan(rows *sql.Rows, dst interface{}) error {
 	// get the list of struct fields
-	data, err := getFields(reflect.TypeOf(dst))
+	data, err := d.getFields(reflect.TypeOf(dst))
 	if err != nil {
 		return err
 	}
@@ -555,10 +1708,118 @@ func ScanRow(rows *sql.Rows, dst interface{}) error {
 	return Default.ScanRow(rows, dst)
 }
 
+// ScanRowColumns is like ScanRow, but also returns the columns of the
+// result in the order of the query, as they were matched against the
+// fields of dst. This includes columns that match no field.
+func (d *Database) ScanRowColumns(rows *sql.Rows, dst interface{}) ([]string, error) {
+	// make sure we always close rows
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.ScanRow(rows, dst); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// ScanRowColumns using the Default Database type
+func ScanRowColumns(rows *sql.Rows, dst interface{}) ([]string, error) {
+	return Default.ScanRowColumns(rows, dst)
+}
+
+// ScanRowExtra scans a single sql result row into a struct, like ScanRow,
+// and returns the values of columns that are not mapped to any field of
+// the struct in a map keyed by column name. Null columns are represented
+// as selected by MapNulls.
+// It reads exactly one result row and closes rows when finished.
+// Returns sql.ErrNoRows if there is no result row.
+func (d *Database) ScanRowExtra(rows *sql.Rows, dst interface{}) (map[string]interface{}, error) {
+	// make sure we always close rows
+	defer rows.Close()
+
+	data, err := d.getFields(reflect.TypeOf(dst))
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	// split the columns into known and extra ones
+	var known []string
+	extra := make(map[string]interface{})
+	extraTargets := make(map[string]*interface{})
+	for _, name := range columns {
+		if _, present := data.resultField(name); present {
+			known = append(known, name)
+		} else {
+			extraTargets[name] = new(interface{})
+		}
+	}
+	knownTargets, err := d.Targets(dst, known)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]interface{}, 0, len(columns))
+	for _, name := range columns {
+		if target, ok := extraTargets[name]; ok {
+			targets = append(targets, target)
+		} else {
+			targets = append(targets, knownTargets[0])
+			knownTargets = knownTargets[1:]
+		}
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	if err := rows.Scan(targets...); err != nil {
+		return nil, err
+	}
+	j := 0
+	for i, name := range columns {
+		if target, ok := extraTargets[name]; ok {
+			switch {
+			case *target != nil:
+				extra[name] = *target
+			case d.MapNulls == MapNullsSentinel:
+				extra[name] = Null
+			case d.MapNulls != MapNullsOmit:
+				extra[name] = nil
+			}
+		} else {
+			targets[j] = targets[i]
+			j++
+		}
+	}
+	if err := d.WriteTargets(dst, known, targets[:j]); err != nil {
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return extra, nil
+}
+
+// ScanRowExtra using the Default Database type
+func ScanRowExtra(rows *sql.Rows, dst interface{}) (map[string]interface{}, error) {
+	return Default.ScanRowExtra(rows, dst)
+}
+
 // ScanAll scans all sql result rows into a slice of structs.
 // It reads all rows and closes rows when finished.
 // dst should be a pointer to a slice of the appropriate type.
 // The new results will be appended to any existing data in dst.
+// If a row fails to scan, the error is a *ScanError, and the rows
+// before it are left in dst.
 func (d *Database) ScanAll(rows *sql.Rows, dst interface{}) error {
 	// make sure we always close rows
 	defer rows.Close()
@@ -574,15 +1835,15 @@ func (d *Database) ScanAll(rows *sql.Rows, dst interface{}) error {
 	}
 	ptrType := sliceVal.Type().Elem()
 	if ptrType.Kind() != reflect.Ptr {
-		return fmt.Errorf("ScanAll expects element to be pointers, found %T", dst)
+		return fmt.Errorf("ScanAll expects elements to be pointers to structs, as in *[]*T, but %T has elements of type %v", dst, ptrType)
 	}
 	eltType := ptrType.Elem()
 	if eltType.Kind() != reflect.Struct {
-		return fmt.Errorf("ScanAll expects element to be pointers to structs, found %T", dst)
+		return fmt.Errorf("ScanAll expects elements to be pointers to structs, as in *[]*T, but %T has elements of type %v", dst, ptrType)
 	}
 
 	// get the list of struct fields
-	data, err := getFields(ptrType)
+	data, err := d.getFields(ptrType)
 	if err != nil {
 		return err
 	}
@@ -594,7 +1855,7 @@ func (d *Database) ScanAll(rows *sql.Rows, dst interface{}) error {
 	}
 
 	// gather the results
-	for {
+	for row := 0; ; row++ {
 		// create a new element
 		eltVal := reflect.New(eltType)
 		elt := eltVal.Interface()
@@ -602,9 +1863,12 @@ func (d *Database) ScanAll(rows *sql.Rows, dst interface{}) error {
 		// scan it
 		if err := d.scanRow(data, rows, elt, columns); err != nil {
 			if err == sql.ErrNoRows {
+				if d.EmptySlices && sliceVal.IsNil() {
+					sliceVal.Set(reflect.MakeSlice(sliceVal.Type(), 0, 0))
+				}
 				return nil
 			}
-			return err
+			return &ScanError{Row: row, Err: err}
 		}
 
 		// add to the result slice
@@ -612,7 +1876,203 @@ func (d *Database) ScanAll(rows *sql.Rows, dst interface{}) error {
 	}
 }
 
+// ScanError reports a row that ScanAll could not scan.
+type ScanError struct {
+	Row int // position of the row in the results, counting from 0
+	Err error
+}
+
+func (err *ScanError) Error() string {
+	return fmt.Sprintf("meddler.ScanAll: error scanning row %d: %v", err.Row, err.Err)
+}
+
+// Unwrap returns the error from scanning the row.
+func (err *ScanError) Unwrap() error {
+	return err.Err
+}
+
 // ScanAll using the Default Database type
 func ScanAll(rows *sql.Rows, dst interface{}) error {
 	return Default.ScanAll(rows, dst)
 }
+
+// ScanAllPivot scans rows holding one attribute each, as returned from an
+// entity-attribute-value schema, into one struct per primary key, gathering
+// the attributes into a map field. dst is a pointer to a slice of pointers
+// to structs, as for ScanAll, and the struct type must have a primary key.
+// mapColumn is the column name of the map field, whose type is
+// map[string]string (usually marked scanonly, as it is not a column of the
+// table), and keyColumn and valueColumn are the result columns holding
+// the name and the value of each attribute. The other columns of the first
+// row of each primary key fill in the struct. Rows with a null name add no
+// attribute, as for entities without attributes in an outer join, and
+// null values are read as empty strings. The structs are appended in the
+// order their primary keys first appear. It reads all rows and closes rows
+// when finished.
+func (d *Database) ScanAllPivot(rows *sql.Rows, dst interface{}, mapColumn, keyColumn, valueColumn string) error {
+	// make sure we always close rows
+	defer rows.Close()
+
+	dstVal := reflect.ValueOf(dst)
+	if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() || dstVal.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("meddler.ScanAllPivot: dst must be a pointer to a slice, found %T", dst)
+	}
+	sliceVal := dstVal.Elem()
+	ptrType := sliceVal.Type().Elem()
+	if ptrType.Kind() != reflect.Ptr || ptrType.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("meddler.ScanAllPivot: expects elements to be pointers to structs, as in *[]*T, but %T has elements of type %v", dst, ptrType)
+	}
+	data, err := d.getFields(ptrType)
+	if err != nil {
+		return err
+	}
+	if data.pk == "" {
+		return fmt.Errorf("meddler.ScanAllPivot: no primary key field found")
+	}
+	mapField, present := data.fields[mapColumn]
+	if !present {
+		return fmt.Errorf("meddler.ScanAllPivot: map column [%s] not found in struct", mapColumn)
+	}
+	if mapType := ptrType.Elem().FieldByIndex(mapField.index).Type; mapType != reflect.TypeOf(map[string]string(nil)) {
+		return fmt.Errorf("meddler.ScanAllPivot: map column [%s] has type %v, but must be map[string]string", mapColumn, mapType)
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	keyIndex, valueIndex := -1, -1
+	for i, name := range columns {
+		switch name {
+		case keyColumn:
+			keyIndex = i
+		case valueColumn:
+			valueIndex = i
+		}
+	}
+	if keyIndex < 0 || valueIndex < 0 {
+		return fmt.Errorf("meddler.ScanAllPivot: attribute columns [%s] and [%s] must both be in the results", keyColumn, valueColumn)
+	}
+
+	// gather the results
+	parents := make(map[interface{}]map[string]string)
+	for rows.Next() {
+		eltVal := reflect.New(ptrType.Elem())
+		elt := eltVal.Interface()
+		targets, err := d.Targets(elt, columns)
+		if err != nil {
+			return err
+		}
+		var key, value sql.NullString
+		targets[keyIndex], targets[valueIndex] = &key, &value
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+		targets[keyIndex], targets[valueIndex] = new(interface{}), new(interface{})
+
+		if err := d.WriteTargets(elt, columns, targets); err != nil {
+			return err
+		}
+		_, pk, _, err := d.primaryKeyValue(elt)
+		if err != nil {
+			return err
+		}
+		attrs, seen := parents[pk]
+		if !seen {
+			attrs = make(map[string]string)
+			parents[pk] = attrs
+			fieldByIndex(eltVal.Elem(), mapField.index, true).Set(reflect.ValueOf(attrs))
+			sliceVal.Set(reflect.Append(sliceVal, eltVal))
+		}
+		if key.Valid {
+			attrs[key.String] = value.String
+		}
+	}
+
+	return rows.Err()
+}
+
+// ScanAllPivot using the Default Database type
+func ScanAllPivot(rows *sql.Rows, dst interface{}, mapColumn, keyColumn, valueColumn string) error {
+	return Default.ScanAllPivot(rows, dst, mapColumn, keyColumn, valueColumn)
+}
+
+// ScanColumnar scans all sql result rows into a struct of slices, with
+// one slice field per column, appending the value of the column in each
+// row to its slice, as a column-oriented alternative to ScanAll:
+//
+//	type Prices struct {
+//		Day   []time.Time `meddler:"day"`
+//		Close []float64   `meddler:"close"`
+//	}
+//
+// dst must be a pointer to such a struct. Meddlers named in the tags are
+// applied to each element. Fields whose columns are missing from the
+// results are left alone. It reads all rows and closes rows when finished.
+func (d *Database) ScanColumnar(rows *sql.Rows, dst interface{}) error {
+	// make sure we always close rows
+	defer rows.Close()
+
+	data, err := d.getFields(reflect.TypeOf(dst))
+	if err != nil {
+		return err
+	}
+	structVal := reflect.ValueOf(dst).Elem()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if err := data.checkResult("ScanColumnar", columns); err != nil {
+		return err
+	}
+	fields := make([]*structField, len(columns))
+	for i, name := range columns {
+		field, present := data.resultField(name)
+		if !present {
+			if Debug {
+				log.Printf("meddler.ScanColumnar: column [%s] not found in struct", name)
+			}
+			continue
+		}
+		if field.columns != nil || fieldByIndex(structVal, field.index, true).Kind() != reflect.Slice {
+			return fmt.Errorf("meddler.ScanColumnar: column [%s] must be a slice field", name)
+		}
+		fields[i] = field
+	}
+
+	// gather the results
+	for rows.Next() {
+		elts := make([]reflect.Value, len(columns))
+		targets := make([]interface{}, len(columns))
+		for i, field := range fields {
+			if field == nil {
+				targets[i] = new(interface{})
+				continue
+			}
+			elts[i] = reflect.New(fieldByIndex(structVal, field.index, true).Type().Elem())
+			if targets[i], err = d.preRead(field.meddler, elts[i].Interface()); err != nil {
+				return fmt.Errorf("meddler.ScanColumnar: PreRead error on column [%s]: %v", columns[i], err)
+			}
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+		for i, field := range fields {
+			if field == nil {
+				continue
+			}
+			if err := d.postRead(field.meddler, elts[i].Interface(), targets[i]); err != nil {
+				return fmt.Errorf("meddler.ScanColumnar: PostRead error on column [%s]: %v", columns[i], err)
+			}
+			slice := fieldByIndex(structVal, field.index, true)
+			slice.Set(reflect.Append(slice, elts[i].Elem()))
+		}
+	}
+
+	return rows.Err()
+}
+
+// ScanColumnar using the Default Database type
+func ScanColumnar(rows *sql.Rows, dst interface{}) error {
+	return Default.ScanColumnar(rows, dst)
+}
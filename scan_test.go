@@ -1,8 +1,11 @@
 package meddler
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
+	"log"
+	"os"
 	"reflect"
 	"sort"
 	"strings"
@@ -69,6 +72,53 @@ const schema2 = `create table item (
 	stuffz blob not null
 )`
 
+const schema3 = `create table document (
+	id integer primary key,
+	title text not null,
+	created_by text,
+	revision integer
+)`
+
+const schema4 = `create table event (
+	id integer primary key,
+	event_date text,
+	event_time text
+)`
+
+const schema5 = `create table gadget (
+	id integer primary key,
+	name text not null,
+	slug text
+)`
+
+const schema5Trigger = `create trigger gadget_slug after insert on gadget begin
+	update gadget set slug = lower(new.name) where id = new.id;
+end`
+
+const schema6 = `create table product (
+	id integer primary key,
+	price integer not null,
+	qty integer not null,
+	total integer generated always as (price * qty) stored
+)`
+
+const schema7 = `create table account (
+	id integer primary key,
+	email text not null,
+	name text,
+	active integer not null
+)`
+
+const schema7Index = `create unique index account_email on account (email) where active`
+
+const schema8 = `create table place (
+	id integer primary key,
+	name text not null,
+	location text,
+	lat real,
+	lng real
+)`
+
 var aliceHeight int = 65
 var alice = &Person{
 	Name:      "Alice",
@@ -103,6 +153,30 @@ func setup() {
 	if _, err = db.Exec(schema2); err != nil {
 		panic("error creating item table: " + err.Error())
 	}
+	if _, err = db.Exec(schema3); err != nil {
+		panic("error creating document table: " + err.Error())
+	}
+	if _, err = db.Exec(schema4); err != nil {
+		panic("error creating event table: " + err.Error())
+	}
+	if _, err = db.Exec(schema5); err != nil {
+		panic("error creating gadget table: " + err.Error())
+	}
+	if _, err = db.Exec(schema5Trigger); err != nil {
+		panic("error creating gadget trigger: " + err.Error())
+	}
+	if _, err = db.Exec(schema6); err != nil {
+		panic("error creating product table: " + err.Error())
+	}
+	if _, err = db.Exec(schema7); err != nil {
+		panic("error creating account table: " + err.Error())
+	}
+	if _, err = db.Exec(schema7Index); err != nil {
+		panic("error creating account index: " + err.Error())
+	}
+	if _, err = db.Exec(schema8); err != nil {
+		panic("error creating place table: " + err.Error())
+	}
 }
 
 func structFieldEqual(t *testing.T, elt *structField, ref *structField) {
@@ -116,7 +190,7 @@ func structFieldEqual(t *testing.T, elt *structField, ref *structField) {
 	if elt.primaryKey != ref.primaryKey {
 		t.Errorf("Column %s primaryKey found as %v", ref.column, elt.primaryKey)
 	}
-	if elt.index != ref.index {
+	if !reflect.DeepEqual(elt.index, ref.index) {
 		t.Errorf("Column %s index found as %v", ref.column, elt.index)
 	}
 	if elt.meddler != ref.meddler {
@@ -125,7 +199,7 @@ func structFieldEqual(t *testing.T, elt *structField, ref *structField) {
 }
 
 func TestGetFields(t *testing.T) {
-	data, err := getFields(reflect.TypeOf((*Person)(nil)))
+	data, err := Default.getFields(reflect.TypeOf((*Person)(nil)))
 	if err != nil {
 		t.Errorf("Error in getFields: %v", err)
 		return
@@ -135,14 +209,14 @@ func TestGetFields(t *testing.T) {
 	if len(data.fields) != 8 || len(data.columns) != 8 {
 		t.Errorf("Found %d/%d fields, expected 8", len(data.fields), len(data.columns))
 	}
-	structFieldEqual(t, data.fields[data.columns[0]], &structField{"id", 0, true, registry["identity"]})
-	structFieldEqual(t, data.fields[data.columns[1]], &structField{"name", 1, false, registry["identity"]})
-	structFieldEqual(t, data.fields[data.columns[2]], &structField{"Email", 3, false, registry["identity"]})
-	structFieldEqual(t, data.fields[data.columns[3]], &structField{"Age", 5, false, registry["zeroisnull"]})
-	structFieldEqual(t, data.fields[data.columns[4]], &structField{"opened", 6, false, registry["utctime"]})
-	structFieldEqual(t, data.fields[data.columns[5]], &structField{"closed", 7, false, registry["utctimez"]})
-	structFieldEqual(t, data.fields[data.columns[6]], &structField{"updated", 8, false, registry["localtime"]})
-	structFieldEqual(t, data.fields[data.columns[7]], &structField{"height", 9, false, registry["identity"]})
+	structFieldEqual(t, data.fields[data.columns[0]], &structField{column: "id", index: []int{0}, primaryKey: true, meddler: registry["identity"]})
+	structFieldEqual(t, data.fields[data.columns[1]], &structField{column: "name", index: []int{1}, primaryKey: false, meddler: registry["identity"]})
+	structFieldEqual(t, data.fields[data.columns[2]], &structField{column: "Email", index: []int{3}, primaryKey: false, meddler: registry["identity"]})
+	structFieldEqual(t, data.fields[data.columns[3]], &structField{column: "Age", index: []int{5}, primaryKey: false, meddler: registry["zeroisnull"]})
+	structFieldEqual(t, data.fields[data.columns[4]], &structField{column: "opened", index: []int{6}, primaryKey: false, meddler: registry["utctime"]})
+	structFieldEqual(t, data.fields[data.columns[5]], &structField{column: "closed", index: []int{7}, primaryKey: false, meddler: registry["utctimez"]})
+	structFieldEqual(t, data.fields[data.columns[6]], &structField{column: "updated", index: []int{8}, primaryKey: false, meddler: registry["localtime"]})
+	structFieldEqual(t, data.fields[data.columns[7]], &structField{column: "height", index: []int{9}, primaryKey: false, meddler: registry["identity"]})
 }
 
 func personEqual(t *testing.T, elt *Person, ref *Person) {
@@ -236,6 +310,105 @@ func TestColumns(t *testing.T) {
 	}
 }
 
+func TestFieldMeddlers(t *testing.T) {
+	once.Do(setup)
+
+	names, err := FieldMeddlers(new(Person))
+	if err != nil {
+		t.Fatalf("Error getting FieldMeddlers: %v", err)
+	}
+	expected := map[string]string{
+		"id":      "identity",
+		"name":    "identity",
+		"Email":   "identity",
+		"Age":     "zeroisnull",
+		"opened":  "utctime",
+		"closed":  "utctimez",
+		"updated": "localtime",
+		"height":  "identity",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, found %v", expected, names)
+	}
+
+	type Timed struct {
+		At    time.Time  `meddler:",datetime,columns=at_date+at_time"`
+		Local *time.Time `meddler:"local,tz=Europe/Berlin"`
+	}
+	names, err = FieldMeddlers(new(Timed))
+	if err != nil {
+		t.Fatalf("Error getting FieldMeddlers: %v", err)
+	}
+	expected = map[string]string{
+		"at_date": "datetime",
+		"at_time": "datetime",
+		"local":   "tz=Europe/Berlin",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, found %v", expected, names)
+	}
+}
+
+func TestColumnOverrides(t *testing.T) {
+	once.Do(setup)
+
+	type Generated struct {
+		ID       int64  `meddler:"id,pk"`
+		FullName string `meddler:"full_name"`
+		Email    string
+	}
+	d := *SQLite
+	d.ColumnOverrides = map[reflect.Type]map[string]string{
+		reflect.TypeOf(Generated{}): {"FullName": "name", "Email": "mail"},
+		reflect.TypeOf(Person{}):    {"ID": "other_id"},
+	}
+	names, err := d.Columns(new(Generated), true)
+	if err != nil {
+		t.Fatalf("Error getting Columns: %v", err)
+	}
+	sort.Strings(names)
+	if expected := []string{"id", "mail", "name"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, found %v", expected, names)
+	}
+
+	// a type of the same name elsewhere is not affected
+	{
+		type Generated struct {
+			ID       int64  `meddler:"id,pk"`
+			FullName string `meddler:"full_name"`
+		}
+		names, err := d.Columns(new(Generated), true)
+		if err != nil {
+			t.Fatalf("Error getting Columns: %v", err)
+		}
+		sort.Strings(names)
+		if expected := []string{"full_name", "id"}; !reflect.DeepEqual(names, expected) {
+			t.Errorf("expected %v, found %v", expected, names)
+		}
+	}
+
+	// the other Database values are not affected
+	names, err = SQLite.Columns(new(Generated), true)
+	if err != nil {
+		t.Fatalf("Error getting Columns: %v", err)
+	}
+	sort.Strings(names)
+	if expected := []string{"Email", "full_name", "id"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, found %v", expected, names)
+	}
+
+	// and the override is used in queries
+	insertAliceBob(t)
+	elt := new(Generated)
+	if err := d.QueryRow(db, elt, "select id, name, Email as mail from person where id = ?", 1); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if elt.FullName != "Alice" || elt.Email != "alice@alice.com" {
+		t.Errorf("unexpected record %v", elt)
+	}
+	db.Exec("delete from person")
+}
+
 func TestColumnsQuoted(t *testing.T) {
 	once.Do(setup)
 
@@ -265,6 +438,107 @@ func TestColumnsQuoted(t *testing.T) {
 	}
 }
 
+func TestColumnsUnexportedTag(t *testing.T) {
+	type Renamed struct {
+		ID    int64  `meddler:"id,pk"`
+		email string `meddler:"email"`
+		notes string `meddler:"-"`
+		extra int
+	}
+	_, err := Columns(new(Renamed), true)
+	if err == nil || !strings.Contains(err.Error(), "email") {
+		t.Errorf("expected an error naming the unexported field, found %v", err)
+	}
+
+	lenient := *SQLite
+	lenient.IgnoreUnexportedTags = true
+	names, err := lenient.Columns(new(Renamed), true)
+	if err != nil {
+		t.Fatalf("Columns error: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"id"}) {
+		t.Errorf("expected only the id column, found %v", names)
+	}
+}
+
+func TestColumnsQuotedWithoutPk(t *testing.T) {
+	once.Do(setup)
+
+	names, err := SQLite.ColumnsQuoted(new(Person), false)
+	if err != nil {
+		t.Fatalf("Error getting ColumnsQuoted: %v", err)
+	}
+	expected := `"name","Email","Age","opened","closed","updated","height"`
+	if names != expected {
+		t.Errorf("Mismatch: expected %s, got %s", expected, names)
+	}
+
+	// the list can select the other columns of a row whose pk is known
+	insertAliceBob(t)
+	elt := new(Person)
+	if err := QueryRow(db, elt, "select "+names+" from person where id = ?", 2); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if elt.ID != 0 || elt.Name != "Bob" {
+		t.Errorf("expected Bob without an id, found %v", elt)
+	}
+	db.Exec("delete from person")
+}
+
+func TestQuoteReservedOnly(t *testing.T) {
+	once.Do(setup)
+
+	type Line struct {
+		ID    int64  `meddler:"id,pk"`
+		Order int    `meddler:"order"`
+		Name  string `meddler:"name"`
+	}
+	d := *SQLite
+	d.QuoteReservedOnly = true
+	names, err := d.ColumnsQuoted(new(Line), true)
+	if err != nil {
+		t.Fatalf("Error getting ColumnsQuoted: %v", err)
+	}
+	fields := strings.Split(names, ",")
+	sort.Strings(fields)
+	if expected := `"order",id,name`; strings.Join(fields, ",") != expected {
+		t.Errorf("Mismatch: expected %s, got %s", expected, strings.Join(fields, ","))
+	}
+	for name, expected := range map[string]string{
+		"from":       `"from"`,
+		"returning":  `"returning"`,
+		"first name": `"first name"`,
+		"2nd":        `"2nd"`,
+		"Email":      `Email`,
+	} {
+		if got := d.quoted(name); got != expected {
+			t.Errorf("quoted(%q): expected %s, got %s", name, expected, got)
+		}
+	}
+	mysql := *MySQL
+	mysql.QuoteReservedOnly = true
+	if got := mysql.quoted("returning"); got != "returning" {
+		t.Errorf("expected returning to be left bare in MySQL, got %s", got)
+	}
+
+	// the generated SQL works
+	if _, err := db.Exec(`create table line (id integer primary key, "order" integer, name text)`); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table line")
+	elt := &Line{Order: 3, Name: "three"}
+	if err := d.Insert(db, "line", elt); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	loaded := new(Line)
+	if err := d.Load(db, "line", loaded, elt.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if *loaded != *elt {
+		t.Errorf("expected %v, found %v", elt, loaded)
+	}
+}
+
 func TestPrimaryKey(t *testing.T) {
 	p := new(Person)
 	p.ID = 56
@@ -354,6 +628,78 @@ func TestValues(t *testing.T) {
 	}
 }
 
+func TestFields(t *testing.T) {
+	type Setting struct {
+		ID      int64             `meddler:"id,pk"`
+		Key     string            `meddler:"key"`
+		Value   map[string]string `meddler:"value,json"`
+		Count   int               `meddler:"count,zeroisnull"`
+		Created int64             `meddler:"created,generated"`
+	}
+	elt := &Setting{ID: 3, Key: "theme", Value: map[string]string{"color": "blue"}}
+
+	columns, values, err := Fields(elt, true)
+	if err != nil {
+		t.Fatalf("Fields error: %v", err)
+	}
+	if !reflect.DeepEqual(columns, []string{"id", "key", "value", "count"}) {
+		t.Errorf("unexpected columns: %v", columns)
+	}
+	if !reflect.DeepEqual(values, []interface{}{int64(3), "theme", []byte("{\"color\":\"blue\"}\n"), nil}) {
+		t.Errorf("unexpected values: %#v", values)
+	}
+
+	columns, values, err = Fields(elt, false)
+	if err != nil {
+		t.Fatalf("Fields error: %v", err)
+	}
+	if len(columns) != 3 || columns[0] != "key" || len(values) != 3 || values[0] != "theme" {
+		t.Errorf("expected the columns without the primary key, found %v and %v", columns, values)
+	}
+}
+
+func TestInsertParts(t *testing.T) {
+	once.Do(setup)
+
+	type Note struct {
+		ID   int64  `meddler:"id,pk"`
+		Body string `meddler:"body"`
+	}
+	if _, err := db.Exec("create table note (id integer primary key, body text, author text)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table note")
+
+	columns, placeholders, values, err := PostgreSQL.InsertParts(&Note{Body: "hello"})
+	if err != nil {
+		t.Fatalf("InsertParts error: %v", err)
+	}
+	if !reflect.DeepEqual(columns, []string{"body"}) || !reflect.DeepEqual(placeholders, []string{"$1"}) ||
+		!reflect.DeepEqual(values, []interface{}{"hello"}) {
+		t.Errorf("unexpected parts: %v %v %v", columns, placeholders, values)
+	}
+
+	// add a column that is not in the struct
+	columns, placeholders, values, err = SQLite.InsertParts(&Note{ID: 7, Body: "hello"})
+	if err != nil {
+		t.Fatalf("InsertParts error: %v", err)
+	}
+	columns = append(columns, "author")
+	placeholders = append(placeholders, SQLite.Placeholder)
+	values = append(values, "alice")
+	q := fmt.Sprintf("insert into note (%s) values (%s)", strings.Join(columns, ","), strings.Join(placeholders, ","))
+	if _, err := db.Exec(q, values...); err != nil {
+		t.Fatalf("DB error on insert: %v", err)
+	}
+	var body, author string
+	if err := db.QueryRow("select body, author from note where id = 7").Scan(&body, &author); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if body != "hello" || author != "alice" {
+		t.Errorf("expected hello by alice, found %s by %s", body, author)
+	}
+}
+
 func TestPlaceholders(t *testing.T) {
 	lst, err := MySQL.Placeholders(alice, true)
 	if err != nil {
@@ -435,6 +781,308 @@ func TestScanRow(t *testing.T) {
 	db.Exec("delete from person")
 }
 
+func TestScanAggregates(t *testing.T) {
+	once.Do(setup)
+
+	type Totals struct {
+		Total int      `meddler:"total"`
+		Sum   *float64 `meddler:"sum"`
+		Avg   *float64 `meddler:"avg"`
+	}
+	if _, err := db.Exec("create table payment (id integer primary key, amount real)"); err != nil {
+		t.Fatalf("DB error creating table: %v", err)
+	}
+	defer db.Exec("drop table payment")
+	query := "select count(*) as total, sum(amount) as sum, avg(amount) as avg from payment"
+
+	// aggregates over no rows are null, except for the count
+	totals := new(Totals)
+	if err := QueryRow(db, totals, query); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if totals.Total != 0 || totals.Sum != nil || totals.Avg != nil {
+		t.Errorf("expected no totals, found %d %v %v", totals.Total, totals.Sum, totals.Avg)
+	}
+
+	if _, err := db.Exec("insert into payment (amount) values (10), (20), (45)"); err != nil {
+		t.Fatalf("DB error on insert: %v", err)
+	}
+	if err := QueryRow(db, totals, query); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if totals.Total != 3 || totals.Sum == nil || *totals.Sum != 75 || totals.Avg == nil || *totals.Avg != 25 {
+		t.Errorf("expected 3 payments adding up to 75, found %d %v %v", totals.Total, totals.Sum, totals.Avg)
+	}
+}
+
+func TestScanRowColumns(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+	defer db.Exec("delete from person")
+
+	rows, err := db.Query("select name, id, 7 as lucky from person where id = 2")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	p := new(Person)
+	columns, err := ScanRowColumns(rows, p)
+	if err != nil {
+		t.Fatalf("ScanRowColumns error: %v", err)
+	}
+	if !reflect.DeepEqual(columns, []string{"name", "id", "lucky"}) {
+		t.Errorf("unexpected columns: %v", columns)
+	}
+	if p.ID != 2 || p.Name != "Bob" {
+		t.Errorf("expected Bob, found %v", p)
+	}
+
+	rows, err = db.Query("select * from person where id = 0")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if _, err := ScanRowColumns(rows, p); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, found %v", err)
+	}
+}
+
+func TestScanRowReuse(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	rows, err := db.Query("select * from person where id in (1,2) order by id")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+
+	// scan both rows into the same struct
+	elt := new(Person)
+	if err = Scan(rows, elt); err != nil {
+		t.Fatalf("Scan error on Alice: %v", err)
+	}
+	height := 65
+	personEqual(t, elt, &Person{1, "Alice", 0, "alice@alice.com", 0, 32, when, when, &when, &height})
+	aliceHeight, aliceUpdated := elt.Height, elt.Updated
+
+	if err = Scan(rows, elt); err != nil {
+		t.Fatalf("Scan error on Bob: %v", err)
+	}
+	personEqual(t, elt, &Person{2, "Bob", 0, "bob@bob.com", 0, 0, when, time.Time{}, nil, nil})
+
+	// values handed out for the first row are not reused for the second
+	if aliceHeight == nil || *aliceHeight != 65 {
+		t.Errorf("height from the first row was changed: %v", aliceHeight)
+	}
+	if aliceUpdated == nil || !aliceUpdated.Equal(when) {
+		t.Errorf("update time from the first row was changed: %v", aliceUpdated)
+	}
+	rows.Close()
+	db.Exec("delete from person")
+}
+
+func TestScanRowExtra(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	rows, err := db.Query("select id, name, 'admin' as role, Age * 2 as double_age, Email from person where name = ?", "Alice")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	elt := new(Person)
+	extra, err := ScanRowExtra(rows, elt)
+	if err != nil {
+		t.Fatalf("ScanRowExtra error: %v", err)
+	}
+	if elt.ID == 0 || elt.Name != "Alice" || elt.Email != "alice@alice.com" {
+		t.Errorf("unexpected person %#v", elt)
+	}
+	if len(extra) != 2 {
+		t.Errorf("expected two extra columns, found %v", extra)
+	}
+	if extra["role"] != "admin" {
+		t.Errorf("expected role admin, found %#v", extra["role"])
+	}
+	if extra["double_age"] != int64(64) {
+		t.Errorf("expected double_age 64, found %#v", extra["double_age"])
+	}
+
+	rows, err = db.Query("select id, 1 as other from person where name = ?", "Nobody")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if _, err := ScanRowExtra(rows, new(Person)); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, found %v", err)
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestScanRowExtraNulls(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	for _, test := range []struct {
+		mode    MapNulls
+		present bool
+		value   interface{}
+	}{
+		{MapNullsNil, true, nil},
+		{MapNullsSentinel, true, Null},
+		{MapNullsOmit, false, nil},
+	} {
+		d := *SQLite
+		d.MapNulls = test.mode
+		rows, err := db.Query("select id, name, null as nickname, 'x' as tag from person where name = ?", "Alice")
+		if err != nil {
+			t.Fatalf("DB error on query: %v", err)
+		}
+		extra, err := d.ScanRowExtra(rows, new(Person))
+		if err != nil {
+			t.Fatalf("ScanRowExtra error: %v", err)
+		}
+		value, present := extra["nickname"]
+		if present != test.present || value != test.value {
+			t.Errorf("mode %d: expected nickname %v (present %v), found %#v (present %v)", test.mode, test.value, test.present, value, present)
+		}
+		if extra["tag"] != "x" {
+			t.Errorf("mode %d: expected tag x, found %#v", test.mode, extra["tag"])
+		}
+	}
+
+	db.Exec("delete from person")
+}
+
+func TestScanQualifiedColumns(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+
+	elt := new(Person)
+	err := QueryRow(db, elt, `select id as "person.id", name as """person"".""name""", Email as "`+"`person`.`Email`"+`" from person where id = ?`, 1)
+	if err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if elt.ID != 1 || elt.Name != "Alice" || elt.Email != "alice@alice.com" {
+		t.Errorf("unexpected person %#v", elt)
+	}
+
+	// exact matches take precedence
+	type Joined struct {
+		ID      int64 `meddler:"id"`
+		OtherID int64 `meddler:"other.id"`
+	}
+	joined := new(Joined)
+	if err := QueryRow(db, joined, `select 1 as id, 2 as "other.id", 3 as "person.OtherID"`); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if joined.ID != 1 || joined.OtherID != 2 {
+		t.Errorf("unexpected record %#v", joined)
+	}
+
+	// two qualified columns for the same field are ambiguous
+	elt = new(Person)
+	err = QueryRow(db, elt, `select p.id as "users.id", p.id as "posts.id", p.name from person p where p.id = ?`, 1)
+	if err == nil || !strings.Contains(err.Error(), "alias") {
+		t.Errorf("expected an error for ambiguous columns, found %v", err)
+	}
+	rows, err := db.Query(`select 1 as "users.id", 2 as "posts.id"`)
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	var columnar struct {
+		ID []int64 `meddler:"id"`
+	}
+	if err := ScanColumnar(rows, &columnar); err == nil {
+		t.Errorf("expected an error for ambiguous columns")
+	}
+	rows.Close()
+
+	db.Exec("delete from person")
+}
+
+func TestScanColumnOrder(t *testing.T) {
+	once.Do(setup)
+
+	type Ordered struct {
+		A int64           `meddler:"a"`
+		B map[string]bool `meddler:"b,json"`
+		C string          `meddler:"c"`
+	}
+
+	// columns arrive in a different order than the fields are declared
+	rows, err := db.Query(`select '{"x":true}' as b, 1 as a, 'one' as c union all select '{"y":false}', 2, 'two'`)
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	var lst []*Ordered
+	if err := ScanAll(rows, &lst); err != nil {
+		t.Fatalf("ScanAll error: %v", err)
+	}
+	expected := []*Ordered{
+		{A: 1, B: map[string]bool{"x": true}, C: "one"},
+		{A: 2, B: map[string]bool{"y": false}, C: "two"},
+	}
+	if !reflect.DeepEqual(lst, expected) {
+		t.Errorf("expected %v %v, found %v", expected[0], expected[1], lst)
+	}
+
+	rows, err = db.Query(`select 'three' as c, '{}' as b, 3 as a`)
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	elt := new(Ordered)
+	if err := ScanRow(rows, elt); err != nil {
+		t.Fatalf("ScanRow error: %v", err)
+	}
+	if elt.A != 3 || elt.B == nil || len(elt.B) != 0 || elt.C != "three" {
+		t.Errorf("unexpected record %#v", elt)
+	}
+}
+
+type Entity struct {
+	ID    int64             `meddler:"id,pk"`
+	Kind  string            `meddler:"kind"`
+	Attrs map[string]string `meddler:"attrs,scanonly"`
+}
+
+func TestScanAllPivot(t *testing.T) {
+	once.Do(setup)
+
+	rows, err := db.Query(`select 1 as id, 'car' as kind, 'color' as attr_name, 'red' as attr_value
+		union all select 2, 'bike', 'color', 'blue'
+		union all select 1, 'car', 'doors', '4'
+		union all select 2, 'bike', 'gears', null
+		union all select 3, 'boat', null, null`)
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	var lst []*Entity
+	if err := ScanAllPivot(rows, &lst, "attrs", "attr_name", "attr_value"); err != nil {
+		t.Fatalf("ScanAllPivot error: %v", err)
+	}
+	expected := []*Entity{
+		{ID: 1, Kind: "car", Attrs: map[string]string{"color": "red", "doors": "4"}},
+		{ID: 2, Kind: "bike", Attrs: map[string]string{"color": "blue", "gears": ""}},
+		{ID: 3, Kind: "boat", Attrs: map[string]string{}},
+	}
+	if !reflect.DeepEqual(lst, expected) {
+		t.Errorf("expected %v %v %v, found %v", expected[0], expected[1], expected[2], lst)
+	}
+
+	rows, err = db.Query("select 1 as id, 'car' as kind")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if err := ScanAllPivot(rows, &lst, "attrs", "attr_name", "attr_value"); err == nil {
+		t.Errorf("expected an error for missing attribute columns")
+	}
+	rows, err = db.Query("select 1 as id, 'car' as kind, 'a' as attr_name, 'b' as attr_value")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if err := ScanAllPivot(rows, &lst, "kind", "attr_name", "attr_value"); err == nil {
+		t.Errorf("expected an error for a map column that is not a map")
+	}
+}
+
 func TestScanAll(t *testing.T) {
 	once.Do(setup)
 	insertAliceBob(t)
@@ -462,6 +1110,213 @@ func TestScanAll(t *testing.T) {
 	db.Exec("delete from person")
 }
 
+func TestScanAllEmpty(t *testing.T) {
+	once.Do(setup)
+
+	var lst []*Person
+	if err := SQLite.QueryAll(db, &lst, "select * from person"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if lst != nil {
+		t.Errorf("expected a nil slice by default, found %v", lst)
+	}
+
+	empty := *SQLite
+	empty.EmptySlices = true
+	if err := empty.QueryAll(db, &lst, "select * from person"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if lst == nil || len(lst) != 0 {
+		t.Errorf("expected an empty, non-nil slice, found %#v", lst)
+	}
+}
+
+func TestWarnPrecisionLoss(t *testing.T) {
+	once.Do(setup)
+
+	type Amount struct {
+		Value float64 `meddler:"value"`
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	warn := *SQLite
+	warn.WarnPrecisionLoss = true
+	for _, test := range []struct {
+		value string
+		warns bool
+	}{
+		{"'0.10'", false},
+		{"'2.5'", false},
+		{"12.75", false},
+		{"'12345678901234567.89'", true},
+	} {
+		buf.Reset()
+		elt := new(Amount)
+		if err := warn.QueryRow(db, elt, "select "+test.value+" as value"); err != nil {
+			t.Errorf("QueryRow error on %s: %v", test.value, err)
+			continue
+		}
+		if warned := strings.Contains(buf.String(), "loses precision"); warned != test.warns {
+			t.Errorf("%s: expected warning %v, log is %q", test.value, test.warns, buf.String())
+		}
+	}
+
+	// off by default
+	buf.Reset()
+	elt := new(Amount)
+	if err := SQLite.QueryRow(db, elt, "select '12345678901234567.89' as value"); err != nil {
+		t.Errorf("QueryRow error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no warning by default, log is %q", buf.String())
+	}
+}
+
+func TestScanIntegerOverflow(t *testing.T) {
+	once.Do(setup)
+
+	// database/sql already refuses values that do not fit the field, and
+	// reports the column and the value
+	type Small struct {
+		Value  int8  `meddler:"value"`
+		ValueZ int8  `meddler:"valuez,zeroisnull"`
+		Wide   int64 `meddler:"wide"`
+	}
+	for _, test := range []struct {
+		query  string
+		column string
+	}{
+		{"select 300 as value, 1 as valuez, 1 as wide", "value"},
+		{"select 1 as value, -129 as valuez, 1 as wide", "valuez"},
+	} {
+		err := QueryRow(db, new(Small), test.query)
+		if err == nil {
+			t.Errorf("%s: expected an out of range error", test.query)
+			continue
+		}
+		if msg := err.Error(); !strings.Contains(msg, test.column) || !strings.Contains(msg, "out of range") {
+			t.Errorf("%s: expected the column and range in the error, found %v", test.query, err)
+		}
+	}
+
+	elt := new(Small)
+	if err := QueryRow(db, elt, "select 127 as value, -128 as valuez, 9223372036854775807 as wide"); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if elt.Value != 127 || elt.ValueZ != -128 || elt.Wide != 9223372036854775807 {
+		t.Errorf("unexpected values %v", elt)
+	}
+}
+
+func TestScanAllPartial(t *testing.T) {
+	once.Do(setup)
+
+	type Reading struct {
+		ID    int64 `meddler:"id"`
+		Value int64 `meddler:"value"`
+	}
+	rows, err := db.Query("select 1 as id, 10 as value union all select 2, 20 union all select 3, 'bad' union all select 4, 40")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	var lst []*Reading
+	err = ScanAll(rows, &lst)
+	scanErr, ok := err.(*ScanError)
+	if !ok {
+		t.Fatalf("expected a *ScanError, found %v", err)
+	}
+	if scanErr.Row != 2 || !strings.Contains(err.Error(), "row 2") || scanErr.Unwrap() == nil {
+		t.Errorf("expected the error to name row 2, found %v", err)
+	}
+	if !reflect.DeepEqual(lst, []*Reading{{1, 10}, {2, 20}}) {
+		t.Errorf("expected the rows before the bad one, found %v", lst)
+	}
+}
+
+func TestScanColumnar(t *testing.T) {
+	once.Do(setup)
+	insertAliceBob(t)
+	defer db.Exec("delete from person")
+
+	type People struct {
+		ID      []int64             `meddler:"id"`
+		Name    []string            `meddler:"name"`
+		Height  []*int              `meddler:"height"`
+		Opened  []time.Time         `meddler:"opened,utctime"`
+		Missing []string            `meddler:"missing"`
+		Tags    []map[string]string `meddler:"tags,json"`
+	}
+	if _, err := db.Exec("update person set height = null where id = 2"); err != nil {
+		t.Fatalf("DB error on update: %v", err)
+	}
+	rows, err := db.Query("select id, name, height, opened, email, '{\"a\":\"b\"}' as tags from person order by id")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	people := new(People)
+	if err := ScanColumnar(rows, people); err != nil {
+		t.Fatalf("ScanColumnar error: %v", err)
+	}
+	if !reflect.DeepEqual(people.ID, []int64{1, 2}) || !reflect.DeepEqual(people.Name, []string{"Alice", "Bob"}) {
+		t.Errorf("unexpected columns: %v %v", people.ID, people.Name)
+	}
+	if len(people.Height) != 2 || people.Height[0] == nil || *people.Height[0] != aliceHeight || people.Height[1] != nil {
+		t.Errorf("expected Alice's height and a nil one, found %v", people.Height)
+	}
+	if len(people.Opened) != 2 || !people.Opened[0].Equal(when) || people.Opened[0].Location() != time.UTC {
+		t.Errorf("expected opened times in UTC, found %v", people.Opened)
+	}
+	if people.Missing != nil || len(people.Tags) != 2 || people.Tags[1]["a"] != "b" {
+		t.Errorf("unexpected columns: %v %v", people.Missing, people.Tags)
+	}
+
+	type NotSlices struct {
+		ID int64 `meddler:"id"`
+	}
+	rows, err = db.Query("select id from person")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if err := ScanColumnar(rows, new(NotSlices)); err == nil {
+		t.Errorf("expected an error for a field that is not a slice")
+	}
+}
+
+func TestScanAllUnsupported(t *testing.T) {
+	once.Do(setup)
+
+	var anything []interface{}
+	var values []Person
+	var numbers []*int
+	var notSlice Person
+	for _, test := range []struct {
+		dst  interface{}
+		name string
+	}{
+		{&anything, "interface {}"},
+		{&values, "meddler.Person"},
+		{&numbers, "*int"},
+		{&notSlice, "meddler.Person"},
+		{values, "[]meddler.Person"},
+		{nil, "<nil>"},
+	} {
+		rows, err := db.Query("select * from person")
+		if err != nil {
+			t.Fatalf("DB error on query: %v", err)
+		}
+		err = ScanAll(rows, test.dst)
+		if err == nil {
+			t.Errorf("%T: expected an error", test.dst)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.name) {
+			t.Errorf("%T: expected the error to name %s, found %v", test.dst, test.name, err)
+		}
+	}
+}
+
 func TestThrowAway(t *testing.T) {
 	once.Do(setup)
 	insertAliceBob(t)
@@ -475,3 +1330,232 @@ func TestThrowAway(t *testing.T) {
 	Debug = true
 	db.Exec("delete from person")
 }
+
+type Audit struct {
+	CreatedBy string `meddler:"created_by,zeroisnull"`
+	Revision  int    `meddler:"revision,zeroisnull"`
+}
+
+type Document struct {
+	ID    int64  `meddler:"id,pk"`
+	Title string `meddler:"title"`
+	*Audit
+}
+
+func TestEmbeddedPointer(t *testing.T) {
+	once.Do(setup)
+
+	names, err := Columns(new(Document), true)
+	if err != nil {
+		t.Fatalf("Error getting Columns: %v", err)
+	}
+	if strings.Join(names, ",") != "id,title,created_by,revision" {
+		t.Errorf("unexpected columns: %v", names)
+	}
+
+	// a nil embedded struct writes nulls
+	plain := &Document{Title: "plain"}
+	if err := Insert(db, "document", plain); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	var createdBy *string
+	if err := db.QueryRow("select created_by from document where id = ?", plain.ID).Scan(&createdBy); err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	if createdBy != nil {
+		t.Errorf("expected null created_by, found %v", *createdBy)
+	}
+
+	audited := &Document{Title: "audited", Audit: &Audit{CreatedBy: "alice", Revision: 3}}
+	if err := Insert(db, "document", audited); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+
+	// loading allocates the embedded struct
+	elt := new(Document)
+	if err := Load(db, "document", elt, audited.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if elt.Audit == nil || elt.CreatedBy != "alice" || elt.Revision != 3 {
+		t.Errorf("unexpected embedded values: %+v", elt.Audit)
+	}
+	elt = new(Document)
+	if err := Load(db, "document", elt, plain.ID); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if elt.Audit == nil || elt.CreatedBy != "" || elt.Revision != 0 {
+		t.Errorf("unexpected embedded values: %+v", elt.Audit)
+	}
+	db.Exec("delete from document")
+}
+
+type Profile struct {
+	MemberID int64  `meddler:"member_id"`
+	Bio      string `meddler:"bio"`
+}
+
+type Member struct {
+	ID      int64    `meddler:"id,pk"`
+	Name    string   `meddler:"name"`
+	Profile *Profile `meddler:",prefix=profile_"`
+}
+
+func TestOptionalJoin(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table member (id integer primary key, name text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table member")
+	if _, err := db.Exec("create table profile (member_id integer, bio text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table profile")
+	db.Exec("insert into member (id, name) values (1, 'Alice'), (2, 'Bob')")
+	db.Exec("insert into profile (member_id, bio) values (1, 'likes go')")
+
+	names, err := Columns(new(Member), true)
+	if err != nil {
+		t.Fatalf("Error getting Columns: %v", err)
+	}
+	if strings.Join(names, ",") != "id,name,profile_member_id,profile_bio" {
+		t.Errorf("unexpected columns: %v", names)
+	}
+
+	var members []*Member
+	err = QueryAll(db, &members, `select m.id, m.name, p.member_id as profile_member_id, p.bio as profile_bio
+		from member m left join profile p on p.member_id = m.id order by m.id`)
+	if err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("expected two members, found %d", len(members))
+	}
+	if p := members[0].Profile; p == nil || p.MemberID != 1 || p.Bio != "likes go" {
+		t.Errorf("expected the matched profile, found %+v", p)
+	}
+	if members[1].Profile != nil {
+		t.Errorf("expected no profile for the unmatched row, found %+v", members[1].Profile)
+	}
+
+	// a tag with more than the prefix is rejected
+	type Bad struct {
+		ID      int64    `meddler:"id,pk"`
+		Profile *Profile `meddler:"profile,prefix=profile_"`
+	}
+	if _, err := Columns(new(Bad), true); err == nil {
+		t.Errorf("expected an error for a prefix with a column name")
+	}
+}
+
+type Badge struct {
+	Since time.Time `meddler:"since,utctime"`
+	Tags  []string  `meddler:"tags,json"`
+}
+
+type BadgeMember struct {
+	ID    int64  `meddler:"id,pk"`
+	Name  string `meddler:"name"`
+	Badge *Badge `meddler:",prefix=badge_"`
+}
+
+type AuditedMember struct {
+	ID   int64  `meddler:"id,pk"`
+	Name string `meddler:"name"`
+	*Audit
+}
+
+func TestOptionalJoinMeddled(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table member (id integer primary key, name text)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table member")
+	if _, err := db.Exec("create table badge (member_id integer, since datetime, tags text, created_by text, revision integer)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table badge")
+	db.Exec("insert into member (id, name) values (1, 'Alice'), (2, 'Bob'), (3, 'Carol')")
+	db.Exec("insert into badge (member_id, since, tags) values (1, ?, '[\"gopher\"]'), (3, ?, null)", when, when)
+
+	// the meddlers of an unmatched optional struct do not see the nulls
+	var members []*BadgeMember
+	err := QueryAll(db, &members, `select m.id, m.name, b.since as badge_since, b.tags as badge_tags
+		from member m left join badge b on b.member_id = m.id order by m.id`)
+	if err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("expected three members, found %d", len(members))
+	}
+	if b := members[0].Badge; b == nil || !b.Since.Equal(when) || len(b.Tags) != 1 || b.Tags[0] != "gopher" {
+		t.Errorf("expected the matched badge, found %+v", b)
+	}
+	if members[1].Badge != nil {
+		t.Errorf("expected no badge for the unmatched row, found %+v", members[1].Badge)
+	}
+	if b := members[2].Badge; b == nil || !b.Since.Equal(when) || b.Tags != nil {
+		t.Errorf("expected a badge without tags, found %+v", b)
+	}
+
+	// an embedded pointer without a prefix is allocated even so
+	var audited []*AuditedMember
+	err = QueryAll(db, &audited, `select m.id, m.name, b.created_by, b.revision
+		from member m left join badge b on b.member_id = m.id order by m.id`)
+	if err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if len(audited) != 3 {
+		t.Fatalf("expected three members, found %d", len(audited))
+	}
+	if audited[1].Audit == nil || audited[1].CreatedBy != "" || audited[1].Revision != 0 {
+		t.Errorf("expected an empty embedded struct for the unmatched row, found %+v", audited[1].Audit)
+	}
+}
+
+type Article struct {
+	ID           int64  `meddler:"id,pk"`
+	Title        string `meddler:"title"`
+	SearchVector string `meddler:"search_vector,dialect=postgres"`
+	FullText     string `meddler:"full_text,dialect=mysql+sqlite"`
+}
+
+func TestDialectColumns(t *testing.T) {
+	tests := []struct {
+		d        *Database
+		expected []string
+	}{
+		{PostgreSQL, []string{"id", "title", "search_vector"}},
+		{MySQL, []string{"id", "title", "full_text"}},
+		{SQLite, []string{"id", "title", "full_text"}},
+		{MSSQL, []string{"id", "title"}},
+	}
+	for _, test := range tests {
+		names, err := test.d.Columns(new(Article), true)
+		if err != nil {
+			t.Errorf("Error getting Columns for %s: %v", test.d.Name, err)
+			continue
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: expected %v, found %v", test.d.Name, test.expected, names)
+		}
+	}
+
+	// copies of a Database keep its dialect
+	pg := *PostgreSQL
+	values, err := pg.Values(&Article{Title: "hello", SearchVector: "'hello':1"}, false)
+	if err != nil {
+		t.Fatalf("Error getting Values: %v", err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{"hello", "'hello':1"}) {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	type BadArticle struct {
+		ID int64 `meddler:"id,pk,dialect=postgres"`
+	}
+	if _, err := MySQL.Columns(new(BadArticle), true); err == nil {
+		t.Errorf("expected an error for a primary key limited to some dialects")
+	}
+}
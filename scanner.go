@@ -0,0 +1,103 @@
+package meddler
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// scanners holds the scanner factories registered with RegisterScanner,
+// guarded by fieldsCacheMutex.
+var scanners = make(map[reflect.Type]func() sql.Scanner)
+
+// RegisterScanner sets up the scan targets for fields of type t, and of
+// type *t, which do not have a meddler in their tags. For each such field
+// in each row, factory is called for a new sql.Scanner, which must be a
+// pointer to a type convertible to t. After the scan, its value is
+// converted to t and stored in the field. This allows a type from another
+// package, such as a decimal type, to be read using a scanner written for
+// it, typically a defined type with the same underlying type:
+//
+//	type decimalScanner decimal.Decimal
+//
+//	func (d *decimalScanner) Scan(src interface{}) error { ... }
+//
+//	meddler.RegisterScanner(reflect.TypeOf(decimal.Decimal{}), func() sql.Scanner { return new(decimalScanner) })
+//
+// Null columns are read as nil for fields of type *t, and handed to the
+// scanner for fields of type t. Values are written as they are. The
+// registry is global, and affects all Database values.
+func RegisterScanner(t reflect.Type, factory func() sql.Scanner) {
+	st := reflect.TypeOf(factory())
+	if st == nil || st.Kind() != reflect.Ptr || !st.Elem().ConvertibleTo(t) {
+		panic(fmt.Sprintf("meddler.RegisterScanner: the scanner must be a pointer to a type convertible to %v, found %v", t, st))
+	}
+
+	fieldsCacheMutex.Lock()
+	defer fieldsCacheMutex.Unlock()
+
+	scanners[t] = factory
+
+	// forget struct data that was gathered without the scanner
+	for key := range fieldsCache {
+		delete(fieldsCache, key)
+	}
+}
+
+// scannerMeddler reads a field using a scanner from a registered factory.
+type scannerMeddler struct {
+	factory func() sql.Scanner
+}
+
+// scannerTarget is the scan target of a scannerMeddler, which notes null
+// columns for pointer fields.
+type scannerTarget struct {
+	scanner  sql.Scanner
+	nullable bool
+	null     bool
+}
+
+func (t *scannerTarget) Scan(src interface{}) error {
+	if src == nil && t.nullable {
+		t.null = true
+		return nil
+	}
+	return t.scanner.Scan(src)
+}
+
+func (elt scannerMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	nullable := reflect.TypeOf(fieldAddr).Elem().Kind() == reflect.Ptr
+	return &scannerTarget{scanner: elt.factory(), nullable: nullable}, nil
+}
+
+func (elt scannerMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	target := scanTarget.(*scannerTarget)
+	fv := reflect.ValueOf(fieldAddr).Elem()
+	if target.nullable {
+		if target.null {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		fv.Set(reflect.New(fv.Type().Elem()))
+		fv = fv.Elem()
+	}
+	fv.Set(reflect.ValueOf(target.scanner).Elem().Convert(fv.Type()))
+	return nil
+}
+
+func (elt scannerMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	return field, nil
+}
+
+// lookupScanner finds the registered scanner factory for fields of type t.
+func lookupScanner(t reflect.Type) (Meddler, bool) {
+	if factory, present := scanners[t]; present {
+		return scannerMeddler{factory: factory}, true
+	}
+	if t.Kind() == reflect.Ptr {
+		if factory, present := scanners[t.Elem()]; present {
+			return scannerMeddler{factory: factory}, true
+		}
+	}
+	return nil, false
+}
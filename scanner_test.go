@@ -0,0 +1,81 @@
+package meddler
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Cents is a decimal-ish type without a Scan method of its own
+type Cents struct {
+	Units int64
+}
+
+// centsScanner reads a NUMERIC column into Cents
+type centsScanner Cents
+
+func (c *centsScanner) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		c.Units = 0
+		return nil
+	case int64:
+		c.Units = v * 100
+		return nil
+	case float64:
+		text = strconv.FormatFloat(v, 'f', 2, 64)
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Cents", src)
+	}
+	whole, frac, _ := strings.Cut(text, ".")
+	frac = (frac + "00")[:2]
+	n, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return err
+	}
+	c.Units = n
+	return nil
+}
+
+type Invoice struct {
+	ID       int64  `meddler:"id,pk"`
+	Amount   Cents  `meddler:"amount"`
+	Discount *Cents `meddler:"discount"`
+}
+
+func TestRegisterScanner(t *testing.T) {
+	once.Do(setup)
+
+	RegisterScanner(reflect.TypeOf(Cents{}), func() sql.Scanner { return new(centsScanner) })
+
+	elt := new(Invoice)
+	if err := QueryRow(db, elt, "select 1 as id, '12.34' as amount, 0.5 as discount"); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if elt.Amount.Units != 1234 || elt.Discount == nil || elt.Discount.Units != 50 {
+		t.Errorf("unexpected invoice %+v with discount %v", elt, elt.Discount)
+	}
+
+	// null is nil for pointers, and up to the scanner otherwise
+	if err := QueryRow(db, elt, "select 2 as id, null as amount, null as discount"); err != nil {
+		t.Fatalf("QueryRow error: %v", err)
+	}
+	if elt.Amount.Units != 0 || elt.Discount != nil {
+		t.Errorf("unexpected invoice %+v with discount %v", elt, elt.Discount)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a scanner of the wrong type")
+		}
+	}()
+	RegisterScanner(reflect.TypeOf(Cents{}), func() sql.Scanner { return new(UUID) })
+}
@@ -0,0 +1,375 @@
+package meddler
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaDiff compares a struct with an existing table and returns the
+// ALTER TABLE statements needed to add the columns that are present in
+// the struct but missing from the table. Columns are never dropped or
+// changed. The column types are approximations derived from the Go types
+// of the fields, in the names the database uses for them, and all added
+// columns allow nulls, so review the statements before running them
+// against anything but a development database.
+func (d *Database) SchemaDiff(db DB, table string, model interface{}) ([]string, error) {
+	data, err := d.getFields(reflect.TypeOf(model))
+	if err != nil {
+		return nil, err
+	}
+
+	// find the columns of the table using a query that returns no rows
+	q := fmt.Sprintf("SELECT * FROM %s WHERE 1=0", d.quoted(table))
+	rows, err := d.query(db, "SchemaDiff", q)
+	if err != nil {
+		return nil, &dbErr{msg: "meddler.SchemaDiff: DB error in Query", err: err}
+	}
+	existing, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return nil, &dbErr{msg: "meddler.SchemaDiff: DB error in Columns", err: err}
+	}
+	present := make(map[string]bool)
+	for _, name := range existing {
+		present[name] = true
+	}
+
+	structType := reflect.TypeOf(model).Elem()
+	var stmts []string
+	for _, name := range data.columns {
+		if present[name] {
+			continue
+		}
+		field := data.fields[name]
+		sqlType := "TEXT"
+		if field.columns == nil {
+			sqlType = d.columnType(structType.FieldByIndex(field.index).Type, field.meddler)
+		}
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", d.quoted(table), d.quoted(name), sqlType))
+	}
+
+	return stmts, nil
+}
+
+// SchemaDiff using the Default Database type
+func SchemaDiff(db DB, table string, model interface{}) ([]string, error) {
+	return Default.SchemaDiff(db, table, model)
+}
+
+// ValidateSchema compares a struct with an existing table, as a sanity
+// check when a program starts, and returns an error listing the columns
+// of the struct that are missing from the table, the columns of the table
+// that are missing from the struct, and the columns whose type as
+// reported by the driver cannot hold the Go type of their field. Types
+// are only compared for plain fields without a meddler, and only where
+// both types are recognized, so a nil error does not prove that every
+// column can be loaded and saved.
+func (d *Database) ValidateSchema(db DB, table string, model interface{}) error {
+	data, err := d.getFields(reflect.TypeOf(model))
+	if err != nil {
+		return err
+	}
+
+	// find the columns of the table using a query that returns no rows
+	q := fmt.Sprintf("SELECT * FROM %s WHERE 1=0", d.quoted(table))
+	rows, err := d.query(db, "ValidateSchema", q)
+	if err != nil {
+		return &dbErr{msg: "meddler.ValidateSchema: DB error in Query", err: err}
+	}
+	existing, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		return &dbErr{msg: "meddler.ValidateSchema: DB error in ColumnTypes", err: err}
+	}
+	types := make(map[string]string)
+	for _, column := range existing {
+		types[column.Name()] = column.DatabaseTypeName()
+	}
+
+	structType := reflect.TypeOf(model).Elem()
+	var missing, extra, mismatched []string
+	for _, name := range data.columns {
+		sqlType, present := types[name]
+		if !present {
+			missing = append(missing, name)
+			continue
+		}
+		field := data.fields[name]
+		if _, plain := field.meddler.(IdentityMeddler); !plain || field.columns != nil {
+			continue
+		}
+		f := structType.FieldByIndex(field.index)
+		if !typesCompatible(f.Type, sqlType) {
+			mismatched = append(mismatched, fmt.Sprintf("column %s is %s, but field %s is %v", name, sqlType, f.Name, f.Type))
+		}
+	}
+	for _, column := range existing {
+		if _, present := data.fields[column.Name()]; !present {
+			extra = append(extra, column.Name())
+		}
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "columns missing from the table: "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		problems = append(problems, "columns missing from the struct: "+strings.Join(extra, ", "))
+	}
+	problems = append(problems, mismatched...)
+	if len(problems) > 0 {
+		return fmt.Errorf("meddler.ValidateSchema: table %s does not match %v: %s", table, structType, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ValidateSchema using the Default Database type
+func ValidateSchema(db DB, table string, model interface{}) error {
+	return Default.ValidateSchema(db, table, model)
+}
+
+// typesCompatible reports whether a column of the given database type can
+// hold a field of type t without a meddler. Types it does not recognize
+// are taken to be compatible.
+func typesCompatible(t reflect.Type, sqlType string) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	sqlType = strings.ToUpper(sqlType)
+	has := func(parts ...string) bool {
+		for _, part := range parts {
+			if strings.Contains(sqlType, part) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case sqlType == "" || has("POINT", "INTERVAL"):
+		return true
+	case has("INT"):
+		sqlType = "integer"
+	case has("BOOL", "BIT"):
+		sqlType = "boolean"
+	case has("REAL", "FLOA", "DOUB", "NUMERIC", "DECIMAL"):
+		sqlType = "float"
+	case has("DATE", "TIME"):
+		sqlType = "time"
+	case has("CHAR", "TEXT", "CLOB"):
+		sqlType = "text"
+	case has("BLOB", "BINARY", "BYTEA"):
+		sqlType = "blob"
+	default:
+		return true
+	}
+
+	if t == timeType {
+		return sqlType == "time" || sqlType == "text"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return sqlType == "boolean" || sqlType == "integer"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return sqlType == "integer" || sqlType == "boolean" || sqlType == "float"
+	case reflect.Float32, reflect.Float64:
+		return sqlType == "float" || sqlType == "integer"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return sqlType == "blob" || sqlType == "text"
+		}
+	}
+	return true
+}
+
+// CreateTableSQL returns a CREATE TABLE statement for a struct, using the
+// same column types as SchemaDiff, which suit the database. An integer
+// primary key is made to be filled in by the database, and a field with
+// an fk option, as in `meddler:"author_id,fk=author"` or
+// `meddler:"author_id,fk=author.id"`, gets a REFERENCES clause. Review the statement before using it for
+// anything but tests and development databases.
+func (d *Database) CreateTableSQL(table string, model interface{}) (string, error) {
+	data, err := d.getFields(reflect.TypeOf(model))
+	if err != nil {
+		return "", err
+	}
+
+	structType := reflect.TypeOf(model).Elem()
+	var defs []string
+	for _, name := range data.columns {
+		field := data.fields[name]
+		sqlType := "TEXT"
+		if field.columns == nil {
+			sqlType = d.columnType(structType.FieldByIndex(field.index).Type, field.meddler)
+		}
+		if field.primaryKey {
+			sqlType = d.primaryKeyType(sqlType, field.kind)
+		}
+		def := d.quoted(name) + " " + sqlType
+		if field.references != "" {
+			ref, column := splitReference(field.references)
+			def += " REFERENCES " + d.quoted(ref)
+			if column != "" {
+				def += " (" + d.quoted(column) + ")"
+			}
+		}
+		defs = append(defs, def)
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (%s)", d.quoted(table), strings.Join(defs, ", ")), nil
+}
+
+// CreateTableSQL using the Default Database type
+func CreateTableSQL(table string, model interface{}) (string, error) {
+	return Default.CreateTableSQL(table, model)
+}
+
+// CreateSchemaSQL returns CREATE TABLE statements, as for CreateTableSQL,
+// for several structs keyed by table name. Tables referred to by fk
+// options come before the tables referring to them; otherwise the tables
+// are in alphabetical order. References among the tables that form a
+// cycle are an error, while references to tables outside of models are
+// left to the caller.
+func (d *Database) CreateSchemaSQL(models map[string]interface{}) ([]string, error) {
+	var tables []string
+	for table := range models {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	// find the tables each one refers to
+	refs := make(map[string][]string)
+	for _, table := range tables {
+		data, err := d.getFields(reflect.TypeOf(models[table]))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range data.columns {
+			if field := data.fields[name]; field.references != "" {
+				ref, _ := splitReference(field.references)
+				if _, present := models[ref]; present && ref != table {
+					refs[table] = append(refs[table], ref)
+				}
+			}
+		}
+	}
+
+	// put the referred tables first
+	var stmts []string
+	state := make(map[string]int) // 1 while visiting, 2 when done
+	var visit func(table string) error
+	visit = func(table string) error {
+		switch state[table] {
+		case 1:
+			return fmt.Errorf("meddler.CreateSchemaSQL: table %s is part of a cycle of references", table)
+		case 2:
+			return nil
+		}
+		state[table] = 1
+		for _, ref := range refs[table] {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+		state[table] = 2
+		stmt, err := d.CreateTableSQL(table, models[table])
+		if err != nil {
+			return err
+		}
+		stmts = append(stmts, stmt)
+		return nil
+	}
+	for _, table := range tables {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmts, nil
+}
+
+// CreateSchemaSQL using the Default Database type
+func CreateSchemaSQL(models map[string]interface{}) ([]string, error) {
+	return Default.CreateSchemaSQL(models)
+}
+
+// primaryKeyType returns the column type of a primary key column. Integer
+// keys are generated by the database.
+func (d *Database) primaryKeyType(sqlType string, kind reflect.Kind) string {
+	if isIntegerKind(kind) {
+		switch d.Name {
+		case "postgres":
+			return "BIGSERIAL PRIMARY KEY"
+		case "mysql":
+			return "BIGINT AUTO_INCREMENT PRIMARY KEY"
+		case "mssql":
+			return "BIGINT IDENTITY PRIMARY KEY"
+		}
+		return "INTEGER PRIMARY KEY"
+	}
+	return sqlType + " PRIMARY KEY"
+}
+
+// splitReference splits the value of an fk option into the table and the
+// column, which is empty if not given.
+func splitReference(ref string) (table, column string) {
+	if i := strings.LastIndex(ref, "."); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// columnType picks a column type for a field of type t saved using m.
+func (d *Database) columnType(t reflect.Type, m Meddler) string {
+	switch m := m.(type) {
+	case JSONMeddler:
+		if m {
+			// compressed
+			return d.binaryType()
+		}
+		return "TEXT"
+	case GobMeddler, *EncryptedMeddler:
+		return d.binaryType()
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		if d.Name == "mssql" {
+			// TIMESTAMP is a row version there
+			return "DATETIME2"
+		}
+		return "TIMESTAMP"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if d.Name == "mssql" {
+			return "BIT"
+		}
+		return "BOOLEAN"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "DOUBLE PRECISION"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return d.binaryType()
+		}
+	}
+	return "TEXT"
+}
+
+// binaryType returns the column type for binary values.
+func (d *Database) binaryType() string {
+	switch d.Name {
+	case "postgres":
+		return "BYTEA"
+	case "mssql":
+		return "VARBINARY(MAX)"
+	}
+	return "BLOB"
+}
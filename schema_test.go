@@ -0,0 +1,177 @@
+package meddler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Migrated struct {
+	ID       int64     `meddler:"id,pk"`
+	Name     string    `meddler:"name"`
+	Nickname *string   `meddler:"nickname"`
+	Score    float64   `meddler:"score"`
+	Tags     []string  `meddler:"tags,json"`
+	Created  time.Time `meddler:"created,utctime"`
+}
+
+func TestSchemaDiff(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table migrated (id integer primary key, name text not null)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table migrated")
+
+	stmts, err := SQLite.SchemaDiff(db, "migrated", new(Migrated))
+	if err != nil {
+		t.Fatalf("SchemaDiff error: %v", err)
+	}
+	expected := []string{
+		`ALTER TABLE "migrated" ADD COLUMN "nickname" TEXT`,
+		`ALTER TABLE "migrated" ADD COLUMN "score" DOUBLE PRECISION`,
+		`ALTER TABLE "migrated" ADD COLUMN "tags" TEXT`,
+		`ALTER TABLE "migrated" ADD COLUMN "created" TIMESTAMP`,
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("expected %d statements, found %v", len(expected), stmts)
+	}
+	for i, stmt := range stmts {
+		if stmt != expected[i] {
+			t.Errorf("expected %s, found %s", expected[i], stmt)
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			t.Errorf("error running %s: %v", stmt, err)
+		}
+	}
+
+	// once applied, nothing is left to do
+	stmts, err = SQLite.SchemaDiff(db, "migrated", new(Migrated))
+	if err != nil {
+		t.Fatalf("SchemaDiff error: %v", err)
+	}
+	if len(stmts) != 0 {
+		t.Errorf("expected no statements, found %v", stmts)
+	}
+
+	if _, err := SQLite.SchemaDiff(db, "no_such_table", new(Migrated)); err == nil {
+		t.Errorf("expected an error for a missing table")
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	once.Do(setup)
+
+	if _, err := db.Exec("create table drifted (id integer primary key, name text not null, score text, legacy integer)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table drifted")
+
+	type Drifted struct {
+		ID       int64   `meddler:"id,pk"`
+		Name     string  `meddler:"name"`
+		Score    float64 `meddler:"score"`
+		Nickname string  `meddler:"nickname"`
+	}
+	err := SQLite.ValidateSchema(db, "drifted", new(Drifted))
+	if err == nil {
+		t.Fatalf("expected an error for a mismatched schema")
+	}
+	for _, part := range []string{
+		"columns missing from the table: nickname",
+		"columns missing from the struct: legacy",
+		"column score is TEXT, but field Score is float64",
+	} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("expected the error to contain %q, found %v", part, err)
+		}
+	}
+	if strings.Contains(err.Error(), "column name ") || strings.Contains(err.Error(), "column id ") {
+		t.Errorf("expected matching columns not to be reported, found %v", err)
+	}
+
+	type Matching struct {
+		ID     int64    `meddler:"id,pk"`
+		Name   string   `meddler:"name"`
+		Score  []string `meddler:"score,json"`
+		Legacy *int     `meddler:"legacy"`
+	}
+	if err := SQLite.ValidateSchema(db, "drifted", new(Matching)); err != nil {
+		t.Errorf("ValidateSchema error: %v", err)
+	}
+
+	if err := SQLite.ValidateSchema(db, "no_such_table", new(Matching)); err == nil {
+		t.Errorf("expected an error for a missing table")
+	}
+}
+
+type Author struct {
+	ID   int64  `meddler:"id,pk"`
+	Name string `meddler:"name"`
+}
+
+type Book struct {
+	ID       int64  `meddler:"id,pk"`
+	AuthorID int64  `meddler:"author_id,fk=author"`
+	EditorID int64  `meddler:"editor_id,fk=author.id"`
+	Title    string `meddler:"title"`
+}
+
+func TestCreateSchemaSQL(t *testing.T) {
+	once.Do(setup)
+
+	stmts, err := SQLite.CreateSchemaSQL(map[string]interface{}{"book": new(Book), "author": new(Author)})
+	if err != nil {
+		t.Fatalf("CreateSchemaSQL error: %v", err)
+	}
+	expected := []string{
+		`CREATE TABLE "author" ("id" INTEGER PRIMARY KEY, "name" TEXT)`,
+		`CREATE TABLE "book" ("id" INTEGER PRIMARY KEY, "author_id" INTEGER REFERENCES "author", "editor_id" INTEGER REFERENCES "author" ("id"), "title" TEXT)`,
+	}
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Fatalf("expected %q, found %q", expected, stmts)
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Errorf("error running %s: %v", stmt, err)
+		}
+	}
+	db.Exec("drop table book")
+	db.Exec("drop table author")
+
+	// referred tables come first even when they sort last
+	stmts, err = PostgreSQL.CreateSchemaSQL(map[string]interface{}{"a_book": new(Book), "author": new(Author)})
+	if err != nil {
+		t.Fatalf("CreateSchemaSQL error: %v", err)
+	}
+	if len(stmts) != 2 || !strings.HasPrefix(stmts[0], `CREATE TABLE "author" ("id" BIGSERIAL PRIMARY KEY`) {
+		t.Errorf("expected author first, found %q", stmts)
+	}
+}
+
+func TestCreateTableSQLTypes(t *testing.T) {
+	type Attachment struct {
+		ID      int64     `meddler:"id,pk"`
+		Data    []byte    `meddler:"data"`
+		Meta    []string  `meddler:"meta,gob"`
+		Public  bool      `meddler:"public"`
+		Created time.Time `meddler:"created"`
+	}
+	for _, test := range []struct {
+		d        *Database
+		expected string
+	}{
+		{SQLite, `CREATE TABLE "attachment" ("id" INTEGER PRIMARY KEY, "data" BLOB, "meta" BLOB, "public" BOOLEAN, "created" TIMESTAMP)`},
+		{PostgreSQL, `CREATE TABLE "attachment" ("id" BIGSERIAL PRIMARY KEY, "data" BYTEA, "meta" BYTEA, "public" BOOLEAN, "created" TIMESTAMP)`},
+		{MSSQL, `CREATE TABLE "attachment" ("id" BIGINT IDENTITY PRIMARY KEY, "data" VARBINARY(MAX), "meta" VARBINARY(MAX), "public" BIT, "created" DATETIME2)`},
+	} {
+		q, err := test.d.CreateTableSQL("attachment", new(Attachment))
+		if err != nil {
+			t.Fatalf("%s: CreateTableSQL error: %v", test.d.Name, err)
+		}
+		if q != test.expected {
+			t.Errorf("%s: expected %s, found %s", test.d.Name, test.expected, q)
+		}
+	}
+}
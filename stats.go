@@ -0,0 +1,28 @@
+package meddler
+
+import (
+	"sync/atomic"
+)
+
+// rowsWritten and rowsRead count the rows seen by all Database values.
+var rowsWritten, rowsRead int64
+
+// Statistics holds the number of rows written and read through meddler
+// since the program started, as a cheap measure of usage.
+type Statistics struct {
+	// RowsWritten adds up the rows affected by the statements meddler
+	// runs, as reported by the driver, and the rows returned by writes
+	// using RETURNING.
+	RowsWritten int64
+
+	// RowsRead counts the rows scanned into structs.
+	RowsRead int64
+}
+
+// Stats returns the current row counts. It is safe for concurrent use.
+func Stats() Statistics {
+	return Statistics{
+		RowsWritten: atomic.LoadInt64(&rowsWritten),
+		RowsRead:    atomic.LoadInt64(&rowsRead),
+	}
+}
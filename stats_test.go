@@ -0,0 +1,29 @@
+package meddler
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	once.Do(setup)
+	db.Exec("delete from person")
+	defer db.Exec("delete from person")
+
+	before := Stats()
+	insertAliceBob(t)
+	var lst []*Person
+	if err := QueryAll(db, &lst, "select * from person"); err != nil {
+		t.Fatalf("QueryAll error: %v", err)
+	}
+	if _, err := SQLite.UpdateAllRows(db, "person", map[string]interface{}{"age": 40}); err != nil {
+		t.Fatalf("UpdateAllRows error: %v", err)
+	}
+
+	after := Stats()
+	if n := after.RowsWritten - before.RowsWritten; n < 4 {
+		t.Errorf("expected at least 4 rows written, found %d", n)
+	}
+	if n := after.RowsRead - before.RowsRead; n < 2 {
+		t.Errorf("expected at least 2 rows read, found %d", n)
+	}
+}
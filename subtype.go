@@ -0,0 +1,127 @@
+package meddler
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// subtypeTable describes a table whose rows are stored by several types.
+type subtypeTable struct {
+	column string                  // the discriminator column
+	pk     string                  // the primary key column
+	types  map[string]reflect.Type // pointer types by discriminator value
+}
+
+// RegisterSubtype registers the type of model as one of several types
+// stored in a single table, as in single-table inheritance. Each of them
+// marks a string field with the discriminator option, as in
+// `meddler:"type,discriminator"`, and every record of a registered type
+// is written with name in that column. LoadSubtype then reads a row of the
+// table back as the type named by its discriminator. All types registered
+// for a table must agree on the discriminator and primary key columns.
+// As with Register, a copy of a Database keeps the subtypes registered
+// before it was made, and registering on either one does not affect the
+// other.
+// Like Register, it is meant to be called during initialization, and it
+// panics if model is not a suitable struct.
+func (d *Database) RegisterSubtype(table, name string, model interface{}) {
+	if name == "" {
+		panic("meddler.RegisterSubtype: the discriminator value must not be empty")
+	}
+	typ := reflect.TypeOf(model)
+	data, err := d.getFields(typ)
+	if err != nil {
+		panic(fmt.Sprintf("meddler.RegisterSubtype: %v", err))
+	}
+	if data.discriminator == "" {
+		panic(fmt.Sprintf("meddler.RegisterSubtype: %v has no field marked as discriminator", typ))
+	}
+	if data.pk == "" {
+		panic(fmt.Sprintf("meddler.RegisterSubtype: %v has no primary key field", typ))
+	}
+
+	fieldsCacheMutex.Lock()
+	defer fieldsCacheMutex.Unlock()
+
+	// a copy made by WithContext gets struct data of its own from now on
+	d.base = nil
+
+	tbl, present := d.subtypes[table]
+	if !present {
+		tbl = &subtypeTable{column: data.discriminator, pk: data.pk}
+	}
+	if tbl.column != data.discriminator || tbl.pk != data.pk {
+		panic(fmt.Sprintf("meddler.RegisterSubtype: %v uses columns %s and %s, but other types of table %s use %s and %s",
+			typ, data.discriminator, data.pk, table, tbl.column, tbl.pk))
+	}
+	if other, present := tbl.types[name]; present && other != typ {
+		panic(fmt.Sprintf("meddler.RegisterSubtype: %s is already registered for table %s as %v", name, table, other))
+	}
+	if other, present := d.subtypeNames[typ]; present && other != name {
+		panic(fmt.Sprintf("meddler.RegisterSubtype: %v is already registered as %s", typ, other))
+	}
+
+	// the maps may be shared with copies of d, so they are never changed
+	types := make(map[string]reflect.Type, len(tbl.types)+1)
+	for key, value := range tbl.types {
+		types[key] = value
+	}
+	types[name] = typ
+	subtypes := make(map[string]*subtypeTable, len(d.subtypes)+1)
+	for key, value := range d.subtypes {
+		subtypes[key] = value
+	}
+	subtypes[table] = &subtypeTable{column: tbl.column, pk: tbl.pk, types: types}
+	names := make(map[reflect.Type]string, len(d.subtypeNames)+1)
+	for key, value := range d.subtypeNames {
+		names[key] = value
+	}
+	names[typ] = name
+	d.subtypes, d.subtypeNames = subtypes, names
+
+	// forget struct data that was gathered without the discriminator value
+	delete(fieldsCache, fieldsKey{db: d, typ: typ})
+}
+
+// RegisterSubtype using the Default Database type
+func RegisterSubtype(table, name string, model interface{}) {
+	Default.RegisterSubtype(table, name, model)
+}
+
+// LoadSubtype loads a record of a table registered with RegisterSubtype,
+// reading its discriminator first and then loading the row into a new
+// value of the type registered under it. The result is a pointer to a
+// struct. Returns sql.ErrNoRows if not found.
+func (d *Database) LoadSubtype(db DB, table string, pk int64) (interface{}, error) {
+	fieldsCacheMutex.Lock()
+	tbl := d.subtypes[table]
+	fieldsCacheMutex.Unlock()
+	if tbl == nil {
+		return nil, fmt.Errorf("meddler.LoadSubtype: no subtypes registered for table %s", table)
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", d.quoted(tbl.column), d.quoted(table), d.quoted(tbl.pk), d.argPlaceholder(1, pk))
+	var name string
+	if err := d.queryRowScan(db, "LoadSubtype", q, []interface{}{pk}, &name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, &dbErr{msg: "meddler.LoadSubtype: DB error in QueryRow", err: err}
+	}
+
+	typ, present := tbl.types[name]
+	if !present {
+		return nil, fmt.Errorf("meddler.LoadSubtype: no subtype registered for table %s as %q", table, name)
+	}
+	dst := reflect.New(typ.Elem()).Interface()
+	if err := d.Load(db, table, dst, pk); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// LoadSubtype using the Default Database type
+func LoadSubtype(db DB, table string, pk int64) (interface{}, error) {
+	return Default.LoadSubtype(db, table, pk)
+}
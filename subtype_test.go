@@ -0,0 +1,97 @@
+package meddler
+
+import (
+	"database/sql"
+	"testing"
+)
+
+type Dog struct {
+	ID   int64  `meddler:"id,pk"`
+	Type string `meddler:"type,discriminator"`
+	Name string `meddler:"name"`
+	Legs int    `meddler:"legs"`
+}
+
+type Bird struct {
+	ID    int64  `meddler:"id,pk"`
+	Type  string `meddler:"type,discriminator"`
+	Name  string `meddler:"name"`
+	Wings int    `meddler:"wings"`
+}
+
+type Puppy struct {
+	Dog
+}
+
+func TestSubtypes(t *testing.T) {
+	once.Do(setup)
+	if _, err := db.Exec("create table animal (id integer primary key, type text not null, name text, legs integer, wings integer)"); err != nil {
+		t.Fatalf("error creating table: %v", err)
+	}
+	defer db.Exec("drop table animal")
+
+	d := *SQLite
+	d.RegisterSubtype("animal", "dog", new(Dog))
+	d.RegisterSubtype("animal", "bird", new(Bird))
+
+	dog := &Dog{Name: "Rex", Legs: 4}
+	if err := d.Insert(db, "animal", dog); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+	if dog.Type != "dog" {
+		t.Errorf("expected the discriminator to be set, found %q", dog.Type)
+	}
+	bird := &Bird{Type: "wrong", Name: "Tweety", Wings: 2}
+	if err := d.Insert(db, "animal", bird); err != nil {
+		t.Fatalf("Insert error: %v", err)
+	}
+
+	var types []string
+	rows, err := db.Query("select type from animal order by id")
+	if err != nil {
+		t.Fatalf("DB error on query: %v", err)
+	}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatalf("DB error on scan: %v", err)
+		}
+		types = append(types, s)
+	}
+	rows.Close()
+	if len(types) != 2 || types[0] != "dog" || types[1] != "bird" {
+		t.Errorf("expected dog and bird, found %v", types)
+	}
+
+	got, err := d.LoadSubtype(db, "animal", dog.ID)
+	if err != nil {
+		t.Fatalf("LoadSubtype error: %v", err)
+	}
+	if loaded, ok := got.(*Dog); !ok || *loaded != *dog {
+		t.Errorf("expected %+v, found %#v", dog, got)
+	}
+	got, err = d.LoadSubtype(db, "animal", bird.ID)
+	if err != nil {
+		t.Fatalf("LoadSubtype error: %v", err)
+	}
+	if loaded, ok := got.(*Bird); !ok || loaded.Name != "Tweety" || loaded.Wings != 2 || loaded.Type != "bird" {
+		t.Errorf("expected a bird, found %#v", got)
+	}
+
+	if _, err := d.LoadSubtype(db, "animal", 99); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, found %v", err)
+	}
+	if _, err := d.LoadSubtype(db, "person", 1); err == nil {
+		t.Errorf("expected an error for a table without subtypes")
+	}
+
+	// registering on a copy leaves the original alone
+	copied := d
+	copied.RegisterSubtype("animal", "puppy", new(Puppy))
+	if _, present := d.subtypes["animal"].types["puppy"]; present {
+		t.Errorf("expected the original not to see subtypes registered on a copy")
+	}
+	if len(copied.subtypes["animal"].types) != 3 {
+		t.Errorf("expected the copy to have three subtypes, found %v", copied.subtypes["animal"].types)
+	}
+}
@@ -0,0 +1,95 @@
+package meddler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldTag is a parsed meddler struct tag of the form
+//
+//	column,option,key=value,...
+//
+// The column may be empty to keep the field name. A backslash escapes the
+// character after it, so that a comma or a backslash can be part of the
+// column name or of an option. The tag value is a quoted Go string, so
+// the backslash is written doubled in the source, as in
+// `meddler:"last\\, first"`; a single one makes the whole struct tag
+// invalid.
+type fieldTag struct {
+	column  string
+	options []tagOption
+}
+
+// tagOption is an option of a tag, with or without a value.
+type tagOption struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+func (opt tagOption) String() string {
+	if opt.hasValue {
+		return opt.key + "=" + opt.value
+	}
+	return opt.key
+}
+
+// parseTag parses the text of a meddler struct tag. Options must not be
+// empty, and an option with a value must have a key.
+func parseTag(s string) (fieldTag, error) {
+	var tag fieldTag
+	parts, err := splitTag(s)
+	if err != nil {
+		return tag, err
+	}
+	tag.column = parts[0].text
+	for _, part := range parts[1:] {
+		opt := tagOption{key: part.text}
+		if part.equals >= 0 {
+			opt = tagOption{key: part.text[:part.equals], value: part.text[part.equals+1:], hasValue: true}
+		}
+		if opt.key == "" {
+			if opt.hasValue {
+				return tag, fmt.Errorf("option %q has no name", opt.String())
+			}
+			return tag, fmt.Errorf("empty option in tag %q", s)
+		}
+		tag.options = append(tag.options, opt)
+	}
+	return tag, nil
+}
+
+// tagPart is one comma-separated part of a tag with its escapes removed.
+// equals is the position of the first unescaped = in text, or -1.
+type tagPart struct {
+	text   string
+	equals int
+}
+
+func splitTag(s string) ([]tagPart, error) {
+	var parts []tagPart
+	var b strings.Builder
+	equals := -1
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("tag %q ends in an unfinished escape", s)
+			}
+			i++
+			b.WriteByte(s[i])
+		case ',':
+			parts = append(parts, tagPart{text: b.String(), equals: equals})
+			b.Reset()
+			equals = -1
+		case '=':
+			if equals < 0 {
+				equals = b.Len()
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(parts, tagPart{text: b.String(), equals: equals}), nil
+}
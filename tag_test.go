@@ -0,0 +1,91 @@
+package meddler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	for _, test := range []struct {
+		tag      string
+		expected fieldTag
+		err      string
+	}{
+		{tag: "", expected: fieldTag{}},
+		{tag: "id", expected: fieldTag{column: "id"}},
+		{tag: "-", expected: fieldTag{column: "-"}},
+		{tag: "id,pk", expected: fieldTag{column: "id", options: []tagOption{{key: "pk"}}}},
+		{tag: ",zeroisnull", expected: fieldTag{options: []tagOption{{key: "zeroisnull"}}}},
+		{tag: "at,tz=America/New_York,generated", expected: fieldTag{column: "at", options: []tagOption{
+			{key: "tz", value: "America/New_York", hasValue: true}, {key: "generated"},
+		}}},
+		{tag: ",point,columns=lat+lng", expected: fieldTag{options: []tagOption{
+			{key: "point"}, {key: "columns", value: "lat+lng", hasValue: true},
+		}}},
+		{tag: "note,fk=", expected: fieldTag{column: "note", options: []tagOption{{key: "fk", hasValue: true}}}},
+		{tag: "expr,fk=a=b", expected: fieldTag{column: "expr", options: []tagOption{{key: "fk", value: "a=b", hasValue: true}}}},
+		{tag: `last\, first,json`, expected: fieldTag{column: "last, first", options: []tagOption{{key: "json"}}}},
+		{tag: `path,fk=dir\\file`, expected: fieldTag{column: "path", options: []tagOption{{key: "fk", value: `dir\file`, hasValue: true}}}},
+		{tag: `odd,key\=name`, expected: fieldTag{column: "odd", options: []tagOption{{key: "key=name"}}}},
+		{tag: "id,,pk", err: "empty option"},
+		{tag: "id,", err: "empty option"},
+		{tag: "id,=value", err: "has no name"},
+		{tag: `id\`, err: "unfinished escape"},
+	} {
+		tag, err := parseTag(test.tag)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: expected an error containing %q, found %v", test.tag, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: parseTag error: %v", test.tag, err)
+			continue
+		}
+		if !reflect.DeepEqual(tag, test.expected) {
+			t.Errorf("%q: expected %+v, found %+v", test.tag, test.expected, tag)
+		}
+	}
+
+	// escapes work through real struct tags, where the backslash is doubled
+	type Escaped struct {
+		ID   int64             `meddler:"id,pk"`
+		Name map[string]string `meddler:"last\\, first,json"`
+	}
+	columns, err := Columns(new(Escaped), true)
+	if err != nil {
+		t.Fatalf("Columns error: %v", err)
+	}
+	if !reflect.DeepEqual(columns, []string{"id", "last, first"}) {
+		t.Errorf("expected id and \"last, first\", found %q", columns)
+	}
+	data, err := Default.getFields(reflect.TypeOf(new(Escaped)))
+	if err != nil {
+		t.Fatalf("getFields error: %v", err)
+	}
+	if data.fields["last, first"].meddlerName != "json" {
+		t.Errorf("expected the json meddler, found %s", data.fields["last, first"].meddlerName)
+	}
+
+	// a single backslash makes the struct tag invalid, which go vet would
+	// complain about in a type declaration
+	unescaped := reflect.StructOf([]reflect.StructField{
+		{Name: "ID", Type: reflect.TypeOf(int64(0)), Tag: `meddler:"id,pk"`},
+		{Name: "Name", Type: reflect.TypeOf(""), Tag: `meddler:"last\, first"`},
+	})
+	if _, err := Columns(reflect.New(unescaped).Interface(), true); err == nil || !strings.Contains(err.Error(), "invalid struct tag") {
+		t.Errorf("expected an error for an invalid struct tag, found %v", err)
+	}
+
+	// malformed tags are reported with the field
+	type Broken struct {
+		ID   int64  `meddler:"id,pk"`
+		Name string `meddler:"name,,json"`
+	}
+	_, err = Columns(new(Broken), true)
+	if err == nil || !strings.Contains(err.Error(), "Name") || !strings.Contains(err.Error(), "malformed tag") {
+		t.Errorf("expected an error naming the malformed tag, found %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package meddler
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+)
+
+// UUIDBinaryMeddler stores UUID fields as their 16 raw bytes, as in
+// BINARY(16) or bytea columns, instead of as text. It handles fields whose
+// type is a [16]byte array, such as most UUID types, and types with
+// MarshalBinary and UnmarshalBinary methods, along with pointers to
+// either. Nil pointers are written as null, and null columns are read as
+// nil pointers or zero values. Reading a value that is not exactly 16
+// bytes long is an error.
+type UUIDBinaryMeddler bool
+
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// isUUIDArray reports whether t is a [16]byte array type.
+func isUUIDArray(t reflect.Type) bool {
+	return t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8
+}
+
+// uuidType returns the type of a UUID field, looking through a pointer,
+// or nil if it cannot be handled.
+func uuidType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isUUIDArray(t) || t.Implements(binaryMarshalerType) && reflect.PtrTo(t).Implements(binaryUnmarshalerType) {
+		return t
+	}
+	return nil
+}
+
+func (elt UUIDBinaryMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	t := reflect.TypeOf(fieldAddr)
+	if t == nil || t.Kind() != reflect.Ptr || uuidType(t.Elem()) == nil {
+		return nil, fmt.Errorf("meddler.UUIDBinaryMeddler.PreRead: unknown struct field type: %T", fieldAddr)
+	}
+	return new([]byte), nil
+}
+
+func (elt UUIDBinaryMeddler) PostRead(fieldAddr, scanTarget interface{}) error {
+	fv := reflect.ValueOf(fieldAddr).Elem()
+	raw := *scanTarget.(*[]byte)
+	if raw == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+	if len(raw) != 16 {
+		return fmt.Errorf("meddler.UUIDBinaryMeddler.PostRead: expected 16 bytes, found %d", len(raw))
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		fv.Set(reflect.New(fv.Type().Elem()))
+		fv = fv.Elem()
+	}
+	if isUUIDArray(fv.Type()) {
+		reflect.Copy(fv, reflect.ValueOf(raw))
+		return nil
+	}
+	if err := fv.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(raw); err != nil {
+		return fmt.Errorf("meddler.UUIDBinaryMeddler.PostRead: %v", err)
+	}
+	return nil
+}
+
+func (elt UUIDBinaryMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	fv := reflect.ValueOf(field)
+	if !fv.IsValid() || uuidType(fv.Type()) == nil {
+		return nil, fmt.Errorf("meddler.UUIDBinaryMeddler.PreWrite: unknown struct field type: %T", field)
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil, nil
+		}
+		fv = fv.Elem()
+	}
+
+	if isUUIDArray(fv.Type()) {
+		b := make([]byte, 16)
+		reflect.Copy(reflect.ValueOf(b), fv)
+		return b, nil
+	}
+	b, err := fv.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("meddler.UUIDBinaryMeddler.PreWrite: %v", err)
+	}
+	if len(b) != 16 {
+		return nil, fmt.Errorf("meddler.UUIDBinaryMeddler.PreWrite: expected 16 bytes, found %d", len(b))
+	}
+	return b, nil
+}
@@ -0,0 +1,217 @@
+package meddler
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Condition is a part of a WHERE clause. Conditions are built from column
+// comparisons with Col and Where, and combined with And and Or. They are
+// turned into SQL with WhereClause.
+type Condition interface {
+	// build appends the arguments of the condition to args and
+	// returns the SQL text using the placeholders for them.
+	build(d *Database, args []interface{}, nested bool) (string, []interface{}, error)
+}
+
+type comparison struct {
+	column string
+	value  interface{}
+}
+
+type group struct {
+	op    string
+	conds []Condition
+}
+
+// operand wraps a value that is compared with something other than
+// equality.
+type operand struct {
+	op    string
+	value interface{}
+}
+
+// Col returns a condition comparing a column to a value. A nil value
+// matches null columns. The value is compared for equality unless it is
+// wrapped using one of Ne, Gt, Gte, Lt, Lte, Like, or In. A slice or array
+// value is treated as if it was wrapped in In, except for []byte and
+// types implementing driver.Valuer, which are compared as they are.
+func Col(column string, value interface{}) Condition {
+	return comparison{column: column, value: value}
+}
+
+// Ne wraps a value so that it is compared using <>. Ne(nil) matches
+// columns that are not null.
+func Ne(value interface{}) interface{} {
+	return operand{op: "<>", value: value}
+}
+
+// Gt wraps a value so that it is compared using >.
+func Gt(value interface{}) interface{} {
+	return operand{op: ">", value: value}
+}
+
+// Gte wraps a value so that it is compared using >=.
+func Gte(value interface{}) interface{} {
+	return operand{op: ">=", value: value}
+}
+
+// Lt wraps a value so that it is compared using <.
+func Lt(value interface{}) interface{} {
+	return operand{op: "<", value: value}
+}
+
+// Lte wraps a value so that it is compared using <=.
+func Lte(value interface{}) interface{} {
+	return operand{op: "<=", value: value}
+}
+
+// Like wraps a pattern so that it is compared using LIKE.
+func Like(pattern interface{}) interface{} {
+	return operand{op: "LIKE", value: pattern}
+}
+
+// In wraps a slice so that the column is matched against any of its
+// elements using IN, with one placeholder per element. An empty slice
+// matches nothing.
+func In(values interface{}) interface{} {
+	return operand{op: "IN", value: values}
+}
+
+// Where returns a condition matching all of the columns in the map to
+// their values. The comparisons are ordered by column name, so the same
+// map always produces the same SQL.
+func Where(conditions map[string]interface{}) Condition {
+	var columns []string
+	for column := range conditions {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	g := group{op: "AND"}
+	for _, column := range columns {
+		g.conds = append(g.conds, Col(column, conditions[column]))
+	}
+	return g
+}
+
+// And returns a condition that holds if all of conds hold.
+func And(conds ...Condition) Condition {
+	return group{op: "AND", conds: conds}
+}
+
+// Or returns a condition that holds if any of conds holds.
+func Or(conds ...Condition) Condition {
+	return group{op: "OR", conds: conds}
+}
+
+func (c comparison) build(d *Database, args []interface{}, nested bool) (string, []interface{}, error) {
+	if c.column == "" || d.Quote != "" && strings.Contains(c.column, d.Quote) {
+		return "", nil, fmt.Errorf("meddler.WhereClause: invalid column name [%s]", c.column)
+	}
+	op, value := "=", c.value
+	if o, ok := value.(operand); ok {
+		op, value = o.op, o.value
+	} else if isInList(value) {
+		op = "IN"
+	}
+
+	switch {
+	case op == "IN":
+		return d.buildIn(c.column, value, args)
+	case value == nil && op == "=":
+		return d.quoted(c.column) + " IS NULL", args, nil
+	case value == nil && op == "<>":
+		return d.quoted(c.column) + " IS NOT NULL", args, nil
+	case value == nil:
+		return "", nil, fmt.Errorf("meddler.WhereClause: cannot compare column [%s] to null using %s", c.column, op)
+	}
+
+	args = append(args, value)
+	return d.quoted(c.column) + " " + op + " " + d.argPlaceholder(len(args), value), args, nil
+}
+
+// isInList reports whether a plain value is a list of values to match
+// using IN.
+func isInList(value interface{}) bool {
+	if _, ok := value.(driver.Valuer); ok {
+		return false
+	}
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return false
+	}
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+// buildIn expands a slice of values into an IN list.
+func (d *Database) buildIn(column string, values interface{}, args []interface{}) (string, []interface{}, error) {
+	val := reflect.ValueOf(values)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return "", nil, fmt.Errorf("meddler.WhereClause: IN on column [%s] needs a slice, found %T", column, values)
+	}
+	if val.Len() == 0 {
+		return "1=0", args, nil
+	}
+
+	var placeholders []string
+	for i := 0; i < val.Len(); i++ {
+		elt := val.Index(i).Interface()
+		args = append(args, elt)
+		placeholders = append(placeholders, d.argPlaceholder(len(args), elt))
+	}
+	return d.quoted(column) + " IN (" + strings.Join(placeholders, ",") + ")", args, nil
+}
+
+func (g group) build(d *Database, args []interface{}, nested bool) (string, []interface{}, error) {
+	if len(g.conds) == 0 {
+		// the neutral element of the operation
+		if g.op == "OR" {
+			return "1=0", args, nil
+		}
+		return "1=1", args, nil
+	}
+
+	// a group of one part is left out, so its parts are as nested as it is
+	var parts []string
+	for _, cond := range g.conds {
+		part, more, err := cond.build(d, args, nested || len(g.conds) > 1)
+		if err != nil {
+			return "", nil, err
+		}
+		args = more
+		parts = append(parts, part)
+	}
+
+	s := strings.Join(parts, " "+g.op+" ")
+	if nested && len(parts) > 1 {
+		s = "(" + s + ")"
+	}
+	return s, args, nil
+}
+
+// WhereClause returns the SQL text for a condition, without the WHERE
+// keyword, along with the arguments to pass with it in the query.
+// Placeholders are numbered starting with first, so the clause can follow
+// other parameters in a query.
+func (d *Database) WhereClause(cond Condition, first int) (string, []interface{}, error) {
+	if first < 1 {
+		return "", nil, fmt.Errorf("meddler.WhereClause: placeholders must be numbered from 1 or more, found %d", first)
+	}
+
+	// pad the argument list so placeholder numbers start at first
+	args := make([]interface{}, first-1)
+	clause, args, err := cond.build(d, args, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return clause, args[first-1:], nil
+}
+
+// WhereClause using the Default Database type
+func WhereClause(cond Condition, first int) (string, []interface{}, error) {
+	return Default.WhereClause(cond, first)
+}
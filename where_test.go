@@ -0,0 +1,124 @@
+package meddler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWhereClause(t *testing.T) {
+	cond := And(
+		Col("status", "active"),
+		Or(Col("age", 30), Col("name", "Bob")),
+		Col("closed", nil),
+	)
+
+	clause, args, err := PostgreSQL.WhereClause(cond, 1)
+	if err != nil {
+		t.Fatalf("WhereClause error: %v", err)
+	}
+	expected := `"status" = $1 AND ("age" = $2 OR "name" = $3) AND "closed" IS NULL`
+	if clause != expected {
+		t.Errorf("expected %s, found %s", expected, clause)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"active", 30, "Bob"}) {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	// placeholders can follow other parameters
+	clause, args, err = PostgreSQL.WhereClause(Or(Col("a", 1), And(Col("b", 2), Col("c", 3))), 3)
+	if err != nil {
+		t.Fatalf("WhereClause error: %v", err)
+	}
+	expected = `"a" = $3 OR ("b" = $4 AND "c" = $5)`
+	if clause != expected {
+		t.Errorf("expected %s, found %s", expected, clause)
+	}
+	if len(args) != 3 {
+		t.Errorf("expected 3 args, found %v", args)
+	}
+
+	clause, args, err = MySQL.WhereClause(Where(map[string]interface{}{"name": "Alice", "age": 32}), 1)
+	if err != nil {
+		t.Fatalf("WhereClause error: %v", err)
+	}
+	expected = "`age` = ? AND `name` = ?"
+	if clause != expected {
+		t.Errorf("expected %s, found %s", expected, clause)
+	}
+	if !reflect.DeepEqual(args, []interface{}{32, "Alice"}) {
+		t.Errorf("unexpected args: %v", args)
+	}
+
+	if _, _, err := MySQL.WhereClause(Col("bad`name", 1), 1); err == nil {
+		t.Errorf("expected an error for a column name containing a quote")
+	}
+
+	// a group of one part does not lose the parentheses of its part
+	clause, _, err = PostgreSQL.WhereClause(And(Col("x", 1), And(Or(Col("a", 1), Col("b", 2)))), 1)
+	if err != nil {
+		t.Fatalf("WhereClause error: %v", err)
+	}
+	expected = `"x" = $1 AND ("a" = $2 OR "b" = $3)`
+	if clause != expected {
+		t.Errorf("expected %s, found %s", expected, clause)
+	}
+
+	for _, first := range []int{0, -1} {
+		if _, _, err := PostgreSQL.WhereClause(Col("a", 1), first); err == nil {
+			t.Errorf("expected an error for placeholders numbered from %d", first)
+		}
+	}
+}
+
+func TestWhereOperators(t *testing.T) {
+	tests := []struct {
+		cond     Condition
+		expected string
+		args     []interface{}
+	}{
+		{Col("age", Gt(10)), `"age" > $1`, []interface{}{10}},
+		{Col("age", Gte(10)), `"age" >= $1`, []interface{}{10}},
+		{Col("age", Lt(10)), `"age" < $1`, []interface{}{10}},
+		{Col("age", Lte(10)), `"age" <= $1`, []interface{}{10}},
+		{Col("age", Ne(10)), `"age" <> $1`, []interface{}{10}},
+		{Col("closed", Ne(nil)), `"closed" IS NOT NULL`, nil},
+		{Col("name", Like("%foo%")), `"name" LIKE $1`, []interface{}{"%foo%"}},
+		{Col("id", In([]int{1, 2, 3})), `"id" IN ($1,$2,$3)`, []interface{}{1, 2, 3}},
+		{Col("id", In([]int{})), `1=0`, nil},
+		{
+			Where(map[string]interface{}{"age": Gte(18), "id": In([]int64{4, 5}), "name": "Bob"}),
+			`"age" >= $1 AND "id" IN ($2,$3) AND "name" = $4`,
+			[]interface{}{18, int64(4), int64(5), "Bob"},
+		},
+		{
+			Where(map[string]interface{}{"region": []string{"eu", "us"}, "status": []int{1, 2, 3}, "name": "Bob"}),
+			`"name" = $1 AND "region" IN ($2,$3) AND "status" IN ($4,$5,$6)`,
+			[]interface{}{"Bob", "eu", "us", 1, 2, 3},
+		},
+		{Col("data", []byte("raw")), `"data" = $1`, []interface{}{[]byte("raw")}},
+		{Col("id", [2]int{7, 8}), `"id" IN ($1,$2)`, []interface{}{7, 8}},
+	}
+
+	for _, test := range tests {
+		clause, args, err := PostgreSQL.WhereClause(test.cond, 1)
+		if err != nil {
+			t.Errorf("WhereClause error on %s: %v", test.expected, err)
+			continue
+		}
+		if clause != test.expected {
+			t.Errorf("expected %s, found %s", test.expected, clause)
+		}
+		if len(args) != 0 || len(test.args) != 0 {
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("%s: expected args %v, found %v", test.expected, test.args, args)
+			}
+		}
+	}
+
+	if _, _, err := PostgreSQL.WhereClause(Col("id", In(5)), 1); err == nil {
+		t.Errorf("expected an error for IN with a non-slice")
+	}
+	if _, _, err := PostgreSQL.WhereClause(Col("id", Gt(nil)), 1); err == nil {
+		t.Errorf("expected an error comparing to null with >")
+	}
+}